@@ -0,0 +1,225 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchWindow      = 10 * time.Millisecond
+	defaultBatchMaxSize     = 100
+	defaultBatchMaxInFlight = 10
+)
+
+// UnaryFuture is the pending result of a unary call started by
+// [Client.CallUnaryAsync] or a [UnaryBatcher]. It's safe to use from multiple
+// goroutines.
+type UnaryFuture[Res any] struct {
+	ctx    context.Context //nolint:containedctx
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Set before done is closed.
+	response *Response[Res]
+	err      error
+}
+
+func newUnaryFuture[Res any](ctx context.Context) *UnaryFuture[Res] {
+	ctx, cancel := context.WithCancel(ctx)
+	return &UnaryFuture[Res]{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Wait blocks until the call completes, and returns its result. Every call to
+// Wait returns the same response and error.
+func (f *UnaryFuture[Res]) Wait() (*Response[Res], error) {
+	<-f.done
+	return f.response, f.err
+}
+
+// Done returns a channel that's closed when the call completes.
+func (f *UnaryFuture[Res]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Cancel cancels the call's context. The call still completes, usually with
+// [CodeCanceled]; use Wait or Done to tell when it has. Canceling a completed
+// call does nothing.
+func (f *UnaryFuture[Res]) Cancel() {
+	f.cancel()
+}
+
+func (f *UnaryFuture[Res]) complete(response *Response[Res], err error) {
+	f.response, f.err = response, err
+	f.cancel() // release the context's resources
+	close(f.done)
+}
+
+// CallUnaryAsync starts a call to a request-response procedure, and returns
+// without waiting for it to complete. Any options apply to this call only.
+func (c *Client[Req, Res]) CallUnaryAsync(ctx context.Context, request *Request[Req], options ...CallOption) *UnaryFuture[Res] {
+	future := newUnaryFuture[Res](ctx)
+	go func() {
+		future.complete(c.CallUnary(future.ctx, request, options...))
+	}()
+	return future
+}
+
+// BatcherOptions configures a [UnaryBatcher].
+type BatcherOptions struct {
+	// Window is how long the batcher collects calls before sending them. It
+	// defaults to 10ms.
+	Window time.Duration
+	// MaxBatchSize sends a batch without waiting for the rest of the window
+	// once this many calls are waiting. It defaults to 100.
+	MaxBatchSize int
+	// MaxInFlight limits the number of requests the batcher has in flight at
+	// once, across all batches. Calls beyond the limit wait for a free slot.
+	// It defaults to 10.
+	MaxInFlight int
+}
+
+// UnaryBatcher collects the unary calls made within a short window and sends
+// them concurrently, with a bounded number of requests in flight. It lets
+// fan-out code start many calls without managing goroutines by hand.
+//
+// Each call is still a separate request: batching only shapes when calls are
+// sent and how many run at once. Calls with errors or cancelations don't
+// affect the rest of their batch.
+type UnaryBatcher[Req, Res any] struct {
+	client   *Client[Req, Res]
+	window   time.Duration
+	maxSize  int
+	inFlight chan struct{} // semaphore
+	calls    sync.WaitGroup
+
+	mu      sync.Mutex
+	pending []*batchedCall[Req, Res]
+	timer   *time.Timer
+	closed  bool
+}
+
+type batchedCall[Req, Res any] struct {
+	future  *UnaryFuture[Res]
+	request *Request[Req]
+	options []CallOption
+}
+
+// NewUnaryBatcher constructs a UnaryBatcher that sends calls with the given
+// client.
+func NewUnaryBatcher[Req, Res any](client *Client[Req, Res], options BatcherOptions) *UnaryBatcher[Req, Res] {
+	if options.Window <= 0 {
+		options.Window = defaultBatchWindow
+	}
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = defaultBatchMaxSize
+	}
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = defaultBatchMaxInFlight
+	}
+	return &UnaryBatcher[Req, Res]{
+		client:   client,
+		window:   options.Window,
+		maxSize:  options.MaxBatchSize,
+		inFlight: make(chan struct{}, options.MaxInFlight),
+	}
+}
+
+// Call adds a call to the current batch, and returns without waiting for it
+// to be sent. Any options apply to this call only. After the batcher is
+// closed, calls fail immediately with [CodeCanceled].
+func (b *UnaryBatcher[Req, Res]) Call(ctx context.Context, request *Request[Req], options ...CallOption) *UnaryFuture[Res] {
+	future := newUnaryFuture[Res](ctx)
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		future.complete(nil, errorf(CodeCanceled, "batcher is closed"))
+		return future
+	}
+	b.calls.Add(1)
+	b.pending = append(b.pending, &batchedCall[Req, Res]{
+		future:  future,
+		request: request,
+		options: options,
+	})
+	var batch []*batchedCall[Req, Res]
+	if len(b.pending) >= b.maxSize {
+		batch = b.takeLocked()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.Flush)
+	}
+	b.mu.Unlock()
+	if batch != nil {
+		b.send(batch)
+	}
+	return future
+}
+
+// Flush sends the current batch without waiting for the rest of the window.
+func (b *UnaryBatcher[Req, Res]) Flush() {
+	b.mu.Lock()
+	batch := b.takeLocked()
+	b.mu.Unlock()
+	if batch != nil {
+		b.send(batch)
+	}
+}
+
+// Close sends any pending calls, and waits for all the batcher's calls to
+// complete.
+func (b *UnaryBatcher[Req, Res]) Close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.Flush()
+	b.calls.Wait()
+}
+
+// takeLocked removes and returns the pending calls, if there are any.
+func (b *UnaryBatcher[Req, Res]) takeLocked() []*batchedCall[Req, Res] {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// send starts each call in the batch in order, as in-flight slots free up.
+func (b *UnaryBatcher[Req, Res]) send(batch []*batchedCall[Req, Res]) {
+	go func() {
+		for _, call := range batch {
+			select {
+			case b.inFlight <- struct{}{}:
+			case <-call.future.ctx.Done():
+				call.future.complete(nil, wrapIfContextError(call.future.ctx.Err()))
+				b.calls.Done()
+				continue
+			}
+			go func(call *batchedCall[Req, Res]) {
+				defer b.calls.Done()
+				defer func() { <-b.inFlight }()
+				call.future.complete(b.client.CallUnary(call.future.ctx, call.request, call.options...))
+			}(call)
+		}
+	}()
+}
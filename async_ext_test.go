@@ -0,0 +1,161 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+)
+
+func TestCallUnaryAsync(t *testing.T) {
+	t.Parallel()
+	// Negative numbers block until the call is canceled.
+	server := newPingServer(t, &pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+			if request.Msg.Number < 0 {
+				<-ctx.Done()
+				return nil, connect.NewError(connect.CodeCanceled, ctx.Err())
+			}
+			return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+		},
+	})
+	client := connect.NewClient[pingv1_test.PingRequest, pingv1_test.PingResponse](
+		server.Client(),
+		server.URL+"/connect.ping.v1.PingService/Ping",
+	)
+	t.Run("wait", func(t *testing.T) {
+		t.Parallel()
+		future := client.CallUnaryAsync(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42}))
+		<-future.Done()
+		response, err := future.Wait()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+	})
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+		future := client.CallUnaryAsync(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: -1}))
+		future.Cancel()
+		_, err := future.Wait()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+	})
+}
+
+func TestUnaryBatcher(t *testing.T) {
+	t.Parallel()
+	// newClient starts a server whose Ping procedure records its peak
+	// concurrency in maxActive, and returns a client for it. Calls with
+	// negative numbers block until they're canceled.
+	newClient := func(t *testing.T, maxActive *atomic.Int64) *connect.Client[pingv1_test.PingRequest, pingv1_test.PingResponse] {
+		t.Helper()
+		var active atomic.Int64
+		server := newPingServer(t, &pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				current := active.Add(1)
+				defer active.Add(-1)
+				for {
+					peak := maxActive.Load()
+					if current <= peak || maxActive.CompareAndSwap(peak, current) {
+						break
+					}
+				}
+				if request.Msg.Number < 0 {
+					<-ctx.Done()
+					return nil, connect.NewError(connect.CodeCanceled, ctx.Err())
+				}
+				time.Sleep(time.Millisecond)
+				return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+			},
+		})
+		return connect.NewClient[pingv1_test.PingRequest, pingv1_test.PingResponse](
+			server.Client(),
+			server.URL+"/connect.ping.v1.PingService/Ping",
+		)
+	}
+	t.Run("max_in_flight", func(t *testing.T) {
+		t.Parallel()
+		var maxActive atomic.Int64
+		batcher := connect.NewUnaryBatcher(newClient(t, &maxActive), connect.BatcherOptions{MaxInFlight: 2})
+		var futures []*connect.UnaryFuture[pingv1_test.PingResponse]
+		for i := int64(1); i <= 10; i++ {
+			futures = append(futures, batcher.Call(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: i})))
+		}
+		batcher.Close()
+		for i, future := range futures {
+			select {
+			case <-future.Done():
+			default:
+				t.Fatalf("call %d still pending after Close", i)
+			}
+			response, err := future.Wait()
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, int64(i+1))
+		}
+		assert.True(t, maxActive.Load() <= 2)
+	})
+	t.Run("max_batch_size", func(t *testing.T) {
+		t.Parallel()
+		var maxActive atomic.Int64
+		batcher := connect.NewUnaryBatcher(newClient(t, &maxActive), connect.BatcherOptions{
+			Window:       time.Hour,
+			MaxBatchSize: 2,
+		})
+		t.Cleanup(batcher.Close)
+		first := batcher.Call(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1}))
+		second := batcher.Call(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 2}))
+		_, err := first.Wait()
+		assert.Nil(t, err)
+		_, err = second.Wait()
+		assert.Nil(t, err)
+	})
+	t.Run("window", func(t *testing.T) {
+		t.Parallel()
+		var maxActive atomic.Int64
+		batcher := connect.NewUnaryBatcher(newClient(t, &maxActive), connect.BatcherOptions{Window: time.Millisecond})
+		t.Cleanup(batcher.Close)
+		response, err := batcher.Call(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1})).Wait()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 1)
+	})
+	t.Run("cancel_while_waiting", func(t *testing.T) {
+		t.Parallel()
+		var maxActive atomic.Int64
+		batcher := connect.NewUnaryBatcher(newClient(t, &maxActive), connect.BatcherOptions{MaxInFlight: 1})
+		blocked := batcher.Call(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: -1}))
+		waiting := batcher.Call(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1}))
+		batcher.Flush()
+		waiting.Cancel()
+		_, err := waiting.Wait()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		blocked.Cancel()
+		batcher.Close()
+		_, err = blocked.Wait()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+	})
+	t.Run("closed", func(t *testing.T) {
+		t.Parallel()
+		var maxActive atomic.Int64
+		batcher := connect.NewUnaryBatcher(newClient(t, &maxActive), connect.BatcherOptions{})
+		batcher.Close()
+		_, err := batcher.Call(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{})).Wait()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		assert.Equal(t, maxActive.Load(), int64(0))
+	})
+}
@@ -0,0 +1,458 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultEjectionFailures = 5
+	defaultEjectionDuration = 30 * time.Second
+)
+
+// A Balancer spreads calls across the endpoints discovered by a [Resolver].
+// For each call, it asks a [Picker] to choose one of the endpoints that
+// haven't been ejected. Endpoints that fail several consecutive calls with
+// [CodeUnavailable] are ejected for a while; see [WithEjection].
+//
+// Balancers are meant to be shared: construct one for each backend and pass it
+// to all the clients that call it with [WithBalancer]. Call Close to stop
+// resolving once the clients are no longer needed.
+type Balancer struct {
+	picker           Picker
+	ejectionFailures int
+	ejectionDuration time.Duration
+	cancel           context.CancelFunc
+
+	resolved     chan struct{}
+	resolvedOnce sync.Once
+
+	mu         sync.Mutex
+	endpoints  []*balancerEndpoint // in the order returned by the resolver
+	generation uint64              // incremented by each update
+	resolveErr error               // from the latest failed lookup
+}
+
+// NewBalancer constructs a [Balancer] and starts resolving endpoints. If the
+// picker is nil, the balancer uses [PickFirst].
+func NewBalancer(resolver Resolver, picker Picker, options ...BalancerOption) *Balancer {
+	if picker == nil {
+		picker = PickFirst()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	balancer := &Balancer{
+		picker:           picker,
+		ejectionFailures: defaultEjectionFailures,
+		ejectionDuration: defaultEjectionDuration,
+		cancel:           cancel,
+		resolved:         make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt.applyToBalancer(balancer)
+	}
+	go func() {
+		resolver.Resolve(ctx, balancer.update)
+		// If the resolver gave up without resolving anything, don't leave calls
+		// waiting for it.
+		balancer.resolvedOnce.Do(func() { close(balancer.resolved) })
+	}()
+	return balancer
+}
+
+// Close stops the balancer's resolver. Calls made after Close use the last
+// resolved endpoints.
+func (b *Balancer) Close() {
+	b.cancel()
+}
+
+// update replaces the resolved endpoints, keeping the state of endpoints that
+// are still present. Failed lookups keep the current endpoints, but stop calls
+// from waiting for the first resolution.
+func (b *Balancer) update(addrs []string, err error) {
+	b.mu.Lock()
+	if err != nil {
+		b.resolveErr = err
+		b.mu.Unlock()
+		b.resolvedOnce.Do(func() { close(b.resolved) })
+		return
+	}
+	existing := make(map[string]*balancerEndpoint, len(b.endpoints))
+	for _, endpoint := range b.endpoints {
+		existing[endpoint.addr] = endpoint
+	}
+	endpoints := make([]*balancerEndpoint, 0, len(addrs))
+	seen := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		if _, ok := seen[addr]; ok {
+			// Drop duplicates, which would otherwise skew the pickers.
+			continue
+		}
+		seen[addr] = struct{}{}
+		endpoint, ok := existing[addr]
+		if !ok {
+			endpoint = &balancerEndpoint{addr: addr}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	b.endpoints = endpoints
+	b.generation++
+	b.resolveErr = nil
+	b.mu.Unlock()
+	b.resolvedOnce.Do(func() { close(b.resolved) })
+}
+
+// addrsSince returns the resolved addresses and the current generation, if
+// the endpoints have changed since the given generation. Otherwise, it returns
+// nil.
+func (b *Balancer) addrsSince(generation uint64) (map[string]struct{}, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.generation == generation {
+		return nil, generation
+	}
+	addrs := make(map[string]struct{}, len(b.endpoints))
+	for _, endpoint := range b.endpoints {
+		addrs[endpoint.addr] = struct{}{}
+	}
+	return addrs, b.generation
+}
+
+// pick chooses an endpoint for a call, waiting for the first resolution (or
+// failed lookup) if necessary. Callers must pass the endpoint to done once the call finishes.
+func (b *Balancer) pick(ctx context.Context, header http.Header) (*balancerEndpoint, error) {
+	select {
+	case <-b.resolved:
+	case <-ctx.Done():
+		return nil, wrapIfContextError(ctx.Err())
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	candidates := make([]*balancerEndpoint, 0, len(b.endpoints))
+	for _, endpoint := range b.endpoints {
+		if !now.Before(endpoint.ejectedUntil) {
+			candidates = append(candidates, endpoint)
+		}
+	}
+	if len(candidates) == 0 {
+		// Every endpoint has been ejected. Rather than fail every call, keep
+		// trying all of them.
+		candidates = b.endpoints
+	}
+	if len(candidates) == 0 {
+		if b.resolveErr != nil {
+			return nil, errorf(CodeUnavailable, "no endpoints resolved: %w", b.resolveErr)
+		}
+		return nil, errorf(CodeUnavailable, "no endpoints resolved")
+	}
+	snapshot := make([]Endpoint, len(candidates))
+	for i, endpoint := range candidates {
+		snapshot[i] = Endpoint{Addr: endpoint.addr, Outstanding: endpoint.outstanding}
+	}
+	index := b.picker.Pick(header, snapshot)
+	if index < 0 || index >= len(candidates) {
+		index = 0
+	}
+	endpoint := candidates[index]
+	endpoint.outstanding++
+	return endpoint, nil
+}
+
+// done records the outcome of a call to the endpoint.
+func (b *Balancer) done(endpoint *balancerEndpoint, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	endpoint.outstanding--
+	if err == nil || CodeOf(err) != CodeUnavailable {
+		endpoint.failures = 0
+		return
+	}
+	endpoint.failures++
+	if b.ejectionFailures > 0 && endpoint.failures >= b.ejectionFailures {
+		endpoint.failures = 0
+		endpoint.ejectedUntil = time.Now().Add(b.ejectionDuration)
+	}
+}
+
+type balancerEndpoint struct {
+	addr         string
+	outstanding  int
+	failures     int // consecutive calls that failed with CodeUnavailable
+	ejectedUntil time.Time
+}
+
+// A BalancerOption configures a [Balancer].
+type BalancerOption interface {
+	applyToBalancer(*Balancer)
+}
+
+// WithEjection configures how the balancer ejects unhealthy endpoints: after
+// the given number of consecutive calls to an endpoint fail with
+// [CodeUnavailable], the balancer stops picking it for the given duration. If
+// every endpoint has been ejected, the balancer picks from all of them.
+//
+// By default, endpoints are ejected for 30 seconds after 5 consecutive
+// failures. A non-positive number of failures disables ejection.
+func WithEjection(failures int, duration time.Duration) BalancerOption {
+	return &ejectionOption{Failures: failures, Duration: duration}
+}
+
+type ejectionOption struct {
+	Failures int
+	Duration time.Duration
+}
+
+func (o *ejectionOption) applyToBalancer(balancer *Balancer) {
+	balancer.ejectionFailures = o.Failures
+	balancer.ejectionDuration = o.Duration
+}
+
+// Endpoint describes an endpoint that a [Picker] may choose.
+type Endpoint struct {
+	// Addr is the endpoint's address, as returned by the [Resolver].
+	Addr string
+	// Outstanding is the number of calls to the endpoint currently in flight
+	// from clients sharing the [Balancer].
+	Outstanding int
+}
+
+// A Picker chooses an endpoint for each call. Pick receives the request
+// headers and the endpoints that haven't been ejected (which are never
+// empty), in the order returned by the [Resolver], and returns the index of
+// the chosen endpoint.
+//
+// Pick is called while the [Balancer] holds a lock, so it must be fast and
+// must not block. Streams are balanced when they're created, before the
+// caller has added any request headers.
+type Picker interface {
+	Pick(header http.Header, endpoints []Endpoint) int
+}
+
+// PickFirst returns a [Picker] that sends every call to the first available
+// endpoint, moving on to the next only if it's ejected.
+func PickFirst() Picker {
+	return &pickFirstPicker{}
+}
+
+// RoundRobin returns a [Picker] that cycles through the available endpoints.
+func RoundRobin() Picker {
+	return &roundRobinPicker{}
+}
+
+// LeastOutstanding returns a [Picker] that chooses the endpoint with the
+// fewest calls in flight, breaking ties in round-robin order.
+func LeastOutstanding() Picker {
+	return &leastOutstandingPicker{}
+}
+
+// ConsistentHash returns a [Picker] that hashes the value of the named request
+// header, so that calls with the same value go to the same endpoint for as
+// long as it's available. When endpoints come and go, only the calls that hash
+// to them move. Calls without the header are spread round-robin.
+func ConsistentHash(header string) Picker {
+	return &consistentHashPicker{header: http.CanonicalHeaderKey(header)}
+}
+
+type pickFirstPicker struct{}
+
+func (p *pickFirstPicker) Pick(http.Header, []Endpoint) int {
+	return 0
+}
+
+type roundRobinPicker struct {
+	next atomic.Uint64
+}
+
+func (p *roundRobinPicker) Pick(_ http.Header, endpoints []Endpoint) int {
+	return int((p.next.Add(1) - 1) % uint64(len(endpoints)))
+}
+
+type leastOutstandingPicker struct {
+	next atomic.Uint64
+}
+
+func (p *leastOutstandingPicker) Pick(_ http.Header, endpoints []Endpoint) int {
+	start := int((p.next.Add(1) - 1) % uint64(len(endpoints)))
+	best := start
+	for offset := 1; offset < len(endpoints); offset++ {
+		i := (start + offset) % len(endpoints)
+		if endpoints[i].Outstanding < endpoints[best].Outstanding {
+			best = i
+		}
+	}
+	return best
+}
+
+// consistentHashPicker uses rendezvous hashing: each call goes to the
+// endpoint with the highest hash of the key and the endpoint's address.
+type consistentHashPicker struct {
+	header     string
+	roundRobin roundRobinPicker
+}
+
+func (p *consistentHashPicker) Pick(header http.Header, endpoints []Endpoint) int {
+	key := header.Get(p.header)
+	if key == "" {
+		return p.roundRobin.Pick(header, endpoints)
+	}
+	var best int
+	var bestScore uint64
+	for i, endpoint := range endpoints {
+		hash := fnv.New64a()
+		_, _ = io.WriteString(hash, key)
+		_, _ = hash.Write([]byte{0})
+		_, _ = io.WriteString(hash, endpoint.Addr)
+		if score := mix64(hash.Sum64()); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// mix64 is the finalizer from SplitMix64. FNV hashes of similar inputs are
+// poorly distributed, which would make rendezvous hashing uneven.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// balancedClient lazily constructs a protocolClient, along with its unary
+// call chain, for each endpoint chosen by a Balancer. It discards the clients
+// for endpoints that the resolver no longer returns.
+type balancedClient struct {
+	balancer  *Balancer
+	url       *url.URL
+	newClient func(url string) (*endpointClient, error)
+
+	mu         sync.Mutex
+	clients    map[string]*endpointClient
+	generation uint64 // of the balancer's endpoints when clients was last pruned
+}
+
+// endpointClient is a protocolClient for a single URL, along with its unary
+// call chain.
+type endpointClient struct {
+	url            string
+	protocolClient ProtocolClient
+	baseUnaryFunc  UnaryFunc // without interceptors
+	unaryFunc      UnaryFunc // wrapped with the client's interceptors
+	newDerived     func(callProtocolOptions) (*endpointClient, error)
+
+	mu      sync.Mutex
+	derived map[callProtocolOptions]*endpointClient
+}
+
+// forCall returns the endpoint client for a call's options. Calls that change
+// the protocol's behavior use a derived client, which is cached so that later
+// calls with the same options can reuse it.
+func (c *endpointClient) forCall(call *callConfig) (*endpointClient, error) {
+	options := call.protocolOptions()
+	if options == (callProtocolOptions{}) {
+		return c, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if derived, ok := c.derived[options]; ok {
+		return derived, nil
+	}
+	derived, err := c.newDerived(options)
+	if err != nil {
+		return nil, err
+	}
+	if c.derived == nil {
+		c.derived = make(map[callProtocolOptions]*endpointClient)
+	}
+	c.derived[options] = derived
+	return derived, nil
+}
+
+func newBalancedClient(
+	balancer *Balancer,
+	rawURL string,
+	newClient func(url string) (*endpointClient, error),
+) (*balancedClient, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, NewError(CodeUnavailable, err)
+	}
+	return &balancedClient{
+		balancer:  balancer,
+		url:       parsed,
+		newClient: newClient,
+		clients:   make(map[string]*endpointClient),
+	}, nil
+}
+
+// pick chooses an endpoint for a call. Callers must call the returned
+// function with the call's result.
+func (c *balancedClient) pick(ctx context.Context, header http.Header) (*endpointClient, func(error), error) {
+	endpoint, err := c.balancer.pick(ctx, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	done := func(err error) { c.balancer.done(endpoint, err) }
+	client, err := c.clientFor(endpoint.addr)
+	if err != nil {
+		done(err)
+		return nil, nil, err
+	}
+	return client, done, nil
+}
+
+func (c *balancedClient) clientFor(addr string) (*endpointClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if addrs, generation := c.balancer.addrsSince(c.generation); addrs != nil {
+		for known := range c.clients {
+			if _, ok := addrs[known]; !ok {
+				delete(c.clients, known)
+			}
+		}
+		c.generation = generation
+	}
+	if client, ok := c.clients[addr]; ok {
+		return client, nil
+	}
+	endpointURL := *c.url
+	endpointURL.Host = addr
+	client, err := c.newClient(endpointURL.String())
+	if err != nil {
+		return nil, err
+	}
+	c.clients[addr] = client
+	return client, nil
+}
+
+// newConn opens a stream to the chosen endpoint, reporting the stream's
+// outcome to the balancer when the response is closed.
+func (c *balancedClient) newConn(ctx context.Context, spec Spec, newConn func(*endpointClient) StreamingClientConn) StreamingClientConn {
+	client, done, err := c.pick(ctx, nil)
+	if err != nil {
+		return &errorClientConn{spec: spec, err: err, header: make(http.Header)}
+	}
+	return &reportingClientConn{StreamingClientConn: newConn(client), report: done}
+}
@@ -0,0 +1,403 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestBalancer(t *testing.T) {
+	t.Parallel()
+	// The host in the client's URL is replaced by the chosen endpoint.
+	const target = "http://ping.invalid"
+	t.Run("round_robin", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 3)
+		balancer := connect.NewBalancer(connect.NewStaticResolver(servers.addrs()...), connect.RoundRobin())
+		t.Cleanup(balancer.Close)
+		var peers peerRecorder
+		client := pingv1connect_test.NewPingServiceClient(
+			http.DefaultClient,
+			target,
+			connect.WithBalancer(balancer),
+			connect.WithInterceptors(&peers),
+		)
+		for i := 0; i < 6; i++ {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+			assert.Nil(t, err)
+		}
+		for _, server := range servers {
+			assert.Equal(t, server.hits(), 2)
+		}
+		addrs := servers.addrs()
+		assert.Equal(t, peers.addrs(), append(addrs, addrs...))
+	})
+	t.Run("pick_first", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 2)
+		balancer := connect.NewBalancer(connect.NewStaticResolver(servers.addrs()...), nil /* picker */)
+		t.Cleanup(balancer.Close)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, target, connect.WithBalancer(balancer))
+		for i := 0; i < 3; i++ {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, servers[0].hits(), 3)
+		assert.Equal(t, servers[1].hits(), 0)
+	})
+	t.Run("least_outstanding", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 2)
+		release := make(chan struct{})
+		servers[0].block = release
+		balancer := connect.NewBalancer(connect.NewStaticResolver(servers.addrs()...), connect.LeastOutstanding())
+		t.Cleanup(balancer.Close)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, target, connect.WithBalancer(balancer))
+		// The first call goes to the first server and stalls there, so the
+		// following calls go to the second.
+		blocked := make(chan error, 1)
+		go func() {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+			blocked <- err
+		}()
+		servers[0].waitForHits(t, 1)
+		for i := 0; i < 3; i++ {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, servers[1].hits(), 3)
+		close(release)
+		assert.Nil(t, <-blocked)
+		assert.Equal(t, servers[0].hits(), 1)
+	})
+	t.Run("consistent_hash", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 4)
+		balancer := connect.NewBalancer(connect.NewStaticResolver(servers.addrs()...), connect.ConsistentHash("Tenant"))
+		t.Cleanup(balancer.Close)
+		var peers peerRecorder
+		client := pingv1connect_test.NewPingServiceClient(
+			http.DefaultClient,
+			target,
+			connect.WithBalancer(balancer),
+			connect.WithInterceptors(&peers),
+		)
+		for _, tenant := range []string{"alpha", "beta", "gamma"} {
+			for i := 0; i < 3; i++ {
+				request := connect.NewRequest(&pingv1_test.PingRequest{})
+				request.Header().Set("Tenant", tenant)
+				_, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+			}
+			addrs := peers.reset()
+			assert.Equal(t, len(addrs), 3)
+			assert.Equal(t, addrs[1], addrs[0])
+			assert.Equal(t, addrs[2], addrs[0])
+		}
+	})
+	t.Run("ejection", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 2)
+		servers[0].setErr(connect.NewError(connect.CodeUnavailable, errors.New("draining")))
+		balancer := connect.NewBalancer(
+			connect.NewStaticResolver(servers.addrs()...),
+			connect.RoundRobin(),
+			connect.WithEjection(2, time.Minute),
+		)
+		t.Cleanup(balancer.Close)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, target, connect.WithBalancer(balancer))
+		var failures int
+		for i := 0; i < 10; i++ {
+			if _, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{})); err != nil {
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+				failures++
+			}
+		}
+		assert.Equal(t, failures, 2)
+		assert.Equal(t, servers[0].hits(), 2)
+		assert.Equal(t, servers[1].hits(), 8)
+	})
+	t.Run("resolver_updates", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 2)
+		resolver := newFakeResolver()
+		balancer := connect.NewBalancer(resolver, connect.RoundRobin())
+		t.Cleanup(balancer.Close)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, target, connect.WithBalancer(balancer))
+		// Calls wait for the first resolution.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+
+		resolver.set(servers[0].addr())
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Nil(t, err)
+		resolver.set(servers[1].addr())
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, servers[0].hits(), 1)
+		assert.Equal(t, servers[1].hits(), 1)
+
+		resolver.set()
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	})
+	t.Run("streams", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 2)
+		balancer := connect.NewBalancer(connect.NewStaticResolver(servers.addrs()...), connect.RoundRobin())
+		t.Cleanup(balancer.Close)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, target, connect.WithBalancer(balancer))
+		for _, server := range servers {
+			stream := client.Sum(context.Background())
+			assert.Equal(t, stream.Peer().Addr, server.addr())
+			assert.Nil(t, stream.Send(&pingv1_test.SumRequest{Number: 1}))
+			response, err := stream.CloseAndReceive()
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Sum, 1)
+			assert.Equal(t, server.hits(), 1)
+		}
+	})
+}
+
+func TestFileResolver(t *testing.T) {
+	t.Parallel()
+	servers := newBalancerPingServers(t, 2)
+	path := filepath.Join(t.TempDir(), "endpoints")
+	writeEndpoints := func(addrs ...string) {
+		t.Helper()
+		contents := "# ping endpoints\n\n" + strings.Join(addrs, "\n") + "\n"
+		assert.Nil(t, os.WriteFile(path, []byte(contents), 0600))
+	}
+	writeEndpoints(servers[0].addr())
+	balancer := connect.NewBalancer(connect.NewFileResolver(path, time.Millisecond), connect.RoundRobin())
+	t.Cleanup(balancer.Close)
+	var peers peerRecorder
+	client := pingv1connect_test.NewPingServiceClient(
+		http.DefaultClient,
+		"http://ping.invalid",
+		connect.WithBalancer(balancer),
+		connect.WithInterceptors(&peers),
+	)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, peers.reset(), []string{servers[0].addr()})
+
+	writeEndpoints(servers[1].addr())
+	deadline := time.Now().Add(5 * time.Second)
+	for servers[1].hits() == 0 && time.Now().Before(deadline) {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Nil(t, err)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, servers[1].hits(), 1)
+
+	// An empty file keeps the last good endpoints.
+	writeEndpoints()
+	time.Sleep(10 * time.Millisecond) // let the resolver reload the file
+	peers.reset()
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, peers.reset(), []string{servers[1].addr()})
+}
+
+func TestFileResolverMissingFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "endpoints")
+	balancer := connect.NewBalancer(connect.NewFileResolver(path, time.Hour), connect.RoundRobin())
+	t.Cleanup(balancer.Close)
+	client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, "http://ping.invalid", connect.WithBalancer(balancer))
+	// Calls fail with the lookup error, rather than wait for endpoints that
+	// may never resolve.
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+type balancerPingServer struct {
+	*httptest.Server
+
+	block <-chan struct{} // if non-nil, calls wait for it to close
+
+	mu    sync.Mutex
+	count int
+	err   error // if non-nil, calls fail
+}
+
+func (s *balancerPingServer) addr() string {
+	return s.Listener.Addr().String()
+}
+
+func (s *balancerPingServer) hits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func (s *balancerPingServer) hit() error {
+	s.mu.Lock()
+	s.count++
+	err := s.err
+	s.mu.Unlock()
+	if s.block != nil {
+		<-s.block
+	}
+	return err
+}
+
+func (s *balancerPingServer) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *balancerPingServer) waitForHits(tb testing.TB, hits int) {
+	tb.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.hits() < hits {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timed out waiting for %d hits", hits)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type balancerPingServers []*balancerPingServer
+
+func newBalancerPingServers(tb testing.TB, count int) balancerPingServers {
+	tb.Helper()
+	servers := make(balancerPingServers, count)
+	for i := range servers {
+		server := &balancerPingServer{}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect_test.NewPingServiceHandler(&pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				if err := server.hit(); err != nil {
+					return nil, err
+				}
+				return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+			},
+			sum: func(ctx context.Context, stream *connect.ClientStream[pingv1_test.SumRequest]) (*connect.Response[pingv1_test.SumResponse], error) {
+				if err := server.hit(); err != nil {
+					return nil, err
+				}
+				var sum int64
+				for stream.Receive() {
+					sum += stream.Msg().Number
+				}
+				if err := stream.Err(); err != nil {
+					return nil, err
+				}
+				return connect.NewResponse(&pingv1_test.SumResponse{Sum: sum}), nil
+			},
+		}))
+		server.Server = httptest.NewServer(mux)
+		tb.Cleanup(server.Close)
+		servers[i] = server
+	}
+	return servers
+}
+
+func (s balancerPingServers) addrs() []string {
+	addrs := make([]string, len(s))
+	for i, server := range s {
+		addrs[i] = server.addr()
+	}
+	return addrs
+}
+
+// fakeResolver is a connect.Resolver controlled by the test.
+type fakeResolver struct {
+	updates chan []string
+	applied chan struct{}
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		updates: make(chan []string),
+		applied: make(chan struct{}),
+	}
+}
+
+func (r *fakeResolver) Resolve(ctx context.Context, update func([]string, error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case addrs := <-r.updates:
+			update(addrs, nil)
+			r.applied <- struct{}{}
+		}
+	}
+}
+
+// set updates the resolved addresses, returning once the balancer has
+// applied them.
+func (r *fakeResolver) set(addrs ...string) {
+	r.updates <- addrs
+	<-r.applied
+}
+
+// peerRecorder is an interceptor that records the Peer.Addr of unary calls.
+type peerRecorder struct {
+	mu    sync.Mutex
+	peers []string
+}
+
+func (r *peerRecorder) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+		r.mu.Lock()
+		r.peers = append(r.peers, request.Peer().Addr)
+		r.mu.Unlock()
+		return next(ctx, request)
+	}
+}
+
+func (r *peerRecorder) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (r *peerRecorder) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+func (r *peerRecorder) addrs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.peers...)
+}
+
+func (r *peerRecorder) reset() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peers := r.peers
+	r.peers = nil
+	return peers
+}
@@ -0,0 +1,89 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/joshcarp/connect-no/internal/assert"
+)
+
+func TestBalancedClientPrunesEndpoints(t *testing.T) {
+	t.Parallel()
+	resolver := &manualResolver{updates: make(chan func([]string, error), 1)}
+	balancer := NewBalancer(resolver, RoundRobin())
+	t.Cleanup(balancer.Close)
+	update := <-resolver.updates
+	client, err := newBalancedClient(balancer, "http://example.com", func(url string) (*endpointClient, error) {
+		return &endpointClient{url: url}, nil
+	})
+	assert.Nil(t, err)
+	knownAddrs := func() []string {
+		// Each pick prunes first, so pick enough to use every endpoint.
+		for i := 0; i < 2; i++ {
+			_, done, err := client.pick(context.Background(), nil)
+			assert.Nil(t, err)
+			done(nil)
+		}
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		var addrs []string
+		for addr := range client.clients {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		return addrs
+	}
+
+	update([]string{"a:80", "b:80"}, nil)
+	assert.Equal(t, knownAddrs(), []string{"a:80", "b:80"})
+	update([]string{"b:80", "c:80"}, nil)
+	assert.Equal(t, knownAddrs(), []string{"b:80", "c:80"})
+}
+
+func TestEndpointClientCachesDerivedClients(t *testing.T) {
+	t.Parallel()
+	var derivations int
+	endpoint := &endpointClient{
+		url: "http://example.com",
+		newDerived: func(callProtocolOptions) (*endpointClient, error) {
+			derivations++
+			return &endpointClient{url: "http://example.com"}, nil
+		},
+	}
+	same, err := endpoint.forCall(&callConfig{Timeout: time.Second})
+	assert.Nil(t, err)
+	assert.True(t, same == endpoint)
+	limit := 1024
+	first, err := endpoint.forCall(&callConfig{ReadMaxBytes: &limit})
+	assert.Nil(t, err)
+	assert.False(t, first == endpoint)
+	second, err := endpoint.forCall(&callConfig{ReadMaxBytes: &limit})
+	assert.Nil(t, err)
+	assert.True(t, first == second)
+	assert.Equal(t, derivations, 1)
+}
+
+// manualResolver hands its update function to the test.
+type manualResolver struct {
+	updates chan func([]string, error)
+}
+
+func (r *manualResolver) Resolve(_ context.Context, update func([]string, error)) {
+	r.updates <- update
+}
@@ -0,0 +1,380 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerCacheControl = "Cache-Control"
+	headerETag         = "Etag"
+	headerIfNoneMatch  = "If-None-Match"
+	headerVary         = "Vary"
+	// headerNotModified marks a response to a successful revalidation. It plays
+	// the role of HTTP's 304 status, which none of the RPC protocols have: the
+	// response message is empty, and the client should use its cached copy.
+	headerNotModified = "Not-Modified"
+
+	defaultResponseCacheSize = 1024
+)
+
+// A ResponseCache stores responses to unary calls for clients. See
+// [WithResponseCache].
+//
+// Keys are opaque and may contain arbitrary bytes. Implementations must be
+// safe to call concurrently, and must not modify the responses they store;
+// clients never modify them either.
+type ResponseCache interface {
+	// Get returns the response stored under key, if any. It may return
+	// responses that have expired: clients use them to revalidate.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores a response under key, replacing any previous response.
+	Set(key string, response *CachedResponse)
+}
+
+// CachedResponse is a response stored in a [ResponseCache].
+type CachedResponse struct {
+	// Message is the response message, marshaled with the client's codec.
+	Message []byte
+	Header  http.Header
+	Trailer http.Header
+	// ETag is the entity tag the server sent with the response, if any. It's
+	// used to revalidate the response once it expires.
+	ETag string
+	// Expires is the time after which the response must be revalidated.
+	Expires time.Time
+}
+
+// NewLRUResponseCache constructs an in-memory [ResponseCache] that holds up
+// to size responses, evicting the least recently used response when it's
+// full. If size isn't positive, the cache holds 1024 responses.
+func NewLRUResponseCache(size int) ResponseCache {
+	if size <= 0 {
+		size = defaultResponseCacheSize
+	}
+	return &lruResponseCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+type lruResponseCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // values are *lruEntry
+	order   *list.List               // most recently used first
+}
+
+type lruEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+func (c *lruResponseCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).response, true //nolint:forcetypeassert
+}
+
+func (c *lruResponseCache) Set(key string, response *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).response = response //nolint:forcetypeassert
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, response: response})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key) //nolint:forcetypeassert
+	}
+}
+
+// responseCacher serves a client's unary calls from a ResponseCache.
+type responseCacher[Req, Res any] struct {
+	cache      ResponseCache
+	codec      stableCodec
+	prefix     string // identifies the codec and procedure
+	vary       []string
+	initialize func(any) error // prepares response messages
+}
+
+func newResponseCacher[Req, Res any](config *clientConfig) *responseCacher[Req, Res] {
+	vary := make([]string, len(config.ResponseCacheVary))
+	for i, name := range config.ResponseCacheVary {
+		vary[i] = http.CanonicalHeaderKey(name)
+	}
+	return &responseCacher[Req, Res]{
+		cache:      config.ResponseCache,
+		codec:      config.Codec.(stableCodec), //nolint:forcetypeassert // checked by validate
+		prefix:     config.Codec.Name() + "\x00" + config.Procedure + "\x00",
+		vary:       vary,
+		initialize: config.unaryResponseInitializer(),
+	}
+}
+
+// call returns a fresh cached response if there is one. Otherwise, it calls
+// callUnary, revalidating the expired response if it has an entity tag, and
+// caches the result if the server allows it.
+func (c *responseCacher[Req, Res]) call(
+	ctx context.Context,
+	request *Request[Req],
+	callUnary func(context.Context, *Request[Req]) (*Response[Res], error),
+) (*Response[Res], error) {
+	key, err := c.key(request)
+	if err != nil {
+		return callUnary(ctx, request)
+	}
+	cached, ok := c.cache.Get(key)
+	if ok && time.Now().Before(cached.Expires) {
+		return c.response(cached)
+	}
+	if ok && cached.ETag != "" {
+		// Don't modify the caller's headers.
+		revalidation := *request
+		revalidation.header = request.Header().Clone()
+		revalidation.header.Set(headerIfNoneMatch, cached.ETag)
+		request = &revalidation
+	} else {
+		cached = nil
+	}
+	response, err := callUnary(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && response.Header().Get(headerNotModified) != "" {
+		refreshed := *cached
+		refreshed.Expires = time.Now().Add(parseCacheControl(response.Header()).maxAge)
+		c.cache.Set(key, &refreshed)
+		return c.response(&refreshed)
+	}
+	if response.Header().Get(headerNotModified) != "" {
+		// The caller revalidated a response of its own, so the empty message
+		// isn't worth caching.
+		return response, nil
+	}
+	c.store(key, response)
+	return response, nil
+}
+
+// store caches a response, unless the server forbids it or didn't say how
+// long the response is fresh or how to revalidate it.
+func (c *responseCacher[Req, Res]) store(key string, response *Response[Res]) {
+	control := parseCacheControl(response.Header())
+	etag := response.Header().Get(headerETag)
+	if control.noStore || (!control.hasMaxAge && etag == "") {
+		return
+	}
+	data, err := c.codec.Marshal(response.Msg)
+	if err != nil {
+		return
+	}
+	c.cache.Set(key, &CachedResponse{
+		Message: data,
+		Header:  response.Header().Clone(),
+		Trailer: response.Trailer().Clone(),
+		ETag:    etag,
+		Expires: time.Now().Add(control.maxAge),
+	})
+}
+
+// response returns a copy of a cached response.
+func (c *responseCacher[Req, Res]) response(cached *CachedResponse) (*Response[Res], error) {
+	var msg Res
+	if err := c.initialize(&msg); err != nil {
+		return nil, NewError(CodeInternal, err)
+	}
+	if err := c.codec.Unmarshal(cached.Message, &msg); err != nil {
+		return nil, errorf(CodeInternal, "unmarshal cached response: %w", err)
+	}
+	return &Response[Res]{
+		Msg:     &msg,
+		header:  cached.Header.Clone(),
+		trailer: cached.Trailer.Clone(),
+	}, nil
+}
+
+// key identifies a response by codec, procedure, request message, and the
+// values of the vary headers.
+func (c *responseCacher[Req, Res]) key(request *Request[Req]) (string, error) {
+	data, err := c.codec.MarshalStable(request.Msg)
+	if err != nil {
+		return "", err
+	}
+	var key strings.Builder
+	key.WriteString(c.prefix)
+	key.WriteString(strconv.Itoa(len(data)))
+	key.WriteByte(':')
+	key.Write(data)
+	for _, name := range c.vary {
+		key.WriteByte(0)
+		for _, value := range request.Header()[name] {
+			key.WriteByte(0)
+			key.WriteString(value)
+		}
+	}
+	return key.String(), nil
+}
+
+// newCachingUnaryFunc wraps a handler's unary implementation to set cache
+// headers on its responses and to answer revalidations. If the request's
+// If-None-Match header matches the entity tag, the response has an empty
+// message and the Not-Modified header, and shared caches may not store it.
+// When the handler has an ETag function, matching requests don't run the
+// implementation at all.
+func newCachingUnaryFunc[Res any](config *handlerConfig, next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		ifNoneMatch := request.Header().Get(headerIfNoneMatch)
+		var etag string
+		if config.ETag != nil {
+			var err error
+			if etag, err = config.ETag(ctx, request); err != nil {
+				return nil, err
+			}
+			if etagMatches(ifNoneMatch, etag) {
+				msg, err := newEmptyResponse[Res](config, request.Spec())
+				if err != nil {
+					return nil, err
+				}
+				response := &Response[Res]{Msg: msg}
+				config.setCacheHeaders(response.Header(), etag)
+				markNotModified(response.Header())
+				return response, nil
+			}
+		}
+		response, err := next(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		config.setCacheHeaders(response.Header(), etag)
+		if etagMatches(ifNoneMatch, response.Header().Get(headerETag)) {
+			msg, err := newEmptyResponse[Res](config, request.Spec())
+			if err != nil {
+				return nil, err
+			}
+			notModified := &Response[Res]{
+				Msg:     msg,
+				header:  response.Header(),
+				trailer: response.Trailer(),
+			}
+			markNotModified(notModified.Header())
+			return notModified, nil
+		}
+		return response, nil
+	}
+}
+
+// newEmptyResponse constructs the empty message sent with not-modified
+// responses.
+func newEmptyResponse[Res any](config *handlerConfig, spec Spec) (*Res, error) {
+	msg := new(Res)
+	if err := config.initializeResponse(spec, msg); err != nil {
+		return nil, NewError(CodeInternal, err)
+	}
+	return msg, nil
+}
+
+// setCacheHeaders sets the entity tag and Cache-Control headers, unless the
+// implementation has already set them.
+func (c *handlerConfig) setCacheHeaders(header http.Header, etag string) {
+	if etag != "" && header.Get(headerETag) == "" {
+		header.Set(headerETag, etag)
+	}
+	if c.CacheMaxAge > 0 && header.Get(headerCacheControl) == "" {
+		header.Set(headerCacheControl, "max-age="+strconv.Itoa(int(c.CacheMaxAge/time.Second)))
+	}
+}
+
+// markNotModified marks a response to a successful revalidation. Its empty
+// message is only meaningful to the client that sent If-None-Match, so it
+// varies on that header and shared caches (like CDNs, for GET requests) must
+// not store it. The sender's private cache still learns how long its copy is
+// fresh.
+func markNotModified(header http.Header) {
+	header.Set(headerNotModified, "1")
+	header.Add(headerVary, headerIfNoneMatch)
+	control := parseCacheControl(header)
+	switch {
+	case control.noStore:
+		header.Set(headerCacheControl, "no-store")
+	case control.hasMaxAge:
+		header.Set(headerCacheControl, "private, max-age="+strconv.Itoa(int(control.maxAge/time.Second)))
+	default:
+		header.Set(headerCacheControl, "private")
+	}
+}
+
+// etagMatches reports whether an If-None-Match header value matches an entity
+// tag, using the weak comparison of RFC 9110.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+type cacheControl struct {
+	noStore   bool
+	hasMaxAge bool
+	maxAge    time.Duration
+}
+
+// parseCacheControl parses the Cache-Control directives that matter to
+// clients. A no-cache directive is treated as a max-age of zero, so the
+// response is revalidated every time it's used.
+func parseCacheControl(header http.Header) cacheControl {
+	var control cacheControl
+	for _, value := range header.Values(headerCacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(name) {
+			case "no-store":
+				control.noStore = true
+			case "no-cache":
+				control.hasMaxAge, control.maxAge = true, 0
+			case "max-age":
+				seconds, err := strconv.Atoi(strings.Trim(arg, `"`))
+				if err != nil || seconds < 0 || control.hasMaxAge {
+					continue
+				}
+				control.hasMaxAge, control.maxAge = true, time.Duration(seconds)*time.Second
+			}
+		}
+	}
+	return control
+}
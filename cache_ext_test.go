@@ -0,0 +1,211 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestResponseCache(t *testing.T) {
+	t.Parallel()
+	ping := func(t *testing.T, client pingv1connect_test.PingServiceClient, number int64, tenant string) *connect.Response[pingv1_test.PingResponse] {
+		t.Helper()
+		request := connect.NewRequest(&pingv1_test.PingRequest{Number: number})
+		if tenant != "" {
+			request.Header().Set("Tenant", tenant)
+		}
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, number)
+		return response
+	}
+	// newServer starts a server whose Ping procedure counts its calls in calls
+	// and adds header to its responses.
+	newServer := func(t *testing.T, calls *atomic.Int64, header http.Header, options ...connect.HandlerOption) *httptest.Server {
+		t.Helper()
+		return newPingServer(t, &pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				calls.Add(1)
+				response := connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number})
+				for key, values := range header {
+					response.Header()[key] = values
+				}
+				return response, nil
+			},
+		}, options...)
+	}
+	t.Run("max_age", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int64
+		server := newServer(t, &calls, nil, connect.WithCacheMaxAge(time.Minute))
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(nil))
+		first := ping(t, client, 1, "")
+		assert.Equal(t, first.Header().Get("Cache-Control"), "max-age=60")
+		second := ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), int64(1))
+		// Each caller has a copy of its own.
+		second.Msg.Number = 0
+		assert.Equal(t, ping(t, client, 1, "").Msg.Number, 1)
+		ping(t, client, 2, "")
+		assert.Equal(t, calls.Load(), int64(2))
+	})
+	t.Run("revalidation", func(t *testing.T) {
+		t.Parallel()
+		var version atomic.Int64
+		var calls atomic.Int64
+		server := newServer(t, &calls, nil, connect.WithETag(func(context.Context, connect.AnyRequest) (string, error) {
+			return strconv.Quote(strconv.FormatInt(version.Load(), 10)), nil
+		}))
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(nil))
+		first := ping(t, client, 1, "")
+		assert.Equal(t, first.Header().Get("Etag"), `"0"`)
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), int64(1))
+		version.Add(1)
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), int64(2))
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), int64(2))
+	})
+	t.Run("implementation_etag", func(t *testing.T) {
+		t.Parallel()
+		header := http.Header{"Etag": []string{`"static"`}}
+		var calls, notModified atomic.Int64
+		server := newServer(t, &calls, header, connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				response, err := next(ctx, request)
+				if err == nil && response.Header().Get("Not-Modified") != "" {
+					notModified.Add(1)
+				}
+				return response, err
+			}
+		})))
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(nil))
+		ping(t, client, 1, "")
+		ping(t, client, 1, "")
+		// The implementation runs to compute the tag, but the response is
+		// still served from the cache.
+		assert.Equal(t, calls.Load(), int64(2))
+		assert.Equal(t, notModified.Load(), int64(1))
+	})
+	t.Run("not_modified_headers", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int64
+		server := newServer(
+			t,
+			&calls,
+			nil,
+			connect.WithCacheMaxAge(time.Minute),
+			connect.WithETag(func(context.Context, connect.AnyRequest) (string, error) {
+				return `"v1"`, nil
+			}),
+		)
+		// Without a cache of its own, the client sees the raw not-modified reply.
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHTTPGet())
+		request := connect.NewRequest(&pingv1_test.PingRequest{Number: 1})
+		request.Header().Set("If-None-Match", `"v1"`)
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Get("Not-Modified"), "1")
+		assert.Equal(t, response.Header().Get("Cache-Control"), "private, max-age=60")
+		assert.Equal(t, response.Header().Values("Vary"), []string{"If-None-Match"})
+		// Full responses stay cacheable by shared caches.
+		response, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Get("Not-Modified"), "")
+		assert.Equal(t, response.Header().Get("Cache-Control"), "max-age=60")
+	})
+	t.Run("caller_revalidation", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int64
+		server := newServer(
+			t,
+			&calls,
+			nil,
+			connect.WithCacheMaxAge(time.Minute),
+			connect.WithETag(func(context.Context, connect.AnyRequest) (string, error) {
+				return `"v1"`, nil
+			}),
+		)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(nil))
+		request := connect.NewRequest(&pingv1_test.PingRequest{Number: 1})
+		request.Header().Set("If-None-Match", `"v1"`)
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Get("Not-Modified"), "1")
+		assert.Equal(t, calls.Load(), int64(0))
+		// The empty not-modified reply isn't cached for later callers.
+		ping(t, client, 1, "")
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), int64(1))
+	})
+	t.Run("vary", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int64
+		server := newServer(t, &calls, nil, connect.WithCacheMaxAge(time.Minute))
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(nil, "Tenant"))
+		ping(t, client, 1, "a")
+		ping(t, client, 1, "a")
+		ping(t, client, 1, "b")
+		assert.Equal(t, calls.Load(), int64(2))
+	})
+	t.Run("no_store", func(t *testing.T) {
+		t.Parallel()
+		header := http.Header{"Cache-Control": []string{"no-store"}}
+		var calls atomic.Int64
+		server := newServer(t, &calls, header, connect.WithCacheMaxAge(time.Minute))
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(nil))
+		ping(t, client, 1, "")
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), int64(2))
+	})
+	t.Run("eviction", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int64
+		server := newServer(t, &calls, nil, connect.WithCacheMaxAge(time.Minute))
+		cache := connect.NewLRUResponseCache(1)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(cache))
+		ping(t, client, 1, "")
+		ping(t, client, 2, "")
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), int64(3))
+	})
+	t.Run("call_options", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int64
+		server := newServer(t, &calls, nil, connect.WithCacheMaxAge(time.Minute))
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(nil))
+		for i := 0; i < 2; i++ {
+			_, err := client.Ping(
+				context.Background(),
+				connect.NewRequest(&pingv1_test.PingRequest{}),
+				connect.WithCallTimeout(time.Minute),
+			)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, calls.Load(), int64(2))
+	})
+}
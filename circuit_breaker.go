@@ -0,0 +1,316 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitWindowSize     = 100
+	defaultCircuitMinimumCalls   = 20
+	defaultCircuitFailureRatio   = 0.5
+	defaultCircuitCoolDown       = 30 * time.Second
+	defaultCircuitHalfOpenProbes = 3
+)
+
+// CircuitState is the state of a circuit tracked by a [CircuitBreaker].
+type CircuitState int
+
+const (
+	// CircuitClosed is the normal state: calls go through, and their outcomes
+	// are recorded.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means that too many recent calls have failed. Calls fail
+	// immediately with [CodeUnavailable] until the cool-down has passed.
+	CircuitOpen
+	// CircuitHalfOpen means that the cool-down has passed, and a few probe
+	// calls are allowed through to test whether the server has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return fmt.Sprintf("circuit_state_%d", s)
+}
+
+// CircuitBreakerScope controls what each circuit of a [CircuitBreaker] covers.
+type CircuitBreakerScope int
+
+const (
+	// CircuitPerProcedure tracks a circuit for each procedure.
+	CircuitPerProcedure CircuitBreakerScope = iota
+	// CircuitPerEndpoint tracks a circuit for each server address, as reported
+	// by [Peer.Addr]. Combined with [WithBalancer], a failing endpoint trips
+	// its own circuit without affecting the others.
+	CircuitPerEndpoint
+)
+
+// CircuitBreakerPolicy configures a [CircuitBreaker]. The zero value uses the
+// defaults described on each field.
+type CircuitBreakerPolicy struct {
+	// Scope selects what each circuit covers. It defaults to
+	// CircuitPerProcedure.
+	Scope CircuitBreakerScope
+	// WindowSize is the number of recent calls whose codes are tracked. It
+	// defaults to 100.
+	WindowSize int
+	// MinimumCalls is the number of calls that must be in the window before the
+	// circuit can open. It defaults to 20, and is capped at WindowSize.
+	MinimumCalls int
+	// FailureRatio is the fraction of failed calls in the window that opens
+	// the circuit. It defaults to 0.5.
+	FailureRatio float64
+	// FailureCodes are the codes that count as failures. They default to
+	// [CodeUnavailable], [CodeDeadlineExceeded], and [CodeInternal]. Calls that
+	// end with [CodeCanceled] don't count at all, unless it's one of the failure
+	// codes: a caller giving up says nothing about the server. All other
+	// outcomes, including success, count as successes.
+	FailureCodes []Code
+	// CoolDown is how long the circuit stays open before letting probe calls
+	// through. It defaults to 30 seconds.
+	CoolDown time.Duration
+	// HalfOpenProbes is the number of probe calls allowed through a half-open
+	// circuit. If they all succeed, the circuit closes; if any fails, it opens
+	// again. If the probes' outcomes still aren't known a CoolDown after the
+	// last one started, the breaker lets a fresh set of probes through. It
+	// defaults to 3.
+	HalfOpenProbes int
+	// OnStateChange, if non-nil, is called whenever a circuit changes state.
+	// The key is the procedure or endpoint address, depending on Scope. It's
+	// called synchronously, after the breaker releases its lock, so it must be
+	// safe to call concurrently.
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+// A CircuitBreaker stops calls to failing procedures or endpoints, giving
+// them a chance to recover. It tracks the codes of recent calls in a sliding
+// window; once the ratio of failures in the window crosses a threshold, the
+// circuit opens and calls fail with [CodeUnavailable] without doing any I/O.
+// After a cool-down, the circuit is half-open and lets a few probe calls
+// through to decide whether to close again.
+//
+// Breakers are safe to use concurrently, and are meant to be shared between
+// the clients that call a service; see [WithCircuitBreaker].
+type CircuitBreaker struct {
+	policy       CircuitBreakerPolicy
+	failureCodes map[Code]struct{}
+
+	mu       sync.Mutex
+	circuits map[string]*breakerCircuit
+}
+
+// NewCircuitBreaker constructs a [CircuitBreaker].
+func NewCircuitBreaker(policy CircuitBreakerPolicy) *CircuitBreaker {
+	if policy.WindowSize <= 0 {
+		policy.WindowSize = defaultCircuitWindowSize
+	}
+	if policy.MinimumCalls <= 0 {
+		policy.MinimumCalls = defaultCircuitMinimumCalls
+	}
+	if policy.MinimumCalls > policy.WindowSize {
+		policy.MinimumCalls = policy.WindowSize
+	}
+	if policy.FailureRatio <= 0 {
+		policy.FailureRatio = defaultCircuitFailureRatio
+	}
+	if policy.CoolDown <= 0 {
+		policy.CoolDown = defaultCircuitCoolDown
+	}
+	if policy.HalfOpenProbes <= 0 {
+		policy.HalfOpenProbes = defaultCircuitHalfOpenProbes
+	}
+	codes := policy.FailureCodes
+	if len(codes) == 0 {
+		codes = []Code{CodeUnavailable, CodeDeadlineExceeded, CodeInternal}
+	}
+	failureCodes := make(map[Code]struct{}, len(codes))
+	for _, code := range codes {
+		failureCodes[code] = struct{}{}
+	}
+	return &CircuitBreaker{
+		policy:       policy,
+		failureCodes: failureCodes,
+		circuits:     make(map[string]*breakerCircuit),
+	}
+}
+
+// State returns the current state of the circuit for a procedure or endpoint
+// address.
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if circuit, ok := b.circuits[key]; ok {
+		if circuit.state == CircuitOpen && b.coolDownOver(circuit) {
+			// The next call would be a probe.
+			return CircuitHalfOpen
+		}
+		return circuit.state
+	}
+	return CircuitClosed
+}
+
+// key returns the circuit key for a call.
+func (b *CircuitBreaker) key(procedure, addr string) string {
+	if b.policy.Scope == CircuitPerEndpoint {
+		return addr
+	}
+	return procedure
+}
+
+// allow reports whether a call may proceed. If so, the caller must pass the
+// call's result to the returned function.
+func (b *CircuitBreaker) allow(key string) (func(error), error) {
+	b.mu.Lock()
+	circuit, ok := b.circuits[key]
+	if !ok {
+		circuit = &breakerCircuit{window: make([]bool, b.policy.WindowSize)}
+		b.circuits[key] = circuit
+	}
+	from := circuit.state
+	if circuit.state == CircuitOpen && b.coolDownOver(circuit) {
+		circuit.reset(CircuitHalfOpen)
+	}
+	allowed := true
+	switch circuit.state {
+	case CircuitOpen:
+		allowed = false
+	case CircuitHalfOpen:
+		if circuit.probes >= b.policy.HalfOpenProbes && time.Now().Sub(circuit.probedAt) >= b.policy.CoolDown {
+			// The probes are stuck or were abandoned without reporting their
+			// outcomes. Start over, ignoring any outcomes that arrive late.
+			circuit.reset(CircuitHalfOpen)
+		}
+		if circuit.probes >= b.policy.HalfOpenProbes {
+			allowed = false
+		} else {
+			circuit.probes++
+			circuit.probedAt = time.Now()
+		}
+	case CircuitClosed:
+	}
+	generation, to := circuit.generation, circuit.state
+	b.mu.Unlock()
+	b.notify(key, from, to)
+	if !allowed {
+		return nil, errorf(CodeUnavailable, "circuit breaker for %s is %v", key, to)
+	}
+	return func(err error) { b.record(key, circuit, generation, err) }, nil
+}
+
+// record adds the outcome of a call to the circuit, unless the circuit has
+// changed state since the call started.
+func (b *CircuitBreaker) record(key string, circuit *breakerCircuit, generation uint64, err error) {
+	_, failed := b.failureCodes[CodeOf(err)]
+	failed = failed && err != nil
+	canceled := err != nil && !failed && CodeOf(err) == CodeCanceled
+	b.mu.Lock()
+	if circuit.generation != generation {
+		b.mu.Unlock()
+		return
+	}
+	from := circuit.state
+	switch circuit.state {
+	case CircuitClosed:
+		if canceled {
+			break
+		}
+		circuit.add(failed)
+		if circuit.calls >= b.policy.MinimumCalls &&
+			float64(circuit.failures) >= b.policy.FailureRatio*float64(circuit.calls) {
+			circuit.reset(CircuitOpen)
+			circuit.openedAt = time.Now()
+		}
+	case CircuitHalfOpen:
+		if canceled {
+			// Let another call probe in its place.
+			circuit.probes--
+			break
+		}
+		if failed {
+			circuit.reset(CircuitOpen)
+			circuit.openedAt = time.Now()
+			break
+		}
+		circuit.successes++
+		if circuit.successes >= b.policy.HalfOpenProbes {
+			circuit.reset(CircuitClosed)
+		}
+	case CircuitOpen:
+	}
+	to := circuit.state
+	b.mu.Unlock()
+	b.notify(key, from, to)
+}
+
+func (b *CircuitBreaker) coolDownOver(circuit *breakerCircuit) bool {
+	return time.Now().Sub(circuit.openedAt) >= b.policy.CoolDown
+}
+
+func (b *CircuitBreaker) notify(key string, from, to CircuitState) {
+	if from != to && b.policy.OnStateChange != nil {
+		b.policy.OnStateChange(key, from, to)
+	}
+}
+
+// breakerCircuit is the state of a single procedure or endpoint.
+type breakerCircuit struct {
+	state      CircuitState
+	generation uint64 // incremented on every state change
+	openedAt   time.Time
+
+	// While closed, a ring buffer of recent outcomes (true means failure).
+	window   []bool
+	next     int
+	calls    int
+	failures int
+
+	// While half-open, the number of probes allowed and succeeded, and when
+	// the latest probe was allowed.
+	probes    int
+	successes int
+	probedAt  time.Time
+}
+
+func (c *breakerCircuit) add(failed bool) {
+	if c.calls == len(c.window) {
+		if c.window[c.next] {
+			c.failures--
+		}
+	} else {
+		c.calls++
+	}
+	c.window[c.next] = failed
+	if failed {
+		c.failures++
+	}
+	c.next = (c.next + 1) % len(c.window)
+}
+
+func (c *breakerCircuit) reset(state CircuitState) {
+	c.state = state
+	c.generation++
+	c.next, c.calls, c.failures = 0, 0, 0
+	c.probes, c.successes = 0, 0
+}
@@ -0,0 +1,229 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	const coolDown = 20 * time.Millisecond
+	newBreaker := func(transitions *transitionRecorder, scope connect.CircuitBreakerScope) *connect.CircuitBreaker {
+		return connect.NewCircuitBreaker(connect.CircuitBreakerPolicy{
+			Scope:          scope,
+			WindowSize:     4,
+			MinimumCalls:   4,
+			FailureRatio:   0.5,
+			CoolDown:       coolDown,
+			HalfOpenProbes: 1,
+			OnStateChange:  transitions.record,
+		})
+	}
+	ping := func(client pingv1connect_test.PingServiceClient) error {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		return err
+	}
+	t.Run("open_and_recover", func(t *testing.T) {
+		t.Parallel()
+		server := newBalancerPingServers(t, 1)[0]
+		var transitions transitionRecorder
+		breaker := newBreaker(&transitions, connect.CircuitPerProcedure)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, server.URL, connect.WithCircuitBreaker(breaker))
+		procedure := "/" + pingv1connect_test.PingServiceName + "/Ping"
+
+		// Two successes and two failures fill the window and open the circuit.
+		assert.Nil(t, ping(client))
+		assert.Nil(t, ping(client))
+		server.setErr(connect.NewError(connect.CodeUnavailable, errors.New("overloaded")))
+		assert.NotNil(t, ping(client))
+		assert.NotNil(t, ping(client))
+		assert.Equal(t, breaker.State(procedure), connect.CircuitOpen)
+
+		// While open, calls fail without reaching the server.
+		err := ping(client)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, server.hits(), 4)
+
+		// After the cool-down, a successful probe closes the circuit.
+		server.setErr(nil)
+		time.Sleep(coolDown)
+		assert.Equal(t, breaker.State(procedure), connect.CircuitHalfOpen)
+		assert.Nil(t, ping(client))
+		assert.Equal(t, server.hits(), 5)
+		assert.Equal(t, breaker.State(procedure), connect.CircuitClosed)
+		assert.Equal(t, transitions.get(), []string{
+			procedure + ": closed -> open",
+			procedure + ": open -> half_open",
+			procedure + ": half_open -> closed",
+		})
+	})
+	t.Run("failed_probe", func(t *testing.T) {
+		t.Parallel()
+		server := newBalancerPingServers(t, 1)[0]
+		server.setErr(connect.NewError(connect.CodeDeadlineExceeded, errors.New("slow")))
+		var transitions transitionRecorder
+		breaker := newBreaker(&transitions, connect.CircuitPerProcedure)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, server.URL, connect.WithCircuitBreaker(breaker))
+		for i := 0; i < 4; i++ {
+			assert.NotNil(t, ping(client))
+		}
+		time.Sleep(coolDown)
+		assert.Equal(t, connect.CodeOf(ping(client)), connect.CodeDeadlineExceeded)
+		assert.Equal(t, server.hits(), 5)
+		// The failed probe reopens the circuit.
+		assert.Equal(t, connect.CodeOf(ping(client)), connect.CodeUnavailable)
+		assert.Equal(t, server.hits(), 5)
+		procedure := "/" + pingv1connect_test.PingServiceName + "/Ping"
+		assert.Equal(t, transitions.get(), []string{
+			procedure + ": closed -> open",
+			procedure + ": open -> half_open",
+			procedure + ": half_open -> open",
+		})
+	})
+	t.Run("canceled_probe", func(t *testing.T) {
+		t.Parallel()
+		server := newBalancerPingServers(t, 1)[0]
+		server.setErr(connect.NewError(connect.CodeUnavailable, errors.New("down")))
+		var transitions transitionRecorder
+		breaker := newBreaker(&transitions, connect.CircuitPerProcedure)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, server.URL, connect.WithCircuitBreaker(breaker))
+		procedure := "/" + pingv1connect_test.PingServiceName + "/Ping"
+		for i := 0; i < 4; i++ {
+			assert.NotNil(t, ping(client))
+		}
+		time.Sleep(coolDown)
+		// A probe canceled by its caller neither closes the circuit nor uses up
+		// the probe.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		assert.Equal(t, breaker.State(procedure), connect.CircuitHalfOpen)
+		server.setErr(nil)
+		assert.Nil(t, ping(client))
+		assert.Equal(t, breaker.State(procedure), connect.CircuitClosed)
+	})
+	t.Run("abandoned_probe", func(t *testing.T) {
+		t.Parallel()
+		server := newBalancerPingServers(t, 1)[0]
+		server.setErr(connect.NewError(connect.CodeUnavailable, errors.New("down")))
+		var transitions transitionRecorder
+		breaker := newBreaker(&transitions, connect.CircuitPerEndpoint)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, server.URL, connect.WithCircuitBreaker(breaker))
+		for i := 0; i < 4; i++ {
+			assert.NotNil(t, ping(client))
+		}
+		time.Sleep(coolDown)
+		// The probe's outcome isn't reported until the stream is closed.
+		stream := client.Sum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1_test.SumRequest{Number: 1}))
+		t.Cleanup(func() { _, _ = stream.CloseAndReceive() })
+		assert.Equal(t, connect.CodeOf(ping(client)), connect.CodeUnavailable)
+		// A cool-down later, the breaker lets another probe through.
+		time.Sleep(coolDown)
+		server.setErr(nil)
+		assert.Nil(t, ping(client))
+		assert.Equal(t, breaker.State(server.addr()), connect.CircuitClosed)
+	})
+	t.Run("ignored_codes", func(t *testing.T) {
+		t.Parallel()
+		server := newBalancerPingServers(t, 1)[0]
+		server.setErr(connect.NewError(connect.CodeInvalidArgument, errors.New("bad request")))
+		var transitions transitionRecorder
+		breaker := newBreaker(&transitions, connect.CircuitPerProcedure)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, server.URL, connect.WithCircuitBreaker(breaker))
+		for i := 0; i < 8; i++ {
+			assert.Equal(t, connect.CodeOf(ping(client)), connect.CodeInvalidArgument)
+		}
+		assert.Equal(t, server.hits(), 8)
+		assert.Zero(t, transitions.get())
+	})
+	t.Run("per_endpoint", func(t *testing.T) {
+		t.Parallel()
+		servers := newBalancerPingServers(t, 2)
+		servers[0].setErr(connect.NewError(connect.CodeUnavailable, errors.New("down")))
+		var transitions transitionRecorder
+		breaker := newBreaker(&transitions, connect.CircuitPerEndpoint)
+		balancer := connect.NewBalancer(
+			connect.NewStaticResolver(servers.addrs()...),
+			connect.RoundRobin(),
+			connect.WithEjection(0, 0),
+		)
+		t.Cleanup(balancer.Close)
+		client := pingv1connect_test.NewPingServiceClient(
+			http.DefaultClient,
+			"http://ping.invalid",
+			connect.WithBalancer(balancer),
+			connect.WithCircuitBreaker(breaker),
+		)
+		for i := 0; i < 12; i++ {
+			_ = ping(client)
+		}
+		assert.Equal(t, breaker.State(servers[0].addr()), connect.CircuitOpen)
+		assert.Equal(t, breaker.State(servers[1].addr()), connect.CircuitClosed)
+		assert.Equal(t, servers[0].hits(), 4)
+		assert.Equal(t, servers[1].hits(), 6)
+	})
+	t.Run("streams", func(t *testing.T) {
+		t.Parallel()
+		server := newBalancerPingServers(t, 1)[0]
+		server.setErr(connect.NewError(connect.CodeUnavailable, errors.New("down")))
+		var transitions transitionRecorder
+		breaker := newBreaker(&transitions, connect.CircuitPerEndpoint)
+		client := pingv1connect_test.NewPingServiceClient(http.DefaultClient, server.URL, connect.WithCircuitBreaker(breaker))
+		sum := func() error {
+			stream := client.Sum(context.Background())
+			_ = stream.Send(&pingv1_test.SumRequest{Number: 1})
+			_, err := stream.CloseAndReceive()
+			return err
+		}
+		for i := 0; i < 4; i++ {
+			assert.NotNil(t, sum())
+		}
+		assert.Equal(t, server.hits(), 4)
+		assert.Equal(t, connect.CodeOf(sum()), connect.CodeUnavailable)
+		assert.Equal(t, server.hits(), 4)
+		assert.Equal(t, len(transitions.get()), 1)
+	})
+}
+
+type transitionRecorder struct {
+	mu          sync.Mutex
+	transitions []string
+}
+
+func (r *transitionRecorder) record(key string, from, to connect.CircuitState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitions = append(r.transitions, fmt.Sprintf("%s: %v -> %v", key, from, to))
+}
+
+func (r *transitionRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.transitions...)
+}
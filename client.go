@@ -19,6 +19,8 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 )
 
 // Client is a reusable, concurrency-safe client for a single procedure.
@@ -29,10 +31,12 @@ import (
 // ask for gzipped responses, and send uncompressed requests. To use the gRPC
 // or gRPC-Web protocols, use the [WithGRPC] or [WithGRPCWeb] options.
 type Client[Req, Res any] struct {
-	config         *clientConfig
-	callUnary      func(context.Context, *Request[Req]) (*Response[Res], error)
-	protocolClient protocolClient
-	err            error
+	config            *clientConfig
+	callUnary         func(context.Context, *Request[Req], *callConfig) (*Response[Res], error)
+	endpoint          *endpointClient
+	balanced          *balancedClient
+	newEndpointClient func(url string, options callProtocolOptions) (*endpointClient, error)
+	err               error
 }
 
 // NewClient constructs a new Client.
@@ -44,62 +48,115 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 		return client
 	}
 	client.config = config
-	protocolClient, protocolErr := client.config.Protocol.NewClient(
-		&protocolClientParams{
-			CompressionName: config.RequestCompressionName,
-			CompressionPools: newReadOnlyCompressionPools(
-				config.CompressionPools,
-				config.CompressionNames,
-			),
-			Codec:            config.Codec,
-			Protobuf:         config.protobuf(),
-			CompressMinBytes: config.CompressMinBytes,
-			HTTPClient:       httpClient,
-			URL:              url,
-			BufferPool:       config.BufferPool,
-			ReadMaxBytes:     config.ReadMaxBytes,
-			SendMaxBytes:     config.SendMaxBytes,
-		},
-	)
-	if protocolErr != nil {
-		client.err = protocolErr
-		return client
-	}
-	client.protocolClient = protocolClient
-	// Rather than applying unary interceptors along the hot path, we can do it
-	// once at client creation.
 	unarySpec := config.newSpec(StreamTypeUnary)
-	unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
-		conn := client.protocolClient.NewConn(ctx, unarySpec, request.Header())
-		// Send always returns an io.EOF unless the error is from the client-side.
-		// We want the user to continue to call Receive in those cases to get the
-		// full error from the server-side.
-		if err := conn.Send(request.Any()); err != nil && !errors.Is(err, io.EOF) {
-			_ = conn.CloseRequest()
-			_ = conn.CloseResponse()
+	// Rather than applying unary interceptors along the hot path, we can do it
+	// once for each endpoint. Calls with options that affect the protocol use
+	// a protocol client and unary chain derived from the endpoint's, which the
+	// endpoint caches.
+	client.newEndpointClient = func(url string, options callProtocolOptions) (*endpointClient, error) {
+		params := config.newProtocolClientParams(httpClient, url)
+		options.applyToParams(params)
+		protocolClient, err := config.newProtocolClient(params)
+		if err != nil {
 			return nil, err
 		}
-		if err := conn.CloseRequest(); err != nil {
-			_ = conn.CloseResponse()
-			return nil, err
+		callOnce := func(ctx context.Context, request AnyRequest, header http.Header) (AnyResponse, error) {
+			conn := config.wrapValidators(config.wrapResponseInitializer(protocolClient.NewConn(ctx, unarySpec, header)))
+			// Send always returns an io.EOF unless the error is from the client-side.
+			// We want the user to continue to call Receive in those cases to get the
+			// full error from the server-side.
+			if err := conn.Send(request.Any()); err != nil && !errors.Is(err, io.EOF) {
+				_ = conn.CloseRequest()
+				_ = conn.CloseResponse()
+				return nil, err
+			}
+			if err := conn.CloseRequest(); err != nil {
+				_ = conn.CloseResponse()
+				return nil, err
+			}
+			response, err := receiveUnaryResponse[Res](conn)
+			if err != nil {
+				_ = conn.CloseResponse()
+				return nil, err
+			}
+			return response, conn.CloseResponse()
+		}
+		if breaker := config.CircuitBreaker; breaker != nil {
+			key := breaker.key(config.Procedure, protocolClient.Peer().Addr)
+			callWithoutBreaker := callOnce
+			callOnce = func(ctx context.Context, request AnyRequest, header http.Header) (AnyResponse, error) {
+				done, err := breaker.allow(key)
+				if err != nil {
+					return nil, err
+				}
+				response, err := callWithoutBreaker(ctx, request, header)
+				done(err)
+				return response, err
+			}
 		}
-		response, err := receiveUnaryResponse[Res](conn)
+		unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+			return callOnce(ctx, request, request.Header())
+		})
+		if config.HedgingPolicy.appliesTo(unarySpec) {
+			unaryFunc = func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+				return callUnaryWithHedging(ctx, config.HedgingPolicy, request, callOnce)
+			}
+		} else if config.RetryPolicy.appliesTo(unarySpec) {
+			unaryFunc = func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+				return callUnaryWithRetry(ctx, config.RetryPolicy, request, callOnce)
+			}
+		}
+		endpoint := &endpointClient{
+			url:            url,
+			protocolClient: protocolClient,
+			baseUnaryFunc:  unaryFunc,
+			unaryFunc:      unaryFunc,
+			newDerived: func(options callProtocolOptions) (*endpointClient, error) {
+				return client.newEndpointClient(url, options)
+			},
+		}
+		if interceptor := config.Interceptor; interceptor != nil {
+			endpoint.unaryFunc = interceptor.WrapUnary(unaryFunc)
+		}
+		return endpoint, nil
+	}
+	endpoint, endpointErr := client.newEndpointClient(url, callProtocolOptions{})
+	if endpointErr != nil {
+		client.err = endpointErr
+		return client
+	}
+	client.endpoint = endpoint
+	if config.Balancer != nil {
+		// Each endpoint gets its own protocol client, so that the URL and Peer
+		// reflect the endpoint chosen for each call.
+		balanced, balancedErr := newBalancedClient(config.Balancer, url, func(url string) (*endpointClient, error) {
+			return client.newEndpointClient(url, callProtocolOptions{})
+		})
+		if balancedErr != nil {
+			client.err = balancedErr
+			return client
+		}
+		client.balanced = balanced
+	}
+	callUnary := func(ctx context.Context, endpoint *endpointClient, request *Request[Req], call *callConfig) (*Response[Res], error) {
+		endpoint, err := endpoint.forCall(call)
 		if err != nil {
-			_ = conn.CloseResponse()
 			return nil, err
 		}
-		return response, conn.CloseResponse()
-	})
-	if interceptor := config.Interceptor; interceptor != nil {
-		unaryFunc = interceptor.WrapUnary(unaryFunc)
-	}
-	client.callUnary = func(ctx context.Context, request *Request[Req]) (*Response[Res], error) {
+		unaryFunc := endpoint.unaryFunc
+		// The client's interceptors wrap any interceptors for the call.
+		if interceptor := call.interceptor(); interceptor != nil {
+			unaryFunc = interceptor.WrapUnary(endpoint.baseUnaryFunc)
+			if interceptor := client.config.Interceptor; interceptor != nil {
+				unaryFunc = interceptor.WrapUnary(unaryFunc)
+			}
+		}
 		// To make the specification, peer, and RPC headers visible to the full
 		// interceptor chain (as though they were supplied by the caller), we'll
 		// add them here.
 		request.spec = unarySpec
-		request.peer = client.protocolClient.Peer()
-		protocolClient.WriteRequestHeader(StreamTypeUnary, request.Header())
+		request.peer = endpoint.protocolClient.Peer()
+		endpoint.protocolClient.WriteRequestHeader(StreamTypeUnary, request.Header())
 		response, err := unaryFunc(ctx, request)
 		if err != nil {
 			return nil, err
@@ -108,33 +165,92 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 		if !ok {
 			return nil, errorf(CodeInternal, "unexpected client response type %T", response)
 		}
+		call.onResponse(typed.Header(), typed.Trailer())
 		return typed, nil
 	}
+	client.callUnary = func(ctx context.Context, request *Request[Req], call *callConfig) (*Response[Res], error) {
+		if timeout := client.config.timeout(ctx, call); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if client.balanced == nil {
+			return callUnary(ctx, client.endpoint, request, call)
+		}
+		endpoint, done, err := client.balanced.pick(ctx, request.Header())
+		if err != nil {
+			return nil, err
+		}
+		response, err := callUnary(ctx, endpoint, request, call)
+		done(err)
+		return response, err
+	}
+	if config.CoalesceRequests {
+		coalescer := newUnaryCoalescer[Req, Res](config.Codec.(stableCodec), config.CoalesceHeaders, config.unaryResponseInitializer()) //nolint:forcetypeassert // checked by validate
+		callWithoutCoalescing := client.callUnary
+		client.callUnary = func(ctx context.Context, request *Request[Req], call *callConfig) (*Response[Res], error) {
+			if call != nil {
+				// Options may change the call's behavior or observe its
+				// response, so calls with options are never shared.
+				return callWithoutCoalescing(ctx, request, call)
+			}
+			return coalescer.call(ctx, request, func(ctx context.Context, request *Request[Req]) (*Response[Res], error) {
+				return callWithoutCoalescing(ctx, request, nil /* call */)
+			})
+		}
+	}
+	if config.ResponseCache != nil && config.IdempotencyLevel == IdempotencyNoSideEffects {
+		cacher := newResponseCacher[Req, Res](config)
+		callWithoutCache := client.callUnary
+		client.callUnary = func(ctx context.Context, request *Request[Req], call *callConfig) (*Response[Res], error) {
+			if call != nil {
+				return callWithoutCache(ctx, request, call)
+			}
+			return cacher.call(ctx, request, func(ctx context.Context, request *Request[Req]) (*Response[Res], error) {
+				return callWithoutCache(ctx, request, nil /* call */)
+			})
+		}
+	}
 	return client
 }
 
-// CallUnary calls a request-response procedure.
-func (c *Client[Req, Res]) CallUnary(ctx context.Context, request *Request[Req]) (*Response[Res], error) {
+// CallUnary calls a request-response procedure. Any options apply to this
+// call only.
+func (c *Client[Req, Res]) CallUnary(ctx context.Context, request *Request[Req], options ...CallOption) (*Response[Res], error) {
 	if c.err != nil {
 		return nil, c.err
 	}
-	return c.callUnary(ctx, request)
+	call, err := c.config.newCallConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return c.callUnary(ctx, request, call)
 }
 
-// CallClientStream calls a client streaming procedure.
-func (c *Client[Req, Res]) CallClientStream(ctx context.Context) *ClientStreamForClient[Req, Res] {
+// CallClientStream calls a client streaming procedure. Any options apply to
+// this call only.
+func (c *Client[Req, Res]) CallClientStream(ctx context.Context, options ...CallOption) *ClientStreamForClient[Req, Res] {
 	if c.err != nil {
 		return &ClientStreamForClient[Req, Res]{err: c.err}
 	}
-	return &ClientStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeClient)}
+	call, err := c.config.newCallConfig(options)
+	if err != nil {
+		return &ClientStreamForClient[Req, Res]{err: err}
+	}
+	return &ClientStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeClient, call)}
 }
 
-// CallServerStream calls a server streaming procedure.
-func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Request[Req]) (*ServerStreamForClient[Res], error) {
+// CallServerStream calls a server streaming procedure. Any options apply to
+// this call only.
+func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Request[Req], options ...CallOption) (*ServerStreamForClient[Res], error) {
 	if c.err != nil {
 		return nil, c.err
 	}
-	conn := c.newConn(ctx, StreamTypeServer)
+	call, callErr := c.config.newCallConfig(options)
+	if callErr != nil {
+		return nil, callErr
+	}
+	conn := c.newConn(ctx, StreamTypeServer, call)
 	mergeHeaders(conn.RequestHeader(), request.header)
 	// Send always returns an io.EOF unless the error is from the client-side.
 	// We want the user to continue to call Receive in those cases to get the
@@ -150,28 +266,88 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 	return &ServerStreamForClient[Res]{conn: conn}, nil
 }
 
-// CallBidiStream calls a bidirectional streaming procedure.
-func (c *Client[Req, Res]) CallBidiStream(ctx context.Context) *BidiStreamForClient[Req, Res] {
+// CallBidiStream calls a bidirectional streaming procedure. Any options apply
+// to this call only.
+func (c *Client[Req, Res]) CallBidiStream(ctx context.Context, options ...CallOption) *BidiStreamForClient[Req, Res] {
 	if c.err != nil {
 		return &BidiStreamForClient[Req, Res]{err: c.err}
 	}
-	return &BidiStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeBidi)}
+	call, err := c.config.newCallConfig(options)
+	if err != nil {
+		return &BidiStreamForClient[Req, Res]{err: err}
+	}
+	return &BidiStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeBidi, call)}
 }
 
-func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType) StreamingClientConn {
-	newConn := func(ctx context.Context, spec Spec) StreamingClientConn {
+func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType, call *callConfig) StreamingClientConn {
+	var cancel context.CancelFunc
+	if timeout := c.config.timeout(ctx, call); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	newProtocolConn := func(ctx context.Context, spec Spec, endpoint *endpointClient) StreamingClientConn {
+		endpoint, err := endpoint.forCall(call)
+		if err != nil {
+			return &errorClientConn{spec: spec, err: err, header: make(http.Header)}
+		}
+		protocolClient := endpoint.protocolClient
 		header := make(http.Header, 8) // arbitrary power of two, prevent immediate resizing
-		c.protocolClient.WriteRequestHeader(streamType, header)
-		return c.protocolClient.NewConn(ctx, spec, header)
+		protocolClient.WriteRequestHeader(streamType, header)
+		var report func(error)
+		if breaker := c.config.CircuitBreaker; breaker != nil {
+			done, err := breaker.allow(breaker.key(spec.Procedure, protocolClient.Peer().Addr))
+			if err != nil {
+				return &errorClientConn{spec: spec, err: err, header: header}
+			}
+			report = done
+		}
+		var conn StreamingClientConn
+		if streamType == StreamTypeServer && c.config.StreamResumptionPolicy != nil {
+			conn = newResumableClientConn(ctx, spec, c.config.StreamResumptionPolicy, header, protocolClient.NewConn)
+		} else if streamType != StreamTypeBidi && c.config.RetryPolicy.appliesTo(spec) {
+			conn = newRetryClientConn(ctx, spec, c.config.RetryPolicy, header, protocolClient.NewConn)
+		} else {
+			conn = protocolClient.NewConn(ctx, spec, header)
+		}
+		conn = c.config.wrapValidators(c.config.wrapResponseInitializer(conn))
+		if report != nil {
+			conn = &reportingClientConn{StreamingClientConn: conn, report: report}
+		}
+		return conn
+	}
+	newConn := func(ctx context.Context, spec Spec) StreamingClientConn {
+		if c.balanced != nil {
+			return c.balanced.newConn(ctx, spec, func(endpoint *endpointClient) StreamingClientConn {
+				return newProtocolConn(ctx, spec, endpoint)
+			})
+		}
+		return newProtocolConn(ctx, spec, c.endpoint)
+	}
+	// The client's interceptors wrap any interceptors for the call.
+	if interceptor := call.interceptor(); interceptor != nil {
+		newConn = interceptor.WrapStreamingClient(newConn)
 	}
 	if interceptor := c.config.Interceptor; interceptor != nil {
 		newConn = interceptor.WrapStreamingClient(newConn)
 	}
-	return newConn(ctx, c.config.newSpec(streamType))
+	conn := newConn(ctx, c.config.newSpec(streamType))
+	if cancel == nil && !call.hasHooks() {
+		return conn
+	}
+	return &reportingClientConn{
+		StreamingClientConn: conn,
+		report: func(err error) {
+			if err == nil {
+				call.onResponse(conn.ResponseHeader(), conn.ResponseTrailer())
+			}
+			if cancel != nil {
+				cancel()
+			}
+		},
+	}
 }
 
 type clientConfig struct {
-	Protocol               protocol
+	Protocol               Protocol
 	Procedure              string
 	CompressMinBytes       int
 	Interceptor            Interceptor
@@ -182,6 +358,24 @@ type clientConfig struct {
 	BufferPool             *bufferPool
 	ReadMaxBytes           int
 	SendMaxBytes           int
+	IdempotencyLevel       IdempotencyLevel
+	RetryPolicy            *retryPolicy
+	HedgingPolicy          *hedgingPolicy
+	Balancer               *Balancer
+	CircuitBreaker         *CircuitBreaker
+	DefaultTimeout         time.Duration
+	CoalesceRequests       bool
+	CoalesceHeaders        []string
+	ResponseCache          ResponseCache
+	ResponseCacheVary      []string
+	StreamResumptionPolicy *streamResumptionPolicy
+	Schema                 any
+	EnableGet              bool
+	GetURLMaxBytes         int
+	GetUseFallback         bool
+	ResponseInitializer    func(Spec, any) error
+	Validators             []Validator
+	ValidateSends          bool
 }
 
 func newClientConfig(url string, options []ClientOption) (*clientConfig, *Error) {
@@ -207,6 +401,17 @@ func (c *clientConfig) validate() *Error {
 	if c.Codec == nil || c.Codec.Name() == "" {
 		return errorf(CodeUnknown, "no codec configured")
 	}
+	if _, ok := c.Codec.(stableCodec); c.CoalesceRequests && !ok {
+		return errorf(CodeUnknown, "can't coalesce requests: codec %q doesn't marshal deterministically", c.Codec.Name())
+	}
+	if _, ok := c.Codec.(stableCodec); c.ResponseCache != nil && !ok {
+		return errorf(CodeUnknown, "can't cache responses: codec %q doesn't marshal deterministically", c.Codec.Name())
+	}
+	if _, ok := c.Protocol.(*protocolConnect); ok && c.EnableGet && !c.GetUseFallback {
+		if _, ok := c.Codec.(stableCodec); !ok {
+			return errorf(CodeUnknown, "can't send GET requests: codec %q doesn't marshal deterministically", c.Codec.Name())
+		}
+	}
 	if c.RequestCompressionName != "" && c.RequestCompressionName != compressionIdentity {
 		if _, ok := c.CompressionPools[c.RequestCompressionName]; !ok {
 			return errorf(CodeUnknown, "unknown compression %q", c.RequestCompressionName)
@@ -215,6 +420,38 @@ func (c *clientConfig) validate() *Error {
 	return nil
 }
 
+// newProtocolClient builds the client's protocol client, applying the client's
+// GET settings if it uses the Connect protocol.
+func (c *clientConfig) newProtocolClient(params *ProtocolClientParams) (ProtocolClient, error) {
+	if _, ok := c.Protocol.(*protocolConnect); ok {
+		protocol := &protocolConnect{
+			enableGet:      c.EnableGet,
+			getURLMaxBytes: c.GetURLMaxBytes,
+			getUseFallback: c.GetUseFallback,
+		}
+		return protocol.NewClient(params)
+	}
+	return c.Protocol.NewClient(params)
+}
+
+func (c *clientConfig) newProtocolClientParams(httpClient HTTPClient, url string) *ProtocolClientParams {
+	return &ProtocolClientParams{
+		CompressionName: c.RequestCompressionName,
+		compressionPools: newReadOnlyCompressionPools(
+			c.CompressionPools,
+			c.CompressionNames,
+		),
+		Codec:            c.Codec,
+		Protobuf:         c.protobuf(),
+		CompressMinBytes: c.CompressMinBytes,
+		HTTPClient:       httpClient,
+		URL:              url,
+		bufferPool:       c.BufferPool,
+		ReadMaxBytes:     c.ReadMaxBytes,
+		SendMaxBytes:     c.SendMaxBytes,
+	}
+}
+
 func (c *clientConfig) protobuf() Codec {
 	if c.Codec.Name() == codecNameProto {
 		return c.Codec
@@ -222,10 +459,207 @@ func (c *clientConfig) protobuf() Codec {
 	return &protoBinaryCodec{}
 }
 
+// timeout returns the timeout to apply to a call: the call's own timeout if it
+// has one, or the default timeout if the context has no deadline.
+func (c *clientConfig) timeout(ctx context.Context, call *callConfig) time.Duration {
+	if timeout := call.timeout(); timeout > 0 {
+		return timeout
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return c.DefaultTimeout
+	}
+	return 0
+}
+
 func (c *clientConfig) newSpec(t StreamType) Spec {
 	return Spec{
-		StreamType: t,
-		Procedure:  c.Procedure,
-		IsClient:   true,
+		StreamType:       t,
+		Procedure:        c.Procedure,
+		IsClient:         true,
+		IdempotencyLevel: c.IdempotencyLevel,
+		Schema:           c.Schema,
+	}
+}
+
+// initializeResponse prepares a message to receive a response. Messages of
+// compile-time types need no preparation.
+func (c *clientConfig) initializeResponse(spec Spec, msg any) error {
+	if c.ResponseInitializer == nil {
+		return nil
+	}
+	return c.ResponseInitializer(spec, msg)
+}
+
+// unaryResponseInitializer prepares messages for unary responses that don't
+// come directly from a conn, like cached and coalesced responses.
+func (c *clientConfig) unaryResponseInitializer() func(any) error {
+	spec := c.newSpec(StreamTypeUnary)
+	return func(msg any) error {
+		return c.initializeResponse(spec, msg)
+	}
+}
+
+// callConfig holds the options for a single call. A nil *callConfig means
+// the call has no options.
+type callConfig struct {
+	Timeout                time.Duration
+	RequestCompressionName string
+	ReadMaxBytes           *int
+	SendMaxBytes           *int
+	Interceptors           []Interceptor
+	OnResponseHeader       func(http.Header)
+	OnResponseTrailer      func(http.Header)
+}
+
+func (c *clientConfig) newCallConfig(options []CallOption) (*callConfig, *Error) {
+	if len(options) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+	var call callConfig
+	for _, opt := range options {
+		opt.applyToCall(&call)
 	}
+	if name := call.RequestCompressionName; name != "" && name != compressionIdentity {
+		if _, ok := c.CompressionPools[name]; !ok {
+			return nil, errorf(CodeUnknown, "unknown compression %q", name)
+		}
+	}
+	return &call, nil
+}
+
+func (c *callConfig) timeout() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.Timeout
+}
+
+func (c *callConfig) interceptor() Interceptor {
+	if c == nil || len(c.Interceptors) == 0 {
+		return nil
+	}
+	return newChain(c.Interceptors)
 }
+
+// protocolOptions returns the call's options that require a protocol client
+// of their own.
+func (c *callConfig) protocolOptions() callProtocolOptions {
+	var options callProtocolOptions
+	if c == nil {
+		return options
+	}
+	options.compressionName = c.RequestCompressionName
+	if c.ReadMaxBytes != nil {
+		options.readMaxBytes, options.hasReadMaxBytes = *c.ReadMaxBytes, true
+	}
+	if c.SendMaxBytes != nil {
+		options.sendMaxBytes, options.hasSendMaxBytes = *c.SendMaxBytes, true
+	}
+	return options
+}
+
+// callProtocolOptions are the call options that affect the protocol client.
+// They're comparable, so that endpoints can cache the clients derived for
+// each set of options.
+type callProtocolOptions struct {
+	compressionName string
+	readMaxBytes    int
+	hasReadMaxBytes bool
+	sendMaxBytes    int
+	hasSendMaxBytes bool
+}
+
+func (o callProtocolOptions) applyToParams(params *ProtocolClientParams) {
+	if o.compressionName != "" {
+		params.CompressionName = o.compressionName
+	}
+	if o.hasReadMaxBytes {
+		params.ReadMaxBytes = o.readMaxBytes
+	}
+	if o.hasSendMaxBytes {
+		params.SendMaxBytes = o.sendMaxBytes
+	}
+}
+
+func (c *callConfig) hasHooks() bool {
+	return c != nil && (c.OnResponseHeader != nil || c.OnResponseTrailer != nil)
+}
+
+func (c *callConfig) onResponse(header, trailer http.Header) {
+	if c == nil {
+		return
+	}
+	if c.OnResponseHeader != nil {
+		c.OnResponseHeader(header)
+	}
+	if c.OnResponseTrailer != nil {
+		c.OnResponseTrailer(trailer)
+	}
+}
+
+// reportingClientConn reports the outcome of a stream once its response is
+// closed. It's used to feed load balancers and circuit breakers.
+type reportingClientConn struct {
+	StreamingClientConn
+
+	report     func(error)
+	reportOnce sync.Once
+	err        error // first error from Receive
+}
+
+func (cc *reportingClientConn) Receive(msg any) error {
+	err := cc.StreamingClientConn.Receive(msg)
+	if err != nil && cc.err == nil && !errors.Is(err, io.EOF) {
+		cc.err = err
+	}
+	return err
+}
+
+func (cc *reportingClientConn) CloseResponse() error {
+	err := cc.StreamingClientConn.CloseResponse()
+	cc.reportOnce.Do(func() { cc.report(cc.err) })
+	return err
+}
+
+// wrapResponseInitializer prepares each message before the conn receives into
+// it, if the client has a response initializer.
+func (c *clientConfig) wrapResponseInitializer(conn StreamingClientConn) StreamingClientConn {
+	if c.ResponseInitializer == nil {
+		return conn
+	}
+	return &initializingClientConn{StreamingClientConn: conn, initialize: c.ResponseInitializer}
+}
+
+// initializingClientConn prepares messages to receive responses, so clients
+// can work with messages that aren't usable as zero values, like
+// dynamicpb.Message.
+type initializingClientConn struct {
+	StreamingClientConn
+
+	initialize func(Spec, any) error
+}
+
+func (cc *initializingClientConn) Receive(msg any) error {
+	if err := cc.initialize(cc.Spec(), msg); err != nil {
+		return NewError(CodeInternal, err)
+	}
+	return cc.StreamingClientConn.Receive(msg)
+}
+
+// errorClientConn is a StreamingClientConn that fails every operation with
+// the same error.
+type errorClientConn struct {
+	spec   Spec
+	err    error
+	header http.Header
+}
+
+func (cc *errorClientConn) Spec() Spec                   { return cc.spec }
+func (cc *errorClientConn) RequestHeader() http.Header   { return cc.header }
+func (cc *errorClientConn) Peer() Peer                   { return Peer{} }
+func (cc *errorClientConn) Send(any) error               { return cc.err }
+func (cc *errorClientConn) CloseRequest() error          { return cc.err }
+func (cc *errorClientConn) Receive(any) error            { return cc.err }
+func (cc *errorClientConn) ResponseHeader() http.Header  { return make(http.Header) }
+func (cc *errorClientConn) ResponseTrailer() http.Header { return make(http.Header) }
+func (cc *errorClientConn) CloseResponse() error         { return nil }
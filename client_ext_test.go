@@ -19,7 +19,10 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/joshcarp/connect-no/internal/assert"
 )
@@ -160,3 +163,142 @@ func (a *assertPeerInterceptor) WrapStreamingHandler(next connect.StreamingHandl
 		return next(ctx, conn)
 	}
 }
+
+func TestClientCallOptions(t *testing.T) {
+	t.Parallel()
+	var (
+		mu           sync.Mutex
+		hadDeadline  bool
+		sentEncoding string
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+			mu.Lock()
+			_, hadDeadline = ctx.Deadline()
+			sentEncoding = request.Header().Get("Content-Encoding")
+			mu.Unlock()
+			response := connect.NewResponse(&pingv1_test.PingResponse{
+				Number: request.Msg.Number,
+				Text:   request.Msg.Text,
+			})
+			response.Header().Set("Ping-Header", "header")
+			response.Trailer().Set("Ping-Trailer", "trailer")
+			return response, nil
+		},
+		countUp: func(ctx context.Context, request *connect.Request[pingv1_test.CountUpRequest], stream *connect.ServerStream[pingv1_test.CountUpResponse]) error {
+			mu.Lock()
+			_, hadDeadline = ctx.Deadline()
+			mu.Unlock()
+			stream.ResponseHeader().Set("Count-Header", "header")
+			stream.ResponseTrailer().Set("Count-Trailer", "trailer")
+			for i := int64(1); i <= request.Msg.Number; i++ {
+				if err := stream.Send(&pingv1_test.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	var order []string
+	record := func(name string) connect.UnaryInterceptorFunc {
+		return func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				order = append(order, name)
+				return next(ctx, request)
+			}
+		}
+	}
+	client := pingv1connect_test.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithInterceptors(record("client")),
+	)
+	ping := func(t *testing.T, text string, options ...connect.CallOption) (*connect.Response[pingv1_test.PingResponse], error) {
+		t.Helper()
+		request := connect.NewRequest(&pingv1_test.PingRequest{Number: 42, Text: text})
+		return client.Ping(context.Background(), request, options...)
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		_, err := ping(t, "")
+		assert.Nil(t, err)
+		mu.Lock()
+		assert.False(t, hadDeadline)
+		mu.Unlock()
+		_, err = ping(t, "", connect.WithCallTimeout(time.Minute))
+		assert.Nil(t, err)
+		mu.Lock()
+		assert.True(t, hadDeadline)
+		mu.Unlock()
+	})
+	t.Run("send_compression", func(t *testing.T) {
+		_, err := ping(t, strings.Repeat("a", 1024), connect.WithCallSendCompression("gzip"))
+		assert.Nil(t, err)
+		mu.Lock()
+		assert.Equal(t, sentEncoding, "gzip")
+		mu.Unlock()
+		_, err = ping(t, strings.Repeat("a", 1024))
+		assert.Nil(t, err)
+		mu.Lock()
+		assert.Equal(t, sentEncoding, "")
+		mu.Unlock()
+		_, err = ping(t, "", connect.WithCallSendCompression("snappy"))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+	})
+	t.Run("max_bytes", func(t *testing.T) {
+		_, err := ping(t, strings.Repeat("a", 1024), connect.WithCallSendMaxBytes(512))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		_, err = ping(t, strings.Repeat("a", 1024), connect.WithCallReadMaxBytes(512))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		// Limits don't outlive the call.
+		_, err = ping(t, strings.Repeat("a", 1024))
+		assert.Nil(t, err)
+	})
+	t.Run("interceptors", func(t *testing.T) {
+		order = nil
+		_, err := ping(t, "", connect.WithCallInterceptors(record("call1"), record("call2")))
+		assert.Nil(t, err)
+		assert.Equal(t, order, []string{"client", "call1", "call2"})
+	})
+	t.Run("capture", func(t *testing.T) {
+		var header, trailer http.Header
+		_, err := ping(
+			t,
+			"",
+			connect.WithCallResponseHeader(func(h http.Header) { header = h }),
+			connect.WithCallResponseTrailer(func(h http.Header) { trailer = h }),
+		)
+		assert.Nil(t, err)
+		assert.Equal(t, header.Get("Ping-Header"), "header")
+		assert.Equal(t, trailer.Get("Ping-Trailer"), "trailer")
+	})
+	t.Run("server_stream", func(t *testing.T) {
+		var header, trailer http.Header
+		stream, err := client.CountUp(
+			context.Background(),
+			connect.NewRequest(&pingv1_test.CountUpRequest{Number: 2}),
+			connect.WithCallTimeout(time.Minute),
+			connect.WithCallResponseHeader(func(h http.Header) { header = h }),
+			connect.WithCallResponseTrailer(func(h http.Header) { trailer = h }),
+		)
+		assert.Nil(t, err)
+		var count int
+		for stream.Receive() {
+			count++
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, count, 2)
+		assert.Nil(t, header)
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, header.Get("Count-Header"), "header")
+		assert.Equal(t, trailer.Get("Count-Trailer"), "trailer")
+		mu.Lock()
+		assert.True(t, hadDeadline)
+		mu.Unlock()
+	})
+}
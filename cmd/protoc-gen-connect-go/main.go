@@ -46,10 +46,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
+	connect "github.com/joshcarp/connect-no"
+	googleapi "github.com/joshcarp/connect-no/internal/gen/connectext/google/api"
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/pluginpb"
 )
@@ -67,6 +72,10 @@ const (
 	usage = "See https://connect.build/docs/go/getting-started to learn how to use this plugin.\n\nFlags:\n  -h, --help\tPrint this help and exit.\n      --version\tPrint the version and exit."
 
 	commentWidth = 97 // leave room for "// "
+
+	// httpRuleFieldNumber is the field number of the google.api.http method
+	// option.
+	httpRuleFieldNumber = 72295728
 )
 
 func main() {
@@ -160,6 +169,7 @@ func generateService(g *protogen.GeneratedFile, service *protogen.Service) {
 	generateClientImplementation(g, service, names)
 	generateServerInterface(g, service, names)
 	generateServerConstructor(g, service, names)
+	generateHTTPRoutesConstructor(g, service, names)
 	generateUnimplementedServerImplementation(g, service, names)
 }
 
@@ -212,7 +222,12 @@ func generateClientImplementation(g *protogen.GeneratedFile, service *protogen.S
 		)
 		g.P("httpClient,")
 		g.P(`baseURL + "`, procedureName(method), `",`)
-		g.P("opts...,")
+		if idempotency := idempotencyLevel(method); idempotency != connect.IdempotencyUnknown {
+			g.P(connectPackage.Ident("WithIdempotency"), "(", idempotencyLevelIdent(idempotency), "),")
+			g.P(connectPackage.Ident("WithClientOptions"), "(opts...),")
+		} else {
+			g.P("opts...,")
+		}
 		g.P("),")
 	}
 	g.P("}")
@@ -246,46 +261,51 @@ func generateClientMethod(g *protogen.GeneratedFile, method *protogen.Method, na
 
 	switch {
 	case isStreamingClient && !isStreamingServer:
-		g.P("return c.", unexport(method.GoName), ".CallClientStream(ctx)")
+		g.P("return c.", unexport(method.GoName), ".CallClientStream(ctx, opts...)")
 	case !isStreamingClient && isStreamingServer:
-		g.P("return c.", unexport(method.GoName), ".CallServerStream(ctx, req)")
+		g.P("return c.", unexport(method.GoName), ".CallServerStream(ctx, req, opts...)")
 	case isStreamingClient && isStreamingServer:
-		g.P("return c.", unexport(method.GoName), ".CallBidiStream(ctx)")
+		g.P("return c.", unexport(method.GoName), ".CallBidiStream(ctx, opts...)")
 	default:
-		g.P("return c.", unexport(method.GoName), ".CallUnary(ctx, req)")
+		g.P("return c.", unexport(method.GoName), ".CallUnary(ctx, req, opts...)")
 	}
 	g.P("}")
 	g.P()
 }
 
 func clientSignature(g *protogen.GeneratedFile, method *protogen.Method, named bool) string {
-	reqName := "req"
-	ctxName := "ctx"
+	reqName := "req "
+	ctxName := "ctx "
+	optsName := "opts "
 	if !named {
-		reqName, ctxName = "", ""
+		reqName, ctxName, optsName = "", "", ""
 	}
+	ctxParam := ctxName + g.QualifiedGoIdent(contextPackage.Ident("Context"))
+	optsParam := optsName + "..." + g.QualifiedGoIdent(connectPackage.Ident("CallOption"))
 	if method.Desc.IsStreamingClient() && method.Desc.IsStreamingServer() {
 		// bidi streaming
-		return method.GoName + "(" + ctxName + " " + g.QualifiedGoIdent(contextPackage.Ident("Context")) + ") " +
+		return method.GoName + "(" + ctxParam + ", " + optsParam + ") " +
 			"*" + g.QualifiedGoIdent(connectPackage.Ident("BidiStreamForClient")) +
 			"[" + g.QualifiedGoIdent(method.Input.GoIdent) + ", " + g.QualifiedGoIdent(method.Output.GoIdent) + "]"
 	}
 	if method.Desc.IsStreamingClient() {
 		// client streaming
-		return method.GoName + "(" + ctxName + " " + g.QualifiedGoIdent(contextPackage.Ident("Context")) + ") " +
+		return method.GoName + "(" + ctxParam + ", " + optsParam + ") " +
 			"*" + g.QualifiedGoIdent(connectPackage.Ident("ClientStreamForClient")) +
 			"[" + g.QualifiedGoIdent(method.Input.GoIdent) + ", " + g.QualifiedGoIdent(method.Output.GoIdent) + "]"
 	}
+	reqParam := reqName + "*" + g.QualifiedGoIdent(connectPackage.Ident("Request")) + "[" +
+		g.QualifiedGoIdent(method.Input.GoIdent) + "]"
 	if method.Desc.IsStreamingServer() {
-		return method.GoName + "(" + ctxName + " " + g.QualifiedGoIdent(contextPackage.Ident("Context")) +
-			", " + reqName + " *" + g.QualifiedGoIdent(connectPackage.Ident("Request")) + "[" +
-			g.QualifiedGoIdent(method.Input.GoIdent) + "]) " +
+		return method.GoName + "(" + ctxParam + ", " + reqParam + ", " + optsParam + ") " +
 			"(*" + g.QualifiedGoIdent(connectPackage.Ident("ServerStreamForClient")) +
 			"[" + g.QualifiedGoIdent(method.Output.GoIdent) + "]" +
 			", error)"
 	}
-	// unary; symmetric so we can re-use server templating
-	return method.GoName + serverSignatureParams(g, method, named)
+	// unary
+	return method.GoName + "(" + ctxParam + ", " + reqParam + ", " + optsParam + ") " +
+		"(*" + g.QualifiedGoIdent(connectPackage.Ident("Response")) + "[" +
+		g.QualifiedGoIdent(method.Output.GoIdent) + "], error)"
 }
 
 func generateServerInterface(g *protogen.GeneratedFile, service *protogen.Service, names names) {
@@ -338,7 +358,12 @@ func generateServerConstructor(g *protogen.GeneratedFile, service *protogen.Serv
 		}
 		g.P(`"`, procedureName(method), `",`)
 		g.P("svc.", method.GoName, ",")
-		g.P("opts...,")
+		if idempotency := idempotencyLevel(method); idempotency != connect.IdempotencyUnknown {
+			g.P(connectPackage.Ident("WithIdempotency"), "(", idempotencyLevelIdent(idempotency), "),")
+			g.P(connectPackage.Ident("WithHandlerOptions"), "(opts...),")
+		} else {
+			g.P("opts...,")
+		}
 		g.P("))")
 	}
 	g.P(`return "/`, reflectionName(service), `/", mux`)
@@ -346,6 +371,68 @@ func generateServerConstructor(g *protogen.GeneratedFile, service *protogen.Serv
 	g.P()
 }
 
+func generateHTTPRoutesConstructor(g *protogen.GeneratedFile, service *protogen.Service, names names) {
+	var methods []*protogen.Method
+	for _, method := range service.Methods {
+		if !method.Desc.IsStreamingClient() && !method.Desc.IsStreamingServer() && len(httpRules(method)) > 0 {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		return
+	}
+	wrapComments(g, names.HTTPRoutesConstructor, " builds REST-style HTTP routes for the ",
+		service.Desc.FullName(), " methods with google.api.http options. Serve them with ",
+		"connect.NewTranscoder.")
+	g.P("//")
+	wrapComments(g, "The handlers are constructed just like those returned by ",
+		names.ServerConstructor, ", so the options apply in the same way.")
+	if isDeprecatedService(service) {
+		g.P("//")
+		deprecated(g)
+	}
+	handlerOption := connectPackage.Ident("HandlerOption")
+	g.P("func ", names.HTTPRoutesConstructor, "(svc ", names.Server, ", opts ...", handlerOption,
+		") []", connectPackage.Ident("HTTPRoute"), " {")
+	for _, method := range methods {
+		g.P(unexport(method.GoName), "Handler := ", connectPackage.Ident("NewUnaryHandler"), "(")
+		g.P(`"`, procedureName(method), `",`)
+		g.P("svc.", method.GoName, ",")
+		if idempotency := idempotencyLevel(method); idempotency != connect.IdempotencyUnknown {
+			g.P(connectPackage.Ident("WithIdempotency"), "(", idempotencyLevelIdent(idempotency), "),")
+			g.P(connectPackage.Ident("WithHandlerOptions"), "(opts...),")
+		} else {
+			g.P("opts...,")
+		}
+		g.P(")")
+	}
+	g.P("return []", connectPackage.Ident("HTTPRoute"), "{")
+	for _, method := range methods {
+		for _, rule := range httpRules(method) {
+			httpMethod, path := httpRulePattern(rule)
+			if httpMethod == "" {
+				continue
+			}
+			g.P("{")
+			g.P("Rule: ", connectPackage.Ident("HTTPRule"), "{")
+			g.P("Method: ", strconv.Quote(httpMethod), ",")
+			g.P("Path: ", strconv.Quote(path), ",")
+			if body := rule.GetBody(); body != "" {
+				g.P("Body: ", strconv.Quote(body), ",")
+			}
+			if responseBody := rule.GetResponseBody(); responseBody != "" {
+				g.P("ResponseBody: ", strconv.Quote(responseBody), ",")
+			}
+			g.P("},")
+			g.P("Handler: ", unexport(method.GoName), "Handler,")
+			g.P("},")
+		}
+	}
+	g.P("}")
+	g.P("}")
+	g.P()
+}
+
 func generateUnimplementedServerImplementation(g *protogen.GeneratedFile, service *protogen.Service, names names) {
 	wrapComments(g, names.UnimplementedServer, " returns CodeUnimplemented from all methods.")
 	g.P("type ", names.UnimplementedServer, " struct {}")
@@ -432,6 +519,94 @@ func isDeprecatedMethod(method *protogen.Method) bool {
 	return ok && methodOptions.GetDeprecated()
 }
 
+// idempotencyLevel returns the idempotency level declared in the method's
+// options. The values of connect.IdempotencyLevel match the descriptor's
+// enumeration.
+func idempotencyLevel(method *protogen.Method) connect.IdempotencyLevel {
+	methodOptions, ok := method.Desc.Options().(*descriptorpb.MethodOptions)
+	if !ok {
+		return connect.IdempotencyUnknown
+	}
+	switch methodOptions.GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_NO_SIDE_EFFECTS:
+		return connect.IdempotencyNoSideEffects
+	case descriptorpb.MethodOptions_IDEMPOTENT:
+		return connect.IdempotencyIdempotent
+	default:
+		return connect.IdempotencyUnknown
+	}
+}
+
+// httpRules returns the method's google.api.http rule and its additional
+// bindings. This program doesn't link the googleapis packages, so the option
+// is parsed from the unknown fields of the method's options.
+func httpRules(method *protogen.Method) []*googleapi.HttpRule {
+	methodOptions, ok := method.Desc.Options().(*descriptorpb.MethodOptions)
+	if !ok || methodOptions == nil {
+		return nil
+	}
+	var rule *googleapi.HttpRule
+	unknown := methodOptions.ProtoReflect().GetUnknown()
+	for len(unknown) > 0 {
+		number, wireType, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			return nil
+		}
+		unknown = unknown[n:]
+		n = protowire.ConsumeFieldValue(number, wireType, unknown)
+		if n < 0 {
+			return nil
+		}
+		if number == httpRuleFieldNumber && wireType == protowire.BytesType {
+			value, _ := protowire.ConsumeBytes(unknown)
+			if rule == nil {
+				rule = &googleapi.HttpRule{}
+			}
+			// Repeated occurrences of a message field merge.
+			if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(value, rule); err != nil {
+				return nil
+			}
+		}
+		unknown = unknown[n:]
+	}
+	if rule == nil {
+		return nil
+	}
+	// Additional bindings may not nest, so we ignore their own bindings.
+	return append([]*googleapi.HttpRule{rule}, rule.GetAdditionalBindings()...)
+}
+
+// httpRulePattern returns the HTTP method and path template of a rule.
+func httpRulePattern(rule *googleapi.HttpRule) (string, string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *googleapi.HttpRule_Get:
+		return "GET", pattern.Get
+	case *googleapi.HttpRule_Put:
+		return "PUT", pattern.Put
+	case *googleapi.HttpRule_Post:
+		return "POST", pattern.Post
+	case *googleapi.HttpRule_Delete:
+		return "DELETE", pattern.Delete
+	case *googleapi.HttpRule_Patch:
+		return "PATCH", pattern.Patch
+	case *googleapi.HttpRule_Custom:
+		return pattern.Custom.GetKind(), pattern.Custom.GetPath()
+	default:
+		return "", ""
+	}
+}
+
+func idempotencyLevelIdent(level connect.IdempotencyLevel) protogen.GoIdent {
+	switch level {
+	case connect.IdempotencyNoSideEffects:
+		return connectPackage.Ident("IdempotencyNoSideEffects")
+	case connect.IdempotencyIdempotent:
+		return connectPackage.Ident("IdempotencyIdempotent")
+	default:
+		return connectPackage.Ident("IdempotencyUnknown")
+	}
+}
+
 // Raggedy comments in the generated code are driving me insane. This
 // word-wrapping function is ruinously inefficient, but it gets the job done.
 func wrapComments(g *protogen.GeneratedFile, elems ...any) {
@@ -498,25 +673,27 @@ func unexport(s string) string {
 }
 
 type names struct {
-	Base                string
-	Client              string
-	ClientConstructor   string
-	ClientImpl          string
-	ClientExposeMethod  string
-	Server              string
-	ServerConstructor   string
-	UnimplementedServer string
+	Base                  string
+	Client                string
+	ClientConstructor     string
+	ClientImpl            string
+	ClientExposeMethod    string
+	Server                string
+	ServerConstructor     string
+	HTTPRoutesConstructor string
+	UnimplementedServer   string
 }
 
 func newNames(service *protogen.Service) names {
 	base := service.GoName
 	return names{
-		Base:                base,
-		Client:              fmt.Sprintf("%sClient", base),
-		ClientConstructor:   fmt.Sprintf("New%sClient", base),
-		ClientImpl:          fmt.Sprintf("%sClient", unexport(base)),
-		Server:              fmt.Sprintf("%sHandler", base),
-		ServerConstructor:   fmt.Sprintf("New%sHandler", base),
-		UnimplementedServer: fmt.Sprintf("Unimplemented%sHandler", base),
+		Base:                  base,
+		Client:                fmt.Sprintf("%sClient", base),
+		ClientConstructor:     fmt.Sprintf("New%sClient", base),
+		ClientImpl:            fmt.Sprintf("%sClient", unexport(base)),
+		Server:                fmt.Sprintf("%sHandler", base),
+		ServerConstructor:     fmt.Sprintf("New%sHandler", base),
+		HTTPRoutesConstructor: fmt.Sprintf("New%sHTTPRoutes", base),
+		UnimplementedServer:   fmt.Sprintf("Unimplemented%sHandler", base),
 	}
 }
@@ -0,0 +1,228 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// unaryCoalescer shares one round-trip among identical in-flight unary calls.
+type unaryCoalescer[Req, Res any] struct {
+	codec      stableCodec
+	headers    []string
+	initialize func(any) error // prepares response messages
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall[Res]
+}
+
+func newUnaryCoalescer[Req, Res any](codec stableCodec, headers []string, initialize func(any) error) *unaryCoalescer[Req, Res] {
+	canonical := make([]string, len(headers))
+	for i, name := range headers {
+		canonical[i] = http.CanonicalHeaderKey(name)
+	}
+	return &unaryCoalescer[Req, Res]{
+		codec:      codec,
+		headers:    canonical,
+		initialize: initialize,
+		calls:      make(map[string]*coalescedCall[Res]),
+	}
+}
+
+// coalescedCall is a round-trip shared by one or more callers.
+type coalescedCall[Res any] struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int // guarded by the coalescer's mutex
+
+	// Set before done is closed.
+	payload []byte
+	header  http.Header
+	trailer http.Header
+	err     error
+}
+
+// call joins an identical in-flight call if there is one, and otherwise starts
+// a new one with callUnary. Either way, it waits for the result or for ctx to
+// be done, whichever comes first.
+func (c *unaryCoalescer[Req, Res]) call(
+	ctx context.Context,
+	request *Request[Req],
+	callUnary func(context.Context, *Request[Req]) (*Response[Res], error),
+) (*Response[Res], error) {
+	key, err := c.key(request)
+	if err != nil {
+		// We can't tell which calls are identical, so don't share this one.
+		return callUnary(ctx, request)
+	}
+	c.mu.Lock()
+	shared, ok := c.calls[key]
+	if ok {
+		shared.waiters++
+	} else {
+		sharedRequest, ok := cloneRequest(request)
+		if !ok {
+			// The round-trip may outlive the caller, who may then reuse the
+			// request, so we can't share a request we can't copy.
+			c.mu.Unlock()
+			return callUnary(ctx, request)
+		}
+		// The round-trip outlives any one caller, so it runs without their
+		// cancellation and deadlines. It's canceled once nobody is waiting.
+		sharedCtx, cancel := context.WithCancel(detachedContext{ctx})
+		shared = &coalescedCall[Res]{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		c.calls[key] = shared
+		go c.run(sharedCtx, key, shared, sharedRequest, callUnary)
+	}
+	c.mu.Unlock()
+	select {
+	case <-shared.done:
+		return c.result(shared)
+	case <-ctx.Done():
+		c.mu.Lock()
+		shared.waiters--
+		if shared.waiters == 0 {
+			c.forget(key, shared)
+			shared.cancel()
+		}
+		c.mu.Unlock()
+		return nil, wrapIfContextError(ctx.Err())
+	}
+}
+
+func (c *unaryCoalescer[Req, Res]) run(
+	ctx context.Context,
+	key string,
+	shared *coalescedCall[Res],
+	request *Request[Req],
+	callUnary func(context.Context, *Request[Req]) (*Response[Res], error),
+) {
+	defer shared.cancel()
+	response, err := callUnary(ctx, request)
+	if err == nil {
+		// Keep the message serialized, so that each caller can have a copy of
+		// its own.
+		shared.payload, err = c.codec.Marshal(response.Msg)
+		if err != nil {
+			err = errorf(CodeInternal, "marshal coalesced response: %w", err)
+		}
+		shared.header = response.Header()
+		shared.trailer = response.Trailer()
+	}
+	shared.err = err
+	c.mu.Lock()
+	c.forget(key, shared)
+	c.mu.Unlock()
+	close(shared.done)
+}
+
+// result returns a caller's copy of a shared call's result.
+func (c *unaryCoalescer[Req, Res]) result(shared *coalescedCall[Res]) (*Response[Res], error) {
+	if shared.err != nil {
+		return nil, cloneError(shared.err)
+	}
+	var msg Res
+	if err := c.initialize(&msg); err != nil {
+		return nil, NewError(CodeInternal, err)
+	}
+	if err := c.codec.Unmarshal(shared.payload, &msg); err != nil {
+		return nil, errorf(CodeInternal, "unmarshal coalesced response: %w", err)
+	}
+	return &Response[Res]{
+		Msg:     &msg,
+		header:  shared.header.Clone(),
+		trailer: shared.trailer.Clone(),
+	}, nil
+}
+
+// forget stops new callers from joining a shared call. The caller must hold
+// the mutex.
+func (c *unaryCoalescer[Req, Res]) forget(key string, shared *coalescedCall[Res]) {
+	if c.calls[key] == shared {
+		delete(c.calls, key)
+	}
+}
+
+// key identifies calls that can share a round-trip: their messages serialize
+// to the same bytes, and they have the same values for the selected headers.
+func (c *unaryCoalescer[Req, Res]) key(request *Request[Req]) (string, error) {
+	data, err := c.codec.MarshalStable(request.Msg)
+	if err != nil {
+		return "", err
+	}
+	var key strings.Builder
+	key.WriteString(strconv.Itoa(len(data)))
+	key.WriteByte(':')
+	key.Write(data)
+	for _, name := range c.headers {
+		key.WriteByte(0)
+		for _, value := range request.Header()[name] {
+			key.WriteByte(0)
+			key.WriteString(value)
+		}
+	}
+	return key.String(), nil
+}
+
+// cloneRequest copies a request's message and headers, so that a shared
+// round-trip doesn't touch the request of the caller that started it. It
+// reports false if the message isn't a Protobuf message.
+func cloneRequest[Req any](request *Request[Req]) (*Request[Req], bool) {
+	protoMessage, ok := any(request.Msg).(proto.Message)
+	if !ok {
+		return nil, false
+	}
+	msg, ok := any(proto.Clone(protoMessage)).(*Req)
+	if !ok {
+		return nil, false
+	}
+	clone := NewRequest(msg)
+	clone.header = request.Header().Clone()
+	return clone, true
+}
+
+// cloneError copies an *Error, so that callers sharing a round-trip can't
+// mutate each other's metadata. Other errors are returned as-is.
+func cloneError(err error) error {
+	connectErr, ok := asError(err)
+	if !ok {
+		return err
+	}
+	clone := *connectErr
+	clone.details = append([]*ErrorDetail(nil), connectErr.details...)
+	clone.meta = connectErr.meta.Clone()
+	return &clone
+}
+
+// detachedContext keeps the values of its parent, but not its deadline or
+// cancellation.
+type detachedContext struct {
+	parent context.Context //nolint:containedctx
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
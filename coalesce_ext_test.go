@@ -0,0 +1,186 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestRequestCoalescing(t *testing.T) {
+	t.Parallel()
+	// newServer starts a server whose Ping procedure counts its calls in hits,
+	// signals hit if it isn't nil, and waits for the returned function to be
+	// called before responding.
+	newServer := func(t *testing.T, hits *atomic.Int64, hit chan<- struct{}) (*httptest.Server, func()) {
+		t.Helper()
+		released := make(chan struct{})
+		var once sync.Once
+		release := func() { once.Do(func() { close(released) }) }
+		server := newPingServer(t, &pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				calls := hits.Add(1)
+				select {
+				case hit <- struct{}{}:
+				default:
+				}
+				select {
+				case <-released:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				response := connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number})
+				response.Header().Set("Hits", strconv.FormatInt(calls, 10))
+				return response, nil
+			},
+		})
+		t.Cleanup(release)
+		return server, release
+	}
+	t.Run("shared", func(t *testing.T) {
+		t.Parallel()
+		var hits atomic.Int64
+		server, release := newServer(t, &hits, nil)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRequestCoalescing())
+		const callers = 10
+		responses := make([]*connect.Response[pingv1_test.PingResponse], callers)
+		var started, finished sync.WaitGroup
+		for i := 0; i < callers; i++ {
+			i := i
+			started.Add(1)
+			finished.Add(1)
+			go func() {
+				defer finished.Done()
+				started.Done()
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42}))
+				assert.Nil(t, err)
+				responses[i] = response
+			}()
+		}
+		started.Wait()
+		time.Sleep(100 * time.Millisecond) // let the callers join
+		release()
+		finished.Wait()
+		assert.Equal(t, hits.Load(), int64(1))
+		for _, response := range responses {
+			assert.Equal(t, response.Msg.Number, 42)
+			assert.Equal(t, response.Header().Get("Hits"), "1")
+		}
+		// Each caller has a copy of its own.
+		responses[0].Msg.Number = 0
+		responses[0].Header().Set("Hits", "0")
+		assert.Equal(t, responses[1].Msg.Number, 42)
+		assert.Equal(t, responses[1].Header().Get("Hits"), "1")
+	})
+	t.Run("different_messages", func(t *testing.T) {
+		t.Parallel()
+		var hits atomic.Int64
+		server, release := newServer(t, &hits, nil)
+		release()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRequestCoalescing())
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			number := int64(i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: number}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.Number, number)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, hits.Load(), int64(2))
+	})
+	t.Run("selected_headers", func(t *testing.T) {
+		t.Parallel()
+		var hits atomic.Int64
+		server, release := newServer(t, &hits, nil)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRequestCoalescing("Tenant"))
+		var wg sync.WaitGroup
+		for _, tenant := range []string{"a", "a", "b"} {
+			request := connect.NewRequest(&pingv1_test.PingRequest{})
+			request.Header().Set("Tenant", tenant)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+			}()
+		}
+		time.Sleep(100 * time.Millisecond) // let the callers join
+		release()
+		wg.Wait()
+		assert.Equal(t, hits.Load(), int64(2))
+	})
+	t.Run("cancellation", func(t *testing.T) {
+		t.Parallel()
+		var hits atomic.Int64
+		hit := make(chan struct{}, 1)
+		server, release := newServer(t, &hits, hit)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRequestCoalescing())
+		ctx, cancel := context.WithCancel(context.Background())
+		canceled := make(chan error, 1)
+		request := connect.NewRequest(&pingv1_test.PingRequest{Number: 1})
+		go func() {
+			_, err := client.Ping(ctx, request)
+			canceled <- err
+		}()
+		select {
+		case <-hit:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a call")
+		}
+		waiting := make(chan error, 1)
+		go func() {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1}))
+			waiting <- err
+		}()
+		time.Sleep(100 * time.Millisecond) // let the second caller join
+		cancel()
+		assert.Equal(t, connect.CodeOf(<-canceled), connect.CodeCanceled)
+		// The shared round-trip doesn't use the canceled caller's request, so the
+		// caller is free to reuse it.
+		assert.Equal(t, len(request.Header()), 0)
+		request.Msg.Number = 2
+		release()
+		assert.Nil(t, <-waiting)
+		assert.Equal(t, hits.Load(), int64(1))
+	})
+	t.Run("call_options", func(t *testing.T) {
+		t.Parallel()
+		var hits atomic.Int64
+		server, release := newServer(t, &hits, nil)
+		release()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRequestCoalescing())
+		_, err := client.Ping(
+			context.Background(),
+			connect.NewRequest(&pingv1_test.PingRequest{}),
+			connect.WithCallTimeout(time.Minute),
+		)
+		assert.Nil(t, err)
+		assert.Equal(t, hits.Load(), int64(1))
+	})
+}
@@ -15,6 +15,8 @@
 package connect
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 
 	"google.golang.org/protobuf/encoding/protojson"
@@ -49,9 +51,26 @@ type Codec interface {
 	Unmarshal([]byte, any) error
 }
 
+// stableCodec is an extension to Codec for codecs that can marshal messages
+// deterministically. Connect clients can only send GET requests with stable
+// codecs, since otherwise equivalent requests may produce different URLs and
+// defeat caching.
+type stableCodec interface {
+	Codec
+
+	// MarshalStable marshals the given message with stable output: for a given
+	// codec version, marshaling the same value always produces the same bytes.
+	// The output isn't guaranteed to be canonical.
+	MarshalStable(any) ([]byte, error)
+
+	// IsBinary reports whether the marshaled data is binary. If it returns
+	// false, the output of MarshalStable is valid text.
+	IsBinary() bool
+}
+
 type protoBinaryCodec struct{}
 
-var _ Codec = (*protoBinaryCodec)(nil)
+var _ stableCodec = (*protoBinaryCodec)(nil)
 
 func (c *protoBinaryCodec) Name() string { return codecNameProto }
 
@@ -71,11 +90,26 @@ func (c *protoBinaryCodec) Unmarshal(data []byte, message any) error {
 	return proto.Unmarshal(data, protoMessage)
 }
 
+func (c *protoBinaryCodec) MarshalStable(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, errNotProto(message)
+	}
+	// Deterministic marshaling sorts map keys, but it's still not canonical:
+	// unknown fields, for example, are written in the order they were parsed.
+	options := proto.MarshalOptions{Deterministic: true}
+	return options.Marshal(protoMessage)
+}
+
+func (c *protoBinaryCodec) IsBinary() bool {
+	return true
+}
+
 type protoJSONCodec struct {
 	name string
 }
 
-var _ Codec = (*protoJSONCodec)(nil)
+var _ stableCodec = (*protoJSONCodec)(nil)
 
 func (c *protoJSONCodec) Name() string { return c.name }
 
@@ -97,6 +131,24 @@ func (c *protoJSONCodec) Unmarshal(binary []byte, message any) error {
 	return options.Unmarshal(binary, protoMessage)
 }
 
+func (c *protoJSONCodec) MarshalStable(message any) ([]byte, error) {
+	// protojson orders fields consistently, but it deliberately randomizes
+	// whitespace. Compacting the output removes the randomness.
+	data, err := c.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	compacted := bytes.NewBuffer(make([]byte, 0, len(data)))
+	if err := json.Compact(compacted, data); err != nil {
+		return nil, err
+	}
+	return compacted.Bytes(), nil
+}
+
+func (c *protoJSONCodec) IsBinary() bool {
+	return false
+}
+
 // readOnlyCodecs is a read-only interface to a map of named codecs.
 type readOnlyCodecs interface {
 	// Get gets the Codec with the given name.
@@ -164,6 +164,8 @@ func (c *compressionPool) putCompressor(compressor Compressor) error {
 type readOnlyCompressionPools interface {
 	Get(string) *compressionPool
 	Contains(string) bool
+	// Names returns a copy of the registered names, most preferred first.
+	Names() []string
 	// Wordy, but clarifies how this is different from readOnlyCodecs.Names().
 	CommaSeparatedNames() string
 }
@@ -186,12 +188,14 @@ func newReadOnlyCompressionPools(
 	}
 	return &namedCompressionPools{
 		nameToPool:          nameToPool,
+		names:               names,
 		commaSeparatedNames: strings.Join(names, ","),
 	}
 }
 
 type namedCompressionPools struct {
 	nameToPool          map[string]*compressionPool
+	names               []string
 	commaSeparatedNames string
 }
 
@@ -207,6 +211,47 @@ func (m *namedCompressionPools) Contains(name string) bool {
 	return ok
 }
 
+func (m *namedCompressionPools) Names() []string {
+	return append([]string(nil), m.names...)
+}
+
 func (m *namedCompressionPools) CommaSeparatedNames() string {
 	return m.commaSeparatedNames
 }
+
+// compressWith compresses src into dst with the named compression pool. The
+// identity compression copies src.
+func compressWith(pools readOnlyCompressionPools, name string, dst, src *bytes.Buffer) error {
+	if name == "" || name == compressionIdentity {
+		_, err := dst.ReadFrom(src)
+		return err
+	}
+	pool := pools.Get(name)
+	if pool == nil {
+		return errorf(CodeInternal, "unknown compression %q", name)
+	}
+	if err := pool.Compress(dst, src); err != nil {
+		return err
+	}
+	return nil
+}
+
+// decompressWith decompresses src into dst with the named compression pool.
+// The identity compression copies src.
+func decompressWith(pools readOnlyCompressionPools, name string, dst, src *bytes.Buffer, readMaxBytes int) error {
+	if name == "" || name == compressionIdentity {
+		if readMaxBytes > 0 && src.Len() > readMaxBytes {
+			return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", src.Len(), readMaxBytes)
+		}
+		_, err := dst.ReadFrom(src)
+		return err
+	}
+	pool := pools.Get(name)
+	if pool == nil {
+		return errorf(CodeInvalidArgument, "unknown compression %q", name)
+	}
+	if err := pool.Decompress(dst, src, int64(readMaxBytes)); err != nil {
+		return err
+	}
+	return nil
+}
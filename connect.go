@@ -272,9 +272,11 @@ type HTTPClient interface {
 
 // Spec is a description of a client call or a handler invocation.
 type Spec struct {
-	StreamType StreamType
-	Procedure  string // for example, "/acme.foo.v1.FooService/Bar"
-	IsClient   bool   // otherwise we're in a handler
+	StreamType       StreamType
+	Procedure        string // for example, "/acme.foo.v1.FooService/Bar"
+	IsClient         bool   // otherwise we're in a handler
+	IdempotencyLevel IdempotencyLevel
+	Schema           any // for example, a protoreflect.MethodDescriptor; may be nil
 }
 
 // Peer describes the other party to an RPC.
@@ -284,11 +286,16 @@ type Spec struct {
 // in IP:port format.
 //
 // On both the client and the server, Protocol is the RPC protocol in use.
-// Currently, it's either [ProtocolConnect], [ProtocolGRPC], or
-// [ProtocolGRPCWeb], but additional protocols may be added in the future.
+// Currently, it's one of [ProtocolConnect], [ProtocolGRPC], [ProtocolGRPCWeb],
+// [ProtocolTwirp], or [ProtocolHTTPJSON], but additional protocols may be
+// added in the future.
+//
+// On the server, Query contains the URL query parameters of Connect GET
+// requests. It's nil otherwise.
 type Peer struct {
 	Addr     string
 	Protocol string
+	Query    url.Values // server-only
 }
 
 func newPeerFromURL(urlString, protocol string) Peer {
@@ -299,14 +306,6 @@ func newPeerFromURL(urlString, protocol string) Peer {
 	return peer
 }
 
-// handlerConnCloser extends HandlerConn with a method for handlers to
-// terminate the message exchange (and optionally send an error to the client).
-type handlerConnCloser interface {
-	StreamingHandlerConn
-
-	Close(error) error
-}
-
 // receiveUnaryResponse unmarshals a message from a StreamingClientConn, then
 // envelopes the message and attaches headers and trailers. It attempts to
 // consume the response stream and isn't appropriate when receiving multiple
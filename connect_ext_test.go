@@ -19,6 +19,7 @@ import (
 	"compress/flate"
 	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -27,6 +28,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"sync"
 	"testing"
@@ -2018,6 +2020,239 @@ func TestHandlerReturnsNilResponse(t *testing.T) {
 	assert.Equal(t, panics, 2)
 }
 
+func TestConnectHTTPGet(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect_test.PingServiceName + "/Ping"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		pingServer{}.Ping,
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+	))
+	var lastMethod string // subtests run sequentially
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastMethod = r.Method
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	largeText := strings.Repeat("a", 1024)
+	tests := []struct {
+		name       string
+		options    []connect.ClientOption
+		text       string
+		wantMethod string
+		wantCode   connect.Code
+	}{
+		{
+			name:       "proto",
+			text:       "foo",
+			wantMethod: http.MethodGet,
+		},
+		{
+			name:       "json",
+			options:    []connect.ClientOption{connect.WithProtoJSON()},
+			text:       "foo",
+			wantMethod: http.MethodGet,
+		},
+		{
+			name:       "compressed",
+			options:    []connect.ClientOption{connect.WithSendGzip(), connect.WithHTTPGetMaxURLSize(512, false)},
+			text:       largeText,
+			wantMethod: http.MethodGet,
+		},
+		{
+			name:       "fallback",
+			options:    []connect.ClientOption{connect.WithHTTPGetMaxURLSize(512, true)},
+			text:       largeText,
+			wantMethod: http.MethodPost,
+		},
+		{
+			name:     "too_large",
+			options:  []connect.ClientOption{connect.WithHTTPGetMaxURLSize(512, false)},
+			text:     largeText,
+			wantCode: connect.CodeResourceExhausted,
+		},
+		{
+			name:     "unstable_codec",
+			options:  []connect.ClientOption{connect.WithCodec(failCodec{})},
+			text:     "foo",
+			wantCode: connect.CodeUnknown,
+		},
+		{
+			name:       "unstable_codec_fallback",
+			options:    []connect.ClientOption{connect.WithCodec(unstableCodec{}), connect.WithHTTPGetMaxURLSize(0, true)},
+			text:       "foo",
+			wantMethod: http.MethodPost,
+		},
+	}
+	for _, testCase := range tests {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			options := append([]connect.ClientOption{
+				connect.WithHTTPGet(),
+				connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+			}, testCase.options...)
+			client := connect.NewClient[pingv1_test.PingRequest, pingv1_test.PingResponse](
+				server.Client(),
+				server.URL+procedure,
+				options...,
+			)
+			lastMethod = ""
+			request := connect.NewRequest(&pingv1_test.PingRequest{Number: 42, Text: testCase.text})
+			response, err := client.CallUnary(context.Background(), request)
+			if testCase.wantCode != 0 {
+				assert.Equal(t, connect.CodeOf(err), testCase.wantCode)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, lastMethod, testCase.wantMethod)
+			assert.Equal(t, response.Msg.Number, 42)
+			assert.Equal(t, response.Msg.Text, testCase.text)
+		})
+	}
+}
+
+func TestConnectHTTPGetHandler(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	get := func(t *testing.T, method string, query url.Values) *http.Response {
+		t.Helper()
+		target := server.URL + "/" + pingv1connect_test.PingServiceName + "/" + method + "?" + query.Encode()
+		request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target, http.NoBody)
+		assert.Nil(t, err)
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = response.Body.Close() })
+		return response
+	}
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		response := get(t, "Ping", url.Values{
+			"connect":  []string{"v1"},
+			"encoding": []string{"json"},
+			"message":  []string{`{"number":"42"}`},
+		})
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, string(body), `{"number":"42"}`)
+	})
+	t.Run("base64", func(t *testing.T) {
+		t.Parallel()
+		data, err := proto.Marshal(&pingv1_test.PingRequest{Number: 42})
+		assert.Nil(t, err)
+		response := get(t, "Ping", url.Values{
+			"encoding": []string{"proto"},
+			"base64":   []string{"1"},
+			"message":  []string{base64.URLEncoding.EncodeToString(data)},
+		})
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		var msg pingv1_test.PingResponse
+		assert.Nil(t, proto.Unmarshal(body, &msg))
+		assert.Equal(t, msg.Number, 42)
+	})
+	t.Run("missing_message", func(t *testing.T) {
+		t.Parallel()
+		response := get(t, "Ping", url.Values{"encoding": []string{"json"}})
+		assert.Equal(t, response.StatusCode, http.StatusBadRequest)
+	})
+	t.Run("unknown_encoding", func(t *testing.T) {
+		t.Parallel()
+		response := get(t, "Ping", url.Values{
+			"encoding": []string{"xml"},
+			"message":  []string{"<number>42</number>"},
+		})
+		assert.Equal(t, response.StatusCode, http.StatusUnsupportedMediaType)
+	})
+	t.Run("streaming", func(t *testing.T) {
+		t.Parallel()
+		response := get(t, "CountUp", url.Values{
+			"encoding": []string{"json"},
+			"message":  []string{`{"number":"1"}`},
+		})
+		assert.Equal(t, response.StatusCode, http.StatusMethodNotAllowed)
+		assert.Equal(t, response.Header.Get("Allow"), http.MethodPost)
+	})
+}
+
+func TestConnectHTTPGetRequiresIdempotency(t *testing.T) {
+	t.Parallel()
+	var methods []string // requests are sequential
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	// Fail doesn't declare an idempotency level, so clients keep using POST
+	// and handlers reject GET.
+	client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHTTPGet())
+	_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1_test.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, methods, []string{http.MethodPost, http.MethodGet})
+
+	request, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodGet,
+		server.URL+"/"+pingv1connect_test.PingServiceName+"/Fail?encoding=json&message={}",
+		http.NoBody,
+	)
+	assert.Nil(t, err)
+	response, err := server.Client().Do(request)
+	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Equal(t, response.StatusCode, http.StatusMethodNotAllowed)
+	assert.Equal(t, response.Header.Get("Allow"), http.MethodPost)
+}
+
+func TestGeneratedIdempotencyLevel(t *testing.T) {
+	t.Parallel()
+	levels := make(map[string]connect.IdempotencyLevel)
+	var mu sync.Mutex
+	record := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			mu.Lock()
+			side := "handler"
+			if request.Spec().IsClient {
+				side = "client"
+			}
+			levels[side+request.Spec().Procedure] = request.Spec().IdempotencyLevel
+			mu.Unlock()
+			return next(ctx, request)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(pingServer{}, connect.WithInterceptors(record)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithInterceptors(record))
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+	assert.Nil(t, err)
+	_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1_test.FailRequest{}))
+	assert.NotNil(t, err)
+
+	const prefix = "/" + pingv1connect_test.PingServiceName
+	assert.Equal(t, levels, map[string]connect.IdempotencyLevel{
+		"client" + prefix + "/Ping":  connect.IdempotencyNoSideEffects,
+		"handler" + prefix + "/Ping": connect.IdempotencyNoSideEffects,
+		"client" + prefix + "/Fail":  connect.IdempotencyUnknown,
+		"handler" + prefix + "/Fail": connect.IdempotencyUnknown,
+	})
+}
+
 // TestBlankImportCodeGeneration tests that services.connect.go is generated with
 // blank import statements to services.pb.go so that the service's Descriptor is
 // available in the global proto registry.
@@ -2066,6 +2301,43 @@ func (c failCodec) Unmarshal(data []byte, message any) error {
 	return proto.Unmarshal(data, protoMessage)
 }
 
+// unstableCodec is a Protobuf codec that can't marshal messages
+// deterministically.
+type unstableCodec struct{}
+
+func (c unstableCodec) Name() string {
+	return "proto"
+}
+
+func (c unstableCodec) Marshal(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("not protobuf: %T", message)
+	}
+	return proto.Marshal(protoMessage)
+}
+
+func (c unstableCodec) Unmarshal(data []byte, message any) error {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return fmt.Errorf("not protobuf: %T", message)
+	}
+	return proto.Unmarshal(data, protoMessage)
+}
+
+// newPingServer serves the ping service over HTTP/2 with TLS, until the test
+// ends.
+func newPingServer(tb testing.TB, handler pingv1connect_test.PingServiceHandler, options ...connect.HandlerOption) *httptest.Server {
+	tb.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(handler, options...))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	tb.Cleanup(server.Close)
+	return server
+}
+
 type pluggablePingServer struct {
 	pingv1connect_test.UnimplementedPingServiceHandler
 
@@ -0,0 +1,230 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connecthttp2 builds HTTP clients and servers that speak HTTP/2 to
+// Connect, gRPC, and gRPC-Web peers, with or without TLS.
+//
+//	server, err := connecthttp2.NewServer("localhost:8080", mux, connecthttp2.Options{})
+//	httpClient := connecthttp2.NewClient(connecthttp2.Options{})
+package connecthttp2
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	defaultPingInterval         = 30 * time.Second
+	defaultPingTimeout          = 15 * time.Second
+	defaultDialTimeout          = 30 * time.Second
+	defaultMaxConcurrentStreams = 250
+	defaultIdleTimeout          = 5 * time.Minute
+	defaultReadHeaderTimeout    = 10 * time.Second
+)
+
+// Options configures the clients and servers built by [NewClient] and
+// [NewServer]. The zero value uses HTTP/2 without TLS (h2c) and the
+// defaults described on each field.
+type Options struct {
+	// TLSConfig enables TLS, negotiating HTTP/2 with ALPN. If it's nil, clients
+	// and servers use HTTP/2 over cleartext TCP (h2c). Servers also need a
+	// certificate: either set one in TLSConfig or pass the files to
+	// [http.Server.ListenAndServeTLS].
+	TLSConfig *tls.Config
+	// PingInterval is how long a client connection may go without receiving
+	// any frames before the client sends an HTTP/2 PING to check that it's
+	// still alive. This keeps long-lived, quiet streams from silently hanging
+	// when a connection breaks. It defaults to 30 seconds; negative values
+	// disable pings.
+	PingInterval time.Duration
+	// PingTimeout is how long a client waits for a response to a PING before
+	// closing the connection. It defaults to 15 seconds.
+	PingTimeout time.Duration
+	// DialTimeout bounds how long a client takes to establish a connection,
+	// including any TLS handshake. It defaults to 30 seconds.
+	DialTimeout time.Duration
+	// DialContext, if set, opens the client's connections instead of a
+	// [net.Dialer]. With TLSConfig, the client performs the TLS handshake over
+	// the connections it returns.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// MaxConcurrentStreams is the number of concurrent streams the server
+	// allows on each connection; clients built by [NewClient] open more
+	// connections when they need more streams. It only applies to servers and
+	// defaults to 250.
+	MaxConcurrentStreams uint32
+	// IdleTimeout is how long the server keeps idle connections open. It
+	// defaults to 5 minutes.
+	IdleTimeout time.Duration
+	// ReadHeaderTimeout is how long the server allows for reading request
+	// headers. It defaults to 10 seconds.
+	ReadHeaderTimeout time.Duration
+}
+
+// NewClient constructs an [http.Client] that speaks HTTP/2 to Connect,
+// gRPC, and gRPC-Web servers, so all three protocols support every kind of
+// stream, including bidirectional streams. Unlike [http.DefaultClient], it
+// uses HTTP/2 even without TLS, and it checks the health of quiet connections
+// with PINGs; see [Options]. It doesn't speak HTTP/1.1.
+//
+// The client has no overall timeout, since that would cut streams short; use
+// context deadlines or connect.WithDefaultTimeout instead.
+func NewClient(options Options) *http.Client {
+	options = options.withDefaults()
+	dial := options.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport := &http2.Transport{
+		ReadIdleTimeout: options.PingInterval,
+		PingTimeout:     options.PingTimeout,
+	}
+	if options.PingInterval < 0 {
+		transport.ReadIdleTimeout = 0
+	}
+	transport.AllowHTTP = options.TLSConfig == nil
+	if options.TLSConfig != nil {
+		transport.TLSClientConfig = options.TLSConfig.Clone()
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, options.DialTimeout)
+		defer cancel()
+		conn, err := dial(ctx, network, addr)
+		if err != nil || options.TLSConfig == nil {
+			return conn, err
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return &http.Client{Transport: &http2RoundTripper{Transport: transport}}
+}
+
+// http2RoundTripper closes request bodies when their contexts end. While a
+// request body is open, http2.Transport only notices cancelation between
+// reads of the body, so without this, servers wouldn't learn that a
+// bidirectional stream was canceled until the client sent another message or
+// closed the response.
+type http2RoundTripper struct {
+	*http2.Transport
+}
+
+func (t *http2RoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return t.Transport.RoundTrip(request)
+	}
+	body := &cancelableBody{ReadCloser: request.Body, done: make(chan struct{})}
+	request = request.WithContext(request.Context()) // shallow copy
+	request.Body = body
+	go func() {
+		select {
+		case <-request.Context().Done():
+			// Like net/http's transports, we may close the body while it's
+			// being read.
+			_ = body.Close()
+		case <-body.done:
+		}
+	}()
+	return t.Transport.RoundTrip(request)
+}
+
+// cancelableBody is a request body that may be closed concurrently with
+// reads. Its done channel is closed once the body has been fully read or
+// closed.
+type cancelableBody struct {
+	io.ReadCloser
+
+	done      chan struct{}
+	doneOnce  sync.Once
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (b *cancelableBody) Read(data []byte) (int, error) {
+	n, err := b.ReadCloser.Read(data)
+	if err != nil {
+		b.doneOnce.Do(func() { close(b.done) })
+	}
+	return n, err
+}
+
+func (b *cancelableBody) Close() error {
+	b.doneOnce.Do(func() { close(b.done) })
+	b.closeOnce.Do(func() { b.closeErr = b.ReadCloser.Close() })
+	return b.closeErr
+}
+
+// NewServer constructs an [http.Server] that serves HTTP/2 and HTTP/1.1
+// to Connect, gRPC, and gRPC-Web clients. Without TLS, it accepts HTTP/2
+// over cleartext TCP (h2c) as many gRPC clients expect; with TLS, it
+// negotiates HTTP/2 with ALPN. It also limits concurrent streams and applies
+// idle and read-header timeouts; see [Options].
+//
+// The server has no read or write timeouts, since they would cut streams
+// short; use connect.WithMaxTimeout to bound RPCs instead. Start the server
+// with ListenAndServe, or ListenAndServeTLS if options.TLSConfig is set.
+func NewServer(addr string, handler http.Handler, options Options) (*http.Server, error) {
+	options = options.withDefaults()
+	http2Server := &http2.Server{
+		MaxConcurrentStreams: options.MaxConcurrentStreams,
+		IdleTimeout:          options.IdleTimeout,
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		IdleTimeout:       options.IdleTimeout,
+	}
+	if options.TLSConfig == nil {
+		server.Handler = h2c.NewHandler(handler, http2Server)
+		return server, nil
+	}
+	server.TLSConfig = options.TLSConfig.Clone()
+	if err := http2.ConfigureServer(server, http2Server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+func (o Options) withDefaults() Options {
+	if o.PingInterval == 0 {
+		o.PingInterval = defaultPingInterval
+	}
+	if o.PingTimeout <= 0 {
+		o.PingTimeout = defaultPingTimeout
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = defaultDialTimeout
+	}
+	if o.MaxConcurrentStreams == 0 {
+		o.MaxConcurrentStreams = defaultMaxConcurrentStreams
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = defaultIdleTimeout
+	}
+	if o.ReadHeaderTimeout <= 0 {
+		o.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	return o
+}
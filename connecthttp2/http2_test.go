@@ -0,0 +1,128 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connecthttp2_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/connecthttp2"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1 "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestHTTP2(t *testing.T) {
+	t.Parallel()
+	sum := func(t *testing.T, client pingv1connect.PingServiceClient) {
+		t.Helper()
+		stream := client.CumSum(context.Background())
+		for i, total := int64(1), int64(0); i <= 3; i++ {
+			total += i
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: i}))
+			response, err := stream.Receive()
+			assert.Nil(t, err)
+			assert.Equal(t, response.Sum, total)
+		}
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+	}
+	t.Run("h2c", func(t *testing.T) {
+		t.Parallel()
+		url := startHTTP2Server(t, connecthttp2.Options{})
+		httpClient := connecthttp2.NewClient(connecthttp2.Options{})
+		sum(t, pingv1connect.NewPingServiceClient(httpClient, url))
+		sum(t, pingv1connect.NewPingServiceClient(httpClient, url, connect.WithGRPC()))
+		sum(t, pingv1connect.NewPingServiceClient(httpClient, url, connect.WithGRPCWeb()))
+	})
+	t.Run("tls", func(t *testing.T) {
+		t.Parallel()
+		serverConfig, clientConfig := newHTTP2TLSConfigs(t)
+		url := startHTTP2Server(t, connecthttp2.Options{TLSConfig: serverConfig})
+		httpClient := connecthttp2.NewClient(connecthttp2.Options{TLSConfig: clientConfig})
+		sum(t, pingv1connect.NewPingServiceClient(httpClient, url))
+		sum(t, pingv1connect.NewPingServiceClient(httpClient, url, connect.WithGRPC()))
+	})
+	t.Run("pings_disabled", func(t *testing.T) {
+		t.Parallel()
+		url := startHTTP2Server(t, connecthttp2.Options{})
+		httpClient := connecthttp2.NewClient(connecthttp2.Options{PingInterval: -1})
+		sum(t, pingv1connect.NewPingServiceClient(httpClient, url))
+	})
+}
+
+// startHTTP2Server serves the ping service with NewServer on a local
+// port, and returns its URL.
+func startHTTP2Server(tb testing.TB, options connecthttp2.Options) string {
+	tb.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pingServer{}))
+	server, err := connecthttp2.NewServer("127.0.0.1:0", mux, options)
+	assert.Nil(tb, err)
+	listener, err := net.Listen("tcp", server.Addr)
+	assert.Nil(tb, err)
+	scheme := "http"
+	if options.TLSConfig != nil {
+		scheme = "https"
+		go func() { _ = server.ServeTLS(listener, "", "") }()
+	} else {
+		go func() { _ = server.Serve(listener) }()
+	}
+	tb.Cleanup(func() { _ = server.Close() })
+	return scheme + "://" + listener.Addr().String()
+}
+
+// newHTTP2TLSConfigs borrows httptest's self-signed certificate, which is
+// valid for 127.0.0.1.
+func newHTTP2TLSConfigs(tb testing.TB) (*tls.Config, *tls.Config) {
+	tb.Helper()
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.StartTLS()
+	defer server.Close()
+	transport, ok := server.Client().Transport.(*http.Transport)
+	assert.True(tb, ok)
+	serverConfig := &tls.Config{
+		Certificates: server.TLS.Certificates,
+		MinVersion:   tls.VersionTLS12,
+	}
+	return serverConfig, transport.TLSClientConfig.Clone()
+}
+
+type pingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (*pingServer) CumSum(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+	var sum int64
+	for {
+		msg, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		sum += msg.Number
+		if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connecttest
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+const (
+	network = "memory"
+	address = "in-memory"
+)
+
+// Listener is a [net.Listener] for in-memory connections. Each call to
+// DialContext creates a synchronous, full-duplex connection with [net.Pipe],
+// and hands the server's end to Accept. No ports are involved.
+type Listener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	open map[net.Conn]struct{}
+}
+
+// NewListener constructs a Listener.
+func NewListener() *Listener {
+	return &Listener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+		open:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Accept waits for and returns the server's end of the next connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// DialContext connects to the listener. The network and address are ignored,
+// so it can be used as the dialer for any transport.
+func (l *Listener) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	server, client := l.pipe()
+	if server == nil {
+		return nil, net.ErrClosed
+	}
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		_ = server.Close()
+		_ = client.Close()
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		_ = server.Close()
+		_ = client.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the listener from accepting new connections. Like other
+// listeners, it leaves existing connections open.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+// CloseConnections closes the listener and all its connections, including
+// those already accepted. net/http doesn't track connections taken over for
+// HTTP/2 without TLS, so closing an [http.Server] alone leaves them open.
+func (l *Listener) CloseConnections() {
+	_ = l.Close()
+	l.mu.Lock()
+	open := l.open
+	l.open = nil
+	l.mu.Unlock()
+	for conn := range open {
+		_ = conn.Close()
+	}
+}
+
+// Addr returns the listener's address.
+func (l *Listener) Addr() net.Addr {
+	return memoryAddr{}
+}
+
+// pipe creates a pair of tracked connections, or returns nils if the listener
+// is closed.
+func (l *Listener) pipe() (net.Conn, net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.closed:
+		return nil, nil
+	default:
+	}
+	serverEnd, clientEnd := net.Pipe()
+	server := &trackedConn{Conn: serverEnd, listener: l}
+	client := &trackedConn{Conn: clientEnd, listener: l}
+	l.open[server] = struct{}{}
+	l.open[client] = struct{}{}
+	return server, client
+}
+
+func (l *Listener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.open, conn) // no-op if closed
+}
+
+// trackedConn forgets itself when it's closed, so long-lived listeners don't
+// accumulate connections.
+type trackedConn struct {
+	net.Conn
+
+	listener *Listener
+}
+
+func (c *trackedConn) Close() error {
+	c.listener.untrack(c)
+	return c.Conn.Close()
+}
+
+type memoryAddr struct{}
+
+func (memoryAddr) Network() string { return network }
+func (memoryAddr) String() string  { return address }
@@ -0,0 +1,124 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connecttest serves HTTP handlers over in-memory HTTP/2 connections,
+// for tests and same-process calls.
+//
+// Requests go through the same net/http and golang.org/x/net/http2 code as
+// they would over TCP, so bidirectional streaming, trailers, flushing, and
+// cancellation all behave as they do in production, but no ports are opened.
+package connecttest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/joshcarp/connect-no/connecthttp2"
+)
+
+// shutdownPollInterval is how often Shutdown checks for in-flight requests.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Server is an HTTP/2 server listening on an in-memory [Listener].
+type Server struct {
+	server   *http.Server
+	listener *Listener
+	client   *http.Client
+	active   atomic.Int64 // in-flight requests
+	done     chan struct{}
+	err      error // set before done is closed
+}
+
+// NewServer starts serving the handler over in-memory connections. Use the
+// server's Client to call it, and Close the server when you're done with it.
+func NewServer(handler http.Handler) *Server {
+	s := &Server{
+		listener: NewListener(),
+		done:     make(chan struct{}),
+	}
+	s.client = NewClient(s.listener)
+	// Without TLS, connecthttp2.NewServer can't fail.
+	s.server, _ = connecthttp2.NewServer(address, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.active.Add(1)
+		defer s.active.Add(-1)
+		handler.ServeHTTP(w, r)
+	}), connecthttp2.Options{})
+	go func() {
+		defer close(s.done)
+		if err := s.server.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			s.err = err
+		}
+	}()
+	return s
+}
+
+// NewClient constructs an HTTP client whose connections go to the listener,
+// whatever the URL's host. Like [connecthttp2.NewClient], it speaks HTTP/2
+// without TLS.
+func NewClient(listener *Listener) *http.Client {
+	return connecthttp2.NewClient(connecthttp2.Options{DialContext: listener.DialContext})
+}
+
+// URL returns the server's base URL. Any host would do, since the server's
+// Client always connects to the listener.
+func (s *Server) URL() string {
+	return "http://" + address
+}
+
+// Client returns an HTTP client that connects to the server.
+func (s *Server) Client() *http.Client {
+	return s.client
+}
+
+// Listener returns the server's listener, to dial it directly.
+func (s *Server) Listener() *Listener {
+	return s.listener
+}
+
+// Shutdown gracefully stops the server: it stops accepting connections and
+// waits for in-flight requests to finish, or for the context to end. It then
+// closes all connections.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for err == nil && s.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close immediately stops the server, closing all connections, and returns
+// any error from serving.
+func (s *Server) Close() error {
+	err := s.server.Close()
+	s.listener.CloseConnections()
+	s.client.CloseIdleConnections()
+	<-s.done
+	if err != nil {
+		return err
+	}
+	return s.err
+}
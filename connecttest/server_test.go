@@ -0,0 +1,138 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connecttest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/connecttest"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1 "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	newServer := func(t *testing.T, handler pingv1connect.PingServiceHandler) *connecttest.Server {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(handler))
+		server := connecttest.NewServer(mux)
+		t.Cleanup(func() { assert.Nil(t, server.Close()) })
+		return server
+	}
+	t.Run("protocols", func(t *testing.T) {
+		t.Parallel()
+		server := newServer(t, &pingServer{})
+		for _, options := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), options...)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 42)
+			assert.Equal(t, response.Trailer().Get("Ping-Trailer"), "42")
+
+			stream := client.CumSum(context.Background())
+			for i, sum := int64(1), int64(0); i <= 3; i++ {
+				sum += i
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: i}))
+				response, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, response.Sum, sum)
+			}
+			assert.Nil(t, stream.CloseRequest())
+			_, err = stream.Receive()
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Nil(t, stream.CloseResponse())
+		}
+	})
+	t.Run("cancelation", func(t *testing.T) {
+		t.Parallel()
+		handler := &pingServer{canceled: make(chan struct{})}
+		server := newServer(t, handler)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := client.CumSum(ctx)
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		_, err := stream.Receive()
+		assert.Nil(t, err)
+		cancel()
+		select {
+		case <-handler.canceled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler's context wasn't canceled")
+		}
+		_ = stream.CloseResponse()
+	})
+	t.Run("shutdown", func(t *testing.T) {
+		t.Parallel()
+		server := newServer(t, &pingServer{})
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		_, err := stream.Receive()
+		assert.Nil(t, err)
+		shutdown := make(chan error, 1)
+		go func() { shutdown <- server.Shutdown(context.Background()) }()
+		// The in-flight stream keeps working until it's done.
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+		response, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Sum, 3)
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+		assert.Nil(t, <-shutdown)
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	})
+}
+
+type pingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+
+	canceled chan struct{} // closed when a CumSum stream is canceled, if set
+}
+
+func (s *pingServer) Ping(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+	response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+	response.Trailer().Set("Ping-Trailer", strconv.FormatInt(request.Msg.Number, 10))
+	return response, nil
+}
+
+func (s *pingServer) CumSum(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+	var sum int64
+	for {
+		msg, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			if s.canceled != nil {
+				<-ctx.Done()
+				close(s.canceled)
+			}
+			return err
+		}
+		sum += msg.Number
+		if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+			return err
+		}
+	}
+}
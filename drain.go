@@ -0,0 +1,152 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// A Drainer gracefully stops handlers. Share one Drainer among all of a
+// server's handlers with [WithDrainer], and call Drain when shutting down.
+//
+// [http.Server.Shutdown] waits for every in-flight request to finish, so it
+// may wait forever on long-lived streams. Draining first gives streams a
+// chance to finish cleanly and then ends them with a proper error, so clients
+// can retry elsewhere:
+//
+//	server.RegisterOnShutdown(func() {
+//		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//		defer cancel()
+//		_ = drainer.Drain(ctx)
+//	})
+//
+// Drainers are safe to use concurrently.
+type Drainer struct {
+	draining  chan struct{}
+	drainOnce sync.Once
+
+	mu    sync.Mutex
+	calls map[*drainingCall]struct{}
+	idle  chan struct{} // closed when the last call finishes, if set
+}
+
+// NewDrainer constructs a Drainer.
+func NewDrainer() *Drainer {
+	return &Drainer{
+		draining: make(chan struct{}),
+		calls:    make(map[*drainingCall]struct{}),
+	}
+}
+
+// Drain starts draining. Handlers immediately reject new calls with
+// [CodeUnavailable], in the caller's protocol. Calls that are already in
+// flight keep running, and their contexts' [Draining] channels are closed, so
+// long-lived streams can wrap up.
+//
+// Drain waits for in-flight calls to finish. If the context ends first, Drain
+// cancels the remaining calls' contexts, closes their request bodies to
+// unblock any pending Receive, and returns the context's error. When those
+// calls return, they end with [CodeUnavailable], sent as a proper
+// end-of-stream message or gRPC trailers rather than a severed connection, so
+// handlers must return promptly when their context is canceled.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	// Closing under the lock ensures that begin can't register calls after
+	// we've checked for them.
+	d.drainOnce.Do(func() { close(d.draining) })
+	if len(d.calls) == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+	d.mu.Lock()
+	for call := range d.calls {
+		call.forced.Store(true)
+		call.cancel()
+		// Unblock handlers waiting for the next request message.
+		_ = call.body.Close()
+	}
+	d.mu.Unlock()
+	return ctx.Err()
+}
+
+// Draining returns a channel that's closed when the Drainer of the handler
+// serving the call starts draining. Long-lived streams should select on it
+// and finish cleanly. If the handler doesn't have a Drainer, Draining returns
+// a nil channel, which is never ready.
+func Draining(ctx context.Context) <-chan struct{} {
+	if drainer, ok := ctx.Value(drainerKey{}).(*Drainer); ok {
+		return drainer.draining
+	}
+	return nil
+}
+
+// begin registers a call, unless the drainer is draining. The body is the
+// request body, which Drain closes if it ends the call.
+func (d *Drainer) begin(ctx context.Context, body io.Closer) (context.Context, *drainingCall, *Error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.draining:
+		return nil, nil, errorf(CodeUnavailable, "server is shutting down")
+	default:
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, drainerKey{}, d))
+	call := &drainingCall{cancel: cancel, body: body}
+	d.calls[call] = struct{}{}
+	return ctx, call, nil
+}
+
+// end unregisters a call once its response is complete.
+func (d *Drainer) end(call *drainingCall) {
+	call.cancel()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.calls, call)
+	if len(d.calls) == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+type drainerKey struct{}
+
+type drainingCall struct {
+	cancel context.CancelFunc
+	body   io.Closer
+	forced atomic.Bool // ended by Drain
+}
+
+// finish replaces the error of a call ended by Drain, which is usually a
+// cancellation or a failure to read the closed request body, so clients know
+// that they may retry.
+func (c *drainingCall) finish(err error) error {
+	if err != nil && c.forced.Load() {
+		return errorf(CodeUnavailable, "server is shutting down")
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestDrainer(t *testing.T) {
+	t.Parallel()
+	drainer := connect.NewDrainer()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+			},
+			// CountUp sends one message, then finishes cleanly when draining starts.
+			countUp: func(ctx context.Context, request *connect.Request[pingv1_test.CountUpRequest], stream *connect.ServerStream[pingv1_test.CountUpResponse]) error {
+				if err := stream.Send(&pingv1_test.CountUpResponse{Number: 1}); err != nil {
+					return err
+				}
+				select {
+				case <-connect.Draining(ctx):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			},
+			// CumSum ignores draining, so it's ended after the grace period.
+			cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1_test.CumSumRequest, pingv1_test.CumSumResponse]) error {
+				var sum int64
+				for {
+					msg, err := stream.Receive()
+					if errors.Is(err, io.EOF) {
+						return nil
+					} else if err != nil {
+						return err
+					}
+					sum += msg.Number
+					if err := stream.Send(&pingv1_test.CumSumResponse{Sum: sum}); err != nil {
+						return err
+					}
+				}
+			},
+		},
+		connect.WithDrainer(drainer),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+	assert.Nil(t, err)
+	countUp, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1_test.CountUpRequest{}))
+	assert.Nil(t, err)
+	assert.True(t, countUp.Receive())
+	cumSum := client.CumSum(context.Background())
+	assert.Nil(t, cumSum.Send(&pingv1_test.CumSumRequest{Number: 1}))
+	_, err = cumSum.Receive()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	drained := make(chan error, 1)
+	go func() { drained <- drainer.Drain(ctx) }()
+
+	// CountUp notices that the server is draining and finishes cleanly.
+	assert.False(t, countUp.Receive())
+	assert.Nil(t, countUp.Err())
+	assert.Nil(t, countUp.Close())
+	// New calls are rejected.
+	for _, options := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, options...)
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	}
+	// CumSum is ended with an error once the grace period is over.
+	assert.ErrorIs(t, <-drained, context.DeadlineExceeded)
+	_, err = cumSum.Receive()
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	assert.Nil(t, cumSum.CloseRequest())
+	assert.Nil(t, cumSum.CloseResponse())
+	// Draining again returns immediately.
+	assert.Nil(t, drainer.Drain(context.Background()))
+}
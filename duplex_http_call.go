@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sync"
 )
 
@@ -136,6 +137,18 @@ func (d *duplexHTTPCall) Trailer() http.Header {
 	return d.request.Trailer
 }
 
+// URL returns the URL for the request. Callers may modify it before the
+// request is sent.
+func (d *duplexHTTPCall) URL() *url.URL {
+	return d.request.URL
+}
+
+// SetMethod changes the HTTP method of the request. It has no effect once the
+// request has been sent.
+func (d *duplexHTTPCall) SetMethod(method string) {
+	d.request.Method = method
+}
+
 // Read from the response body. Returns the first error passed to SetError.
 func (d *duplexHTTPCall) Read(data []byte) (int, error) {
 	// First, we wait until we've gotten the response headers and established the
@@ -239,6 +252,13 @@ func (d *duplexHTTPCall) makeRequest() {
 	// on d.responseReady, so we can't race with them.
 	defer close(d.responseReady)
 
+	if d.request.Method == http.MethodGet {
+		// GET requests carry their payload in the URL. Sending the request pipe
+		// would make net/http send an empty, chunked body.
+		d.request.Body = http.NoBody
+		d.request.GetBody = nil
+		d.request.ContentLength = 0
+	}
 	// Once we send a message to the server, they send a message back and
 	// establish the receive side of the stream.
 	response, err := d.httpClient.Do(d.request) //nolint:bodyclose
@@ -0,0 +1,325 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// NewDynamicClient constructs a Client for a procedure that's only known at
+// runtime, described by a method descriptor. The client sends and receives
+// [dynamicpb.Message]s of the method's input and output types, and supports
+// the same protocols, codecs, compression, and interceptors as clients for
+// generated code.
+//
+// The baseURL is the URL of the server, without the procedure: the client
+// calls baseURL + "/" + the service's full name + "/" + the method's name.
+// Unless options say otherwise, the client uses the idempotency level from
+// the method's options. The spec's Schema is the method descriptor.
+//
+// Construct requests with [dynamicpb.NewMessage] and the method's input
+// descriptor, and use the Call method that matches the method's stream type.
+func NewDynamicClient(
+	httpClient HTTPClient,
+	baseURL string,
+	method protoreflect.MethodDescriptor,
+	options ...ClientOption,
+) *Client[dynamicpb.Message, dynamicpb.Message] {
+	options = append([]ClientOption{
+		WithIdempotency(methodIdempotency(method)),
+		&schemaOption{method: method},
+	}, options...)
+	return NewClient[dynamicpb.Message, dynamicpb.Message](
+		httpClient,
+		strings.TrimSuffix(baseURL, "/")+methodProcedure(method),
+		options...,
+	)
+}
+
+// methodProcedure returns the procedure for a method, for example
+// "/acme.foo.v1.FooService/Bar".
+func methodProcedure(method protoreflect.MethodDescriptor) string {
+	return "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+}
+
+// methodIdempotency returns the idempotency level from a method's options.
+func methodIdempotency(method protoreflect.MethodDescriptor) IdempotencyLevel {
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok {
+		return IdempotencyUnknown
+	}
+	switch options.GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_NO_SIDE_EFFECTS:
+		return IdempotencyNoSideEffects
+	case descriptorpb.MethodOptions_IDEMPOTENT:
+		return IdempotencyIdempotent
+	default:
+		return IdempotencyUnknown
+	}
+}
+
+// DynamicMessage constrains the messages of a [DynamicStream]: either
+// [dynamicpb.Message]s of the method's input and output types, or encoded
+// [RawMessage]s.
+type DynamicMessage interface {
+	*dynamicpb.Message | *RawMessage
+}
+
+// RawMessage is an encoded message. A handler built by [NewDynamicHandler]
+// receives the request bytes exactly as the client encoded them, and sends
+// response bytes without re-encoding them, so the bytes must use the codec in
+// the request's Content-Type header: with the default codecs, binary Protobuf
+// or JSON.
+type RawMessage []byte
+
+// DynamicStream is the handler's view of an RPC served by [NewDynamicHandler],
+// whatever its stream type. Unary and server streaming procedures receive
+// exactly one request, and unary and client streaming procedures must send
+// exactly one response.
+//
+// It's not safe for concurrent use.
+type DynamicStream[T any] struct {
+	spec            Spec
+	peer            Peer
+	requestHeader   http.Header
+	responseHeader  http.Header
+	responseTrailer http.Header
+	receive         func() (T, error)
+	send            func(T) error
+}
+
+// Spec returns the specification for the RPC. Its Schema is the method
+// descriptor.
+func (s *DynamicStream[_]) Spec() Spec {
+	return s.spec
+}
+
+// Peer describes the client for this RPC.
+func (s *DynamicStream[_]) Peer() Peer {
+	return s.peer
+}
+
+// RequestHeader returns the headers received from the client.
+func (s *DynamicStream[_]) RequestHeader() http.Header {
+	return s.requestHeader
+}
+
+// Receive receives a request message. When there are no more requests, it
+// returns an error wrapping [io.EOF].
+func (s *DynamicStream[T]) Receive() (T, error) {
+	return s.receive()
+}
+
+// ResponseHeader returns the response headers. Headers are sent with the
+// first call to Send.
+func (s *DynamicStream[_]) ResponseHeader() http.Header {
+	return s.responseHeader
+}
+
+// ResponseTrailer returns the response trailers. Handlers may write to the
+// response trailers at any time before returning.
+func (s *DynamicStream[_]) ResponseTrailer() http.Header {
+	return s.responseTrailer
+}
+
+// Send sends a response message.
+func (s *DynamicStream[T]) Send(msg T) error {
+	return s.send(msg)
+}
+
+// NewDynamicHandler constructs a [Handler] for a procedure that's only known
+// at runtime, described by a method descriptor. Like the handlers for
+// generated code, it serves the Connect, gRPC, and gRPC-Web protocols, and
+// applies the handler's interceptors: unary interceptors for unary methods,
+// and streaming interceptors for the rest.
+//
+// The implementation works with [dynamicpb.Message]s of the method's input
+// and output types, or with [RawMessage]s for proxies that don't need to
+// decode messages. Unless options say otherwise, the handler uses the
+// idempotency level from the method's options.
+func NewDynamicHandler[T DynamicMessage](
+	method protoreflect.MethodDescriptor,
+	implementation func(context.Context, *DynamicStream[T]) error,
+	options ...HandlerOption,
+) *Handler {
+	procedure := methodProcedure(method)
+	options = append([]HandlerOption{
+		WithIdempotency(methodIdempotency(method)),
+		&schemaOption{method: method},
+	}, options...)
+	options = append(options, &rawMessageCodecsOption{})
+	switch implementation := any(implementation).(type) {
+	case func(context.Context, *DynamicStream[*dynamicpb.Message]) error:
+		return newDynamicHandler(procedure, method, implementation, options)
+	case func(context.Context, *DynamicStream[*RawMessage]) error:
+		return newDynamicHandler(procedure, method, implementation, options)
+	default:
+		// Unreachable: DynamicMessage allows no other types.
+		panic(fmt.Sprintf("unexpected dynamic handler type %T", implementation)) //nolint:forbidigo
+	}
+}
+
+func newDynamicHandler[M any](
+	procedure string,
+	method protoreflect.MethodDescriptor,
+	implementation func(context.Context, *DynamicStream[*M]) error,
+	options []HandlerOption,
+) *Handler {
+	streamType := methodStreamType(method)
+	if streamType == StreamTypeUnary {
+		return NewUnaryHandler(
+			procedure,
+			func(ctx context.Context, request *Request[M]) (*Response[M], error) {
+				response := &Response[M]{}
+				received := false
+				stream := &DynamicStream[*M]{
+					spec:            request.Spec(),
+					peer:            request.Peer(),
+					requestHeader:   request.Header(),
+					responseHeader:  response.Header(),
+					responseTrailer: response.Trailer(),
+					receive: func() (*M, error) {
+						if received {
+							return nil, io.EOF
+						}
+						received = true
+						return request.Msg, nil
+					},
+					send: func(msg *M) error {
+						if response.Msg != nil {
+							return errorf(CodeInternal, "%s sent multiple responses", procedure)
+						}
+						response.Msg = msg
+						return nil
+					},
+				}
+				if err := implementation(ctx, stream); err != nil {
+					return nil, err
+				}
+				if response.Msg == nil {
+					return nil, errorf(CodeInternal, "%s returned without sending a response", procedure)
+				}
+				return response, nil
+			},
+			options...,
+		)
+	}
+	return newStreamHandler(
+		procedure,
+		streamType,
+		func(ctx context.Context, conn StreamingHandlerConn) error {
+			return implementation(ctx, &DynamicStream[*M]{
+				spec:            conn.Spec(),
+				peer:            conn.Peer(),
+				requestHeader:   conn.RequestHeader(),
+				responseHeader:  conn.ResponseHeader(),
+				responseTrailer: conn.ResponseTrailer(),
+				receive: func() (*M, error) {
+					msg := new(M)
+					if err := conn.Receive(msg); err != nil {
+						return nil, err
+					}
+					return msg, nil
+				},
+				send: func(msg *M) error {
+					return conn.Send(msg)
+				},
+			})
+		},
+		options...,
+	)
+}
+
+// methodStreamType returns a method's stream type.
+func methodStreamType(method protoreflect.MethodDescriptor) StreamType {
+	streamType := StreamTypeUnary
+	if method.IsStreamingClient() {
+		streamType |= StreamTypeClient
+	}
+	if method.IsStreamingServer() {
+		streamType |= StreamTypeServer
+	}
+	return streamType
+}
+
+// initializeDynamicMessage resets msg to an empty message of the given type,
+// if it's a dynamicpb.Message.
+func initializeDynamicMessage(msg any, desc protoreflect.MessageDescriptor) error {
+	if dynamic, ok := msg.(*dynamicpb.Message); ok {
+		*dynamic = *dynamicpb.NewMessage(desc)
+	}
+	return nil
+}
+
+type schemaOption struct {
+	method protoreflect.MethodDescriptor
+}
+
+func (o *schemaOption) applyToClient(config *clientConfig) {
+	config.Schema = o.method
+	config.ResponseInitializer = func(_ Spec, msg any) error {
+		return initializeDynamicMessage(msg, o.method.Output())
+	}
+}
+
+func (o *schemaOption) applyToHandler(config *handlerConfig) {
+	config.Schema = o.method
+	config.RequestInitializer = func(_ Spec, msg any) error {
+		return initializeDynamicMessage(msg, o.method.Input())
+	}
+	config.ResponseInitializer = func(_ Spec, msg any) error {
+		return initializeDynamicMessage(msg, o.method.Output())
+	}
+}
+
+// rawMessageCodecsOption lets the handler's codecs pass RawMessages through
+// unchanged. It must be applied after any options that add codecs.
+type rawMessageCodecsOption struct{}
+
+func (o *rawMessageCodecsOption) applyToHandler(config *handlerConfig) {
+	for name, codec := range config.Codecs {
+		config.Codecs[name] = &rawMessageCodec{Codec: codec}
+	}
+}
+
+// rawMessageCodec wraps a Codec to copy RawMessages rather than encoding or
+// decoding them.
+type rawMessageCodec struct {
+	Codec
+}
+
+func (c *rawMessageCodec) Marshal(msg any) ([]byte, error) {
+	if raw, ok := msg.(*RawMessage); ok {
+		return *raw, nil
+	}
+	return c.Codec.Marshal(msg)
+}
+
+func (c *rawMessageCodec) Unmarshal(data []byte, msg any) error {
+	if raw, ok := msg.(*RawMessage); ok {
+		// The data is usually in a pooled buffer, so we must copy it.
+		*raw = append(RawMessage(nil), data...)
+		return nil
+	}
+	return c.Codec.Unmarshal(data, msg)
+}
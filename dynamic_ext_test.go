@@ -0,0 +1,279 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestDynamicClient(t *testing.T) {
+	t.Parallel()
+	server := newPingServer(t, &pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+			return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+		},
+		sum: func(ctx context.Context, stream *connect.ClientStream[pingv1_test.SumRequest]) (*connect.Response[pingv1_test.SumResponse], error) {
+			var sum int64
+			for stream.Receive() {
+				sum += stream.Msg().Number
+			}
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1_test.SumResponse{Sum: sum}), nil
+		},
+		countUp: func(ctx context.Context, request *connect.Request[pingv1_test.CountUpRequest], stream *connect.ServerStream[pingv1_test.CountUpResponse]) error {
+			for number := int64(1); number <= request.Msg.Number; number++ {
+				if err := stream.Send(&pingv1_test.CountUpResponse{Number: number}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1_test.CumSumRequest, pingv1_test.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += msg.Number
+				if err := stream.Send(&pingv1_test.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	})
+	methods := pingv1_test.File_connect_ping_v1_ping_proto.Services().ByName("PingService").Methods()
+	testDynamic := func(t *testing.T, options ...connect.ClientOption) { //nolint:thelper
+		t.Run("unary", func(t *testing.T) {
+			method := methods.ByName("Ping")
+			var spec connect.Spec
+			client := connect.NewDynamicClient(
+				server.Client(),
+				server.URL+"/",
+				method,
+				append(options, connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+					return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+						spec = request.Spec()
+						return next(ctx, request)
+					}
+				})))...,
+			)
+			response, err := client.CallUnary(context.Background(), connect.NewRequest(newDynamicMessage(method.Input(), "number", 42)))
+			assert.Nil(t, err)
+			assert.Equal(t, dynamicInt(response.Msg, "number"), 42)
+			assert.Equal(t, spec.Procedure, "/connect.ping.v1.PingService/Ping")
+			assert.Equal(t, spec.IdempotencyLevel, connect.IdempotencyNoSideEffects)
+			assert.True(t, spec.Schema == any(method))
+		})
+		t.Run("client_stream", func(t *testing.T) {
+			method := methods.ByName("Sum")
+			client := connect.NewDynamicClient(server.Client(), server.URL, method, options...)
+			stream := client.CallClientStream(context.Background())
+			for i := int64(1); i <= 3; i++ {
+				assert.Nil(t, stream.Send(newDynamicMessage(method.Input(), "number", i)))
+			}
+			response, err := stream.CloseAndReceive()
+			assert.Nil(t, err)
+			assert.Equal(t, dynamicInt(response.Msg, "sum"), 6)
+		})
+		t.Run("server_stream", func(t *testing.T) {
+			method := methods.ByName("CountUp")
+			client := connect.NewDynamicClient(server.Client(), server.URL, method, options...)
+			stream, err := client.CallServerStream(context.Background(), connect.NewRequest(newDynamicMessage(method.Input(), "number", 3)))
+			assert.Nil(t, err)
+			var numbers []int64
+			for stream.Receive() {
+				numbers = append(numbers, dynamicInt(stream.Msg(), "number"))
+			}
+			assert.Nil(t, stream.Err())
+			assert.Nil(t, stream.Close())
+			assert.Equal(t, numbers, []int64{1, 2, 3})
+		})
+		t.Run("bidi", func(t *testing.T) {
+			method := methods.ByName("CumSum")
+			client := connect.NewDynamicClient(server.Client(), server.URL, method, options...)
+			stream := client.CallBidiStream(context.Background())
+			for i, sum := int64(1), int64(0); i <= 3; i++ {
+				sum += i
+				assert.Nil(t, stream.Send(newDynamicMessage(method.Input(), "number", i)))
+				response, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, dynamicInt(response, "sum"), sum)
+			}
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		testDynamic(t)
+	})
+	t.Run("connect_json", func(t *testing.T) {
+		t.Parallel()
+		testDynamic(t, connect.WithProtoJSON())
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		testDynamic(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		testDynamic(t, connect.WithGRPCWeb(), connect.WithSendGzip())
+	})
+}
+
+func TestDynamicHandler(t *testing.T) {
+	t.Parallel()
+	methods := pingv1_test.File_connect_ping_v1_ping_proto.Services().ByName("PingService").Methods()
+	mux := http.NewServeMux()
+	handle := func(method string, handler *connect.Handler) {
+		mux.Handle("/connect.ping.v1.PingService/"+method, handler)
+	}
+	// Ping echoes the request bytes, since the request and response messages
+	// have the same fields.
+	handle("Ping", connect.NewDynamicHandler(methods.ByName("Ping"), func(ctx context.Context, stream *connect.DynamicStream[*connect.RawMessage]) error {
+		request, err := stream.Receive()
+		if err != nil {
+			return err
+		}
+		stream.ResponseHeader().Set("Raw-Length", strconv.Itoa(len(*request)))
+		return stream.Send(request)
+	}))
+	handle("Sum", connect.NewDynamicHandler(methods.ByName("Sum"), func(ctx context.Context, stream *connect.DynamicStream[*dynamicpb.Message]) error {
+		var sum int64
+		for {
+			request, err := stream.Receive()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+			sum += dynamicInt(request, "number")
+		}
+		return stream.Send(newDynamicMessage(methods.ByName("Sum").Output(), "sum", sum))
+	}))
+	handle("CountUp", connect.NewDynamicHandler(methods.ByName("CountUp"), func(ctx context.Context, stream *connect.DynamicStream[*dynamicpb.Message]) error {
+		request, err := stream.Receive()
+		if err != nil {
+			return err
+		}
+		for number := int64(1); number <= dynamicInt(request, "number"); number++ {
+			if err := stream.Send(newDynamicMessage(methods.ByName("CountUp").Output(), "number", number)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	handle("CumSum", connect.NewDynamicHandler(methods.ByName("CumSum"), func(ctx context.Context, stream *connect.DynamicStream[*dynamicpb.Message]) error {
+		var sum int64
+		for {
+			request, err := stream.Receive()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			sum += dynamicInt(request, "number")
+			if err := stream.Send(newDynamicMessage(methods.ByName("CumSum").Output(), "sum", sum)); err != nil {
+				return err
+			}
+		}
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	testHandler := func(t *testing.T, options ...connect.ClientOption) { //nolint:thelper
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, options...)
+		ping, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42, Text: "hi"}))
+		assert.Nil(t, err)
+		assert.Equal(t, ping.Msg.Number, 42)
+		assert.Equal(t, ping.Msg.Text, "hi")
+		assert.NotZero(t, ping.Header().Get("Raw-Length"))
+
+		sumStream := client.Sum(context.Background())
+		for i := int64(1); i <= 3; i++ {
+			assert.Nil(t, sumStream.Send(&pingv1_test.SumRequest{Number: i}))
+		}
+		sum, err := sumStream.CloseAndReceive()
+		assert.Nil(t, err)
+		assert.Equal(t, sum.Msg.Sum, 6)
+
+		countStream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1_test.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		var numbers []int64
+		for countStream.Receive() {
+			numbers = append(numbers, countStream.Msg().Number)
+		}
+		assert.Nil(t, countStream.Err())
+		assert.Nil(t, countStream.Close())
+		assert.Equal(t, numbers, []int64{1, 2, 3})
+
+		cumSumStream := client.CumSum(context.Background())
+		for i, total := int64(1), int64(0); i <= 3; i++ {
+			total += i
+			assert.Nil(t, cumSumStream.Send(&pingv1_test.CumSumRequest{Number: i}))
+			response, err := cumSumStream.Receive()
+			assert.Nil(t, err)
+			assert.Equal(t, response.Sum, total)
+		}
+		assert.Nil(t, cumSumStream.CloseRequest())
+		assert.Nil(t, cumSumStream.CloseResponse())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		testHandler(t)
+	})
+	t.Run("connect_json_get", func(t *testing.T) {
+		t.Parallel()
+		testHandler(t, connect.WithProtoJSON(), connect.WithHTTPGet())
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		testHandler(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		testHandler(t, connect.WithGRPCWeb(), connect.WithSendGzip())
+	})
+}
+
+func newDynamicMessage(desc protoreflect.MessageDescriptor, field protoreflect.Name, value int64) *dynamicpb.Message {
+	msg := dynamicpb.NewMessage(desc)
+	msg.Set(desc.Fields().ByName(field), protoreflect.ValueOfInt64(value))
+	return msg
+}
+
+func dynamicInt(msg *dynamicpb.Message, field protoreflect.Name) int64 {
+	return msg.Get(msg.Descriptor().Fields().ByName(field)).Int()
+}
@@ -25,6 +25,12 @@ import (
 // same meaning in the gRPC-Web, gRPC-HTTP2, and Connect protocols.
 const flagEnvelopeCompressed = 0b00000001
 
+// flagEnvelopeResumeToken indicates that the data is a resume token for the
+// message in the next envelope. It's a Connect extension to the gRPC and
+// Connect protocols, and servers only send it to clients that ask for resume
+// tokens.
+const flagEnvelopeResumeToken = 0b00000100
+
 var errSpecialEnvelope = errorf(
 	CodeUnknown,
 	"final message has protocol-specific flags: %w",
@@ -79,6 +85,14 @@ func (w *envelopeWriter) Marshal(message any) *Error {
 	return w.Write(envelope)
 }
 
+// WriteResumeToken writes a resume token for the next message.
+func (w *envelopeWriter) WriteResumeToken(token string) *Error {
+	return w.write(&envelope{
+		Data:  bytes.NewBufferString(token),
+		Flags: flagEnvelopeResumeToken,
+	})
+}
+
 // Write writes the enveloped message, compressing as necessary. It doesn't
 // retain any references to the supplied envelope or its underlying data.
 func (w *envelopeWriter) Write(env *envelope) *Error {
@@ -127,6 +141,7 @@ type envelopeReader struct {
 	compressionPool *compressionPool
 	bufferPool      *bufferPool
 	readMaxBytes    int
+	resumeToken     string // from the most recent message with a token
 }
 
 func (r *envelopeReader) Unmarshal(message any) *Error {
@@ -166,6 +181,17 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 		data = decompressed
 	}
 
+	if env.Flags&^flagEnvelopeCompressed == flagEnvelopeResumeToken {
+		// The token belongs to the next message, so it only becomes current once
+		// that message arrives.
+		token := data.String()
+		if err := r.Unmarshal(message); err != nil {
+			return err
+		}
+		r.resumeToken = token
+		return nil
+	}
+
 	if env.Flags != 0 && env.Flags != flagEnvelopeCompressed {
 		// One of the protocol-specific flags are set, so this is the end of the
 		// stream. Save the message for protocol-specific code to process and
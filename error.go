@@ -29,6 +29,11 @@ import (
 const (
 	commonErrorsURL          = "https://connect.build/docs/go/common-errors"
 	defaultAnyResolverPrefix = "type.googleapis.com/"
+
+	// RST_STREAM errors from net/http's vendored copy of x/net/http2 look like
+	// "stream error: stream ID 3; INTERNAL_ERROR; received from peer".
+	rstStreamErrPrefix = "stream error: "
+	rstFromPeerSuffix  = "; received from peer"
 )
 
 // An ErrorDetail is a self-describing Protobuf message attached to an [*Error].
@@ -264,7 +269,7 @@ func wrapIfLikelyH2CNotConfiguredError(request *http.Request, err error) error {
 	if errString := err.Error(); strings.HasPrefix(errString, `Post "`) &&
 		(strings.Contains(errString, `net/http: HTTP/1.x transport connection broken: malformed HTTP response`) ||
 			strings.HasSuffix(errString, `write: broken pipe`)) {
-		return fmt.Errorf("possible h2c configuration issue when talking to gRPC server, see %s: %w", commonErrorsURL, err)
+		return fmt.Errorf("possible h2c configuration issue when talking to gRPC server (connecthttp2.NewClient configures h2c), see %s: %w", commonErrorsURL, err)
 	}
 	return err
 }
@@ -302,10 +307,6 @@ func wrapIfLikelyWithGRPCNotUsedError(err error) error {
 // net/http, though, all these types become unexported...so we're left with
 // string munging.
 func wrapIfRSTError(err error) error {
-	const (
-		streamErrPrefix = "stream error: "
-		fromPeerSuffix  = "; received from peer"
-	)
 	if err == nil {
 		return nil
 	}
@@ -318,13 +319,10 @@ func wrapIfRSTError(err error) error {
 		err = urlErr.Unwrap()
 	}
 	msg := err.Error()
-	if !strings.HasPrefix(msg, streamErrPrefix) {
-		return err
-	}
-	if !strings.HasSuffix(msg, fromPeerSuffix) {
+	if !isRSTErrorMessage(msg) {
 		return err
 	}
-	msg = strings.TrimSuffix(msg, fromPeerSuffix)
+	msg = strings.TrimSuffix(msg, rstFromPeerSuffix)
 	i := strings.LastIndex(msg, ";")
 	if i < 0 || i >= len(msg)-1 {
 		return err
@@ -347,3 +345,17 @@ func wrapIfRSTError(err error) error {
 		return err
 	}
 }
+
+// isRSTError reports whether err wraps an RST_STREAM error sent by the peer.
+func isRSTError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if isRSTErrorMessage(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+func isRSTErrorMessage(msg string) bool {
+	return strings.HasPrefix(msg, rstStreamErrPrefix) && strings.HasSuffix(msg, rstFromPeerSuffix)
+}
@@ -4,5 +4,8 @@ go 1.19
 
 require (
 	github.com/google/go-cmp v0.5.9
+	golang.org/x/net v0.17.0
 	google.golang.org/protobuf v1.28.1
 )
+
+require golang.org/x/text v0.13.0 // indirect
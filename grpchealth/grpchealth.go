@@ -0,0 +1,261 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpchealth implements gRPC's health checking protocol, so
+// Kubernetes gRPC probes, load balancers, and other tools can check whether
+// a server's services are ready for traffic. It serves the Connect, gRPC, and
+// gRPC-Web protocols.
+//
+// A [Checker] holds the status of each service. Mount its handler alongside
+// your services, and update the statuses as they change:
+//
+//	checker := grpchealth.NewChecker(pingv1connect.PingServiceName)
+//	mux := http.NewServeMux()
+//	mux.Handle(grpchealth.NewHandler(checker))
+//	// Later, while shutting down:
+//	checker.Shutdown()
+//
+// The handler serves grpc.health.v1.Health, but its messages are registered
+// under a private Protobuf package so that programs can also link grpc-go's
+// health package. Reflectors from the grpcreflect package still describe the
+// service by its public name.
+package grpchealth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	connect "github.com/joshcarp/connect-no"
+	healthv1 "github.com/joshcarp/connect-no/internal/gen/connectext/grpc/health/v1"
+)
+
+// HealthV1ServiceName is the fully-qualified name of the health service.
+const HealthV1ServiceName = "grpc.health.v1.Health"
+
+// Status describes the health of a service.
+type Status uint8
+
+const (
+	// StatusUnknown indicates that the service's health is unknown.
+	StatusUnknown Status = 0
+	// StatusServing indicates that the service is ready to accept requests.
+	StatusServing Status = 1
+	// StatusNotServing indicates that the service can't accept requests,
+	// perhaps because it's starting up or shutting down.
+	StatusNotServing Status = 2
+)
+
+// String implements [fmt.Stringer].
+func (s Status) String() string {
+	switch s {
+	case StatusUnknown:
+		return "unknown"
+	case StatusServing:
+		return "serving"
+	case StatusNotServing:
+		return "not_serving"
+	}
+	return fmt.Sprintf("status_%d", s)
+}
+
+// Checker is a registry of service statuses. The empty service name is the
+// status of the server as a whole. Checkers are safe to use concurrently.
+type Checker struct {
+	mu       sync.Mutex
+	statuses map[string]Status
+	watchers map[string]map[chan Status]struct{}
+	shutdown bool
+	saved    map[string]Status // statuses before Shutdown
+}
+
+// NewChecker constructs a Checker. The named services and the server as a
+// whole start out serving. Generated code includes a constant with each
+// service's name, like PingServiceName.
+func NewChecker(services ...string) *Checker {
+	checker := &Checker{
+		statuses: map[string]Status{"": StatusServing},
+		watchers: make(map[string]map[chan Status]struct{}),
+	}
+	for _, service := range services {
+		checker.statuses[service] = StatusServing
+	}
+	return checker
+}
+
+// Check returns the status of a service. It returns an error with
+// [connect.CodeNotFound] if the service isn't registered.
+func (c *Checker) Check(service string) (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.statuses[service]
+	if !ok {
+		return StatusUnknown, connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown service %q", service))
+	}
+	return status, nil
+}
+
+// SetStatus sets the status of a service, registering it if necessary, and
+// notifies any watchers. After Shutdown, SetStatus has no effect until Resume
+// is called.
+func (c *Checker) SetStatus(service string, status Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.shutdown {
+		return
+	}
+	c.setStatus(service, status)
+}
+
+// Shutdown marks every service as not serving and ignores further status
+// updates, so draining servers stop receiving new traffic.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.shutdown {
+		return
+	}
+	c.shutdown = true
+	c.saved = make(map[string]Status, len(c.statuses))
+	for service, status := range c.statuses {
+		c.saved[service] = status
+	}
+	for service := range c.statuses {
+		c.setStatus(service, StatusNotServing)
+	}
+}
+
+// Resume restores the statuses services had before Shutdown and accepts
+// status updates again.
+func (c *Checker) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.shutdown {
+		return
+	}
+	c.shutdown = false
+	for service, status := range c.saved {
+		c.setStatus(service, status)
+	}
+	c.saved = nil
+}
+
+// setStatus updates a status and notifies watchers. It must be called with
+// the mutex held.
+func (c *Checker) setStatus(service string, status Status) {
+	c.statuses[service] = status
+	for watcher := range c.watchers[service] {
+		notify(watcher, status)
+	}
+}
+
+// watch registers a channel that receives the service's current status
+// immediately, and then each new status. Slow watchers only see the latest
+// status. Call the returned function to stop watching.
+func (c *Checker) watch(service string) (<-chan Status, func()) {
+	watcher := make(chan Status, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watchers[service] == nil {
+		c.watchers[service] = make(map[chan Status]struct{})
+	}
+	c.watchers[service][watcher] = struct{}{}
+	if status, ok := c.statuses[service]; ok {
+		watcher <- status
+	} else {
+		watcher <- statusServiceUnknown
+	}
+	return watcher, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.watchers[service], watcher)
+		if len(c.watchers[service]) == 0 {
+			delete(c.watchers, service)
+		}
+	}
+}
+
+// statusServiceUnknown is only sent by Watch, for services that aren't
+// registered (yet).
+const statusServiceUnknown = Status(healthv1.HealthCheckResponse_SERVICE_UNKNOWN)
+
+// notify replaces any status the watcher hasn't received yet. It must be
+// called with the mutex held, so it's the only sender.
+func notify(watcher chan Status, status Status) {
+	select {
+	case <-watcher:
+	default:
+	}
+	watcher <- status
+}
+
+// NewHandler constructs a handler for the health service. It returns the
+// path on which to mount the handler and the handler itself.
+func NewHandler(checker *Checker, options ...connect.HandlerOption) (string, http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/grpc.health.v1.Health/Check", connect.NewUnaryHandler(
+		"/grpc.health.v1.Health/Check",
+		checker.check,
+		options...,
+	))
+	mux.Handle("/grpc.health.v1.Health/Watch", connect.NewServerStreamHandler(
+		"/grpc.health.v1.Health/Watch",
+		checker.watchHandler,
+		options...,
+	))
+	return "/" + HealthV1ServiceName + "/", mux
+}
+
+func (c *Checker) check(
+	_ context.Context,
+	request *connect.Request[healthv1.HealthCheckRequest],
+) (*connect.Response[healthv1.HealthCheckResponse], error) {
+	status, err := c.Check(request.Msg.Service)
+	if err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&healthv1.HealthCheckResponse{
+		Status: healthv1.HealthCheckResponse_ServingStatus(status),
+	}), nil
+}
+
+// watchHandler streams the service's status until the client goes away.
+// Like grpc-go, it only sends a status when it changes.
+func (c *Checker) watchHandler(
+	ctx context.Context,
+	request *connect.Request[healthv1.HealthCheckRequest],
+	stream *connect.ServerStream[healthv1.HealthCheckResponse],
+) error {
+	statuses, stop := c.watch(request.Msg.Service)
+	defer stop()
+	var last Status
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case status := <-statuses:
+			if !first && status == last {
+				continue
+			}
+			first, last = false, status
+			if err := stream.Send(&healthv1.HealthCheckResponse{
+				Status: healthv1.HealthCheckResponse_ServingStatus(status),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/grpchealth"
+	"github.com/joshcarp/connect-no/internal/assert"
+	healthv1 "github.com/joshcarp/connect-no/internal/gen/connectext/grpc/health/v1"
+	pingv1connect "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+	checker := grpchealth.NewChecker(pingv1connect.PingServiceName)
+	mux := http.NewServeMux()
+	mux.Handle(grpchealth.NewHandler(checker))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	const userServiceName = "acme.user.v1.UserService"
+	checkClient := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Check",
+		connect.WithGRPC(),
+	)
+	watchClient := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Watch",
+		connect.WithGRPC(),
+	)
+
+	t.Run("check", func(t *testing.T) {
+		t.Parallel()
+		for _, service := range []string{"", pingv1connect.PingServiceName} {
+			response, err := checkClient.CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{Service: service}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Status, healthv1.HealthCheckResponse_SERVING)
+		}
+		_, err := checkClient.CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{Service: "acme.unknown.v1.UnknownService"}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+	})
+	t.Run("watch", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := watchClient.CallServerStream(ctx, connect.NewRequest(&healthv1.HealthCheckRequest{Service: userServiceName}))
+		assert.Nil(t, err)
+		receive := func() healthv1.HealthCheckResponse_ServingStatus {
+			t.Helper()
+			assert.True(t, stream.Receive())
+			return stream.Msg().Status
+		}
+		// Watching a service that isn't registered yet isn't an error.
+		assert.Equal(t, receive(), healthv1.HealthCheckResponse_SERVICE_UNKNOWN)
+		checker.SetStatus(userServiceName, grpchealth.StatusNotServing)
+		assert.Equal(t, receive(), healthv1.HealthCheckResponse_NOT_SERVING)
+		checker.SetStatus(userServiceName, grpchealth.StatusServing)
+		assert.Equal(t, receive(), healthv1.HealthCheckResponse_SERVING)
+		cancel()
+		assert.False(t, stream.Receive())
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeCanceled)
+		_ = stream.Close()
+	})
+}
+
+func TestCheckerShutdown(t *testing.T) {
+	t.Parallel()
+	const stopped = "stopped.v1.StoppedService"
+	checker := grpchealth.NewChecker(pingv1connect.PingServiceName)
+	checker.SetStatus(stopped, grpchealth.StatusNotServing)
+	checker.Shutdown()
+	checker.SetStatus(pingv1connect.PingServiceName, grpchealth.StatusServing)
+	checker.Shutdown()
+	for _, service := range []string{"", pingv1connect.PingServiceName, stopped} {
+		status, err := checker.Check(service)
+		assert.Nil(t, err)
+		assert.Equal(t, status, grpchealth.StatusNotServing)
+	}
+	checker.Resume()
+	for service, want := range map[string]grpchealth.Status{
+		"":                            grpchealth.StatusServing,
+		pingv1connect.PingServiceName: grpchealth.StatusServing,
+		stopped:                       grpchealth.StatusNotServing,
+	} {
+		status, err := checker.Check(service)
+		assert.Nil(t, err)
+		assert.Equal(t, status, want)
+	}
+}
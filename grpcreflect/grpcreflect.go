@@ -0,0 +1,440 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpcreflect implements gRPC's server reflection API, so tools like
+// grpcurl, Postman, and buf curl can list a server's services and download
+// their schemas. It serves both the v1 and v1alpha versions of the API, over
+// the Connect, gRPC, and gRPC-Web protocols.
+//
+// To enable reflection, mount the handlers alongside your services:
+//
+//	reflector := grpcreflect.NewStaticReflector(pingv1connect.PingServiceName)
+//	mux := http.NewServeMux()
+//	mux.Handle(grpcreflect.NewHandlerV1(reflector))
+//	mux.Handle(grpcreflect.NewHandlerV1Alpha(reflector))
+//
+// Many tools still only use v1alpha, so most servers should mount both.
+//
+// The grpchealth package registers its messages under a private Protobuf
+// package, so that programs can also link grpc-go's health package. If the
+// resolver doesn't have the schema of grpc.health.v1.Health, Reflectors serve
+// an equivalent one, so tools can still call the health service.
+package grpcreflect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	connect "github.com/joshcarp/connect-no"
+	healthv1 "github.com/joshcarp/connect-no/internal/gen/connectext/grpc/health/v1"
+	reflectionv1alpha "github.com/joshcarp/connect-no/internal/gen/connectext/grpc/reflection/v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// ReflectV1ServiceName is the fully-qualified name of the v1 version of
+	// the reflection service.
+	ReflectV1ServiceName = "grpc.reflection.v1.ServerReflection"
+	// ReflectV1AlphaServiceName is the fully-qualified name of the v1alpha
+	// version of the reflection service.
+	ReflectV1AlphaServiceName = "grpc.reflection.v1alpha.ServerReflection"
+
+	serviceInfoMethod = "ServerReflectionInfo"
+)
+
+// Namer lists the fully-qualified names of the services to expose with
+// reflection, for example "acme.foo.v1.FooService". Generated code includes a
+// constant with each service's name, like PingServiceName.
+type Namer interface {
+	Names() []string
+}
+
+// NamerFunc is a simple [Namer] implementation.
+type NamerFunc func() []string
+
+// Names implements [Namer].
+func (f NamerFunc) Names() []string {
+	return f()
+}
+
+// DescriptorResolver finds files and descriptors. Both
+// [protoregistry.GlobalFiles] and [*protoregistry.Files] implement it.
+type DescriptorResolver interface {
+	FindFileByPath(string) (protoreflect.FileDescriptor, error)
+	FindDescriptorByName(protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// ExtensionResolver finds extensions. Both [protoregistry.GlobalTypes] and
+// [*protoregistry.Types] implement it.
+type ExtensionResolver interface {
+	FindExtensionByNumber(protoreflect.FullName, protoreflect.FieldNumber) (protoreflect.ExtensionType, error)
+	RangeExtensionsByMessage(protoreflect.FullName, func(protoreflect.ExtensionType) bool)
+}
+
+// An Option configures a [Reflector].
+type Option interface {
+	apply(*Reflector)
+}
+
+// WithDescriptorResolver sets the resolver used to find schemas. By default,
+// Reflectors use [protoregistry.GlobalFiles], which holds the schemas of all
+// generated code linked into the program. To serve an explicit list of files
+// instead, register them with a new [protoregistry.Files].
+func WithDescriptorResolver(resolver DescriptorResolver) Option {
+	return &descriptorResolverOption{resolver: resolver}
+}
+
+// WithExtensionResolver sets the resolver used to find extensions. By
+// default, Reflectors use [protoregistry.GlobalTypes].
+func WithExtensionResolver(resolver ExtensionResolver) Option {
+	return &extensionResolverOption{resolver: resolver}
+}
+
+// Reflector implements the reflection API. Reflectors are safe to use
+// concurrently.
+type Reflector struct {
+	namer              Namer
+	descriptorResolver DescriptorResolver
+	extensionResolver  ExtensionResolver
+}
+
+// NewReflector constructs a Reflector that exposes the services listed by
+// the namer. The namer is called for each request to list services, so the
+// list may change over time.
+func NewReflector(namer Namer, options ...Option) *Reflector {
+	reflector := &Reflector{
+		namer:              namer,
+		descriptorResolver: protoregistry.GlobalFiles,
+		extensionResolver:  protoregistry.GlobalTypes,
+	}
+	for _, option := range options {
+		option.apply(reflector)
+	}
+	return reflector
+}
+
+// NewStaticReflector constructs a Reflector that always exposes the same
+// services.
+func NewStaticReflector(serviceNames ...string) *Reflector {
+	names := append([]string(nil), serviceNames...)
+	sort.Strings(names)
+	return NewReflector(NamerFunc(func() []string { return names }))
+}
+
+// NewHandlerV1 constructs a handler for the v1 version of the reflection API.
+// It returns the path on which to mount the handler and the handler itself.
+func NewHandlerV1(reflector *Reflector, options ...connect.HandlerOption) (string, http.Handler) {
+	return newHandler(ReflectV1ServiceName, reflector, options)
+}
+
+// NewHandlerV1Alpha constructs a handler for the v1alpha version of the
+// reflection API. It returns the path on which to mount the handler and the
+// handler itself.
+func NewHandlerV1Alpha(reflector *Reflector, options ...connect.HandlerOption) (string, http.Handler) {
+	return newHandler(ReflectV1AlphaServiceName, reflector, options)
+}
+
+func newHandler(serviceName string, reflector *Reflector, options []connect.HandlerOption) (string, http.Handler) {
+	procedure := "/" + serviceName + "/" + serviceInfoMethod
+	return "/" + serviceName + "/", connect.NewBidiStreamHandler(procedure, reflector.serverReflectionInfo, options...)
+}
+
+// serverReflectionInfo answers each request on the stream. The v1 and v1alpha
+// messages are identical on the wire, so both versions use the same Go types.
+func (r *Reflector) serverReflectionInfo(
+	ctx context.Context,
+	stream *connect.BidiStream[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse],
+) error {
+	// Clients rely on the server to send each file only once per stream.
+	sent := make(map[string]struct{})
+	for {
+		request, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		response, err := r.respond(request, sent)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+// respond answers a single request. Errors that are specific to the request,
+// like an unknown file or symbol, are sent to the client in the response;
+// only malformed requests end the stream.
+func (r *Reflector) respond(
+	request *reflectionv1alpha.ServerReflectionRequest,
+	sent map[string]struct{},
+) (*reflectionv1alpha.ServerReflectionResponse, error) {
+	response := &reflectionv1alpha.ServerReflectionResponse{
+		ValidHost:       request.Host,
+		OriginalRequest: request,
+	}
+	var err error
+	switch messageRequest := request.MessageRequest.(type) {
+	case *reflectionv1alpha.ServerReflectionRequest_FileByFilename:
+		var file protoreflect.FileDescriptor
+		file, err = r.findFileByPath(messageRequest.FileByFilename)
+		if err == nil {
+			response.MessageResponse, err = fileDescriptorResponse(file, sent)
+		}
+	case *reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol:
+		var descriptor protoreflect.Descriptor
+		descriptor, err = r.findDescriptorByName(protoreflect.FullName(messageRequest.FileContainingSymbol))
+		if err == nil {
+			response.MessageResponse, err = fileDescriptorResponse(descriptor.ParentFile(), sent)
+		}
+	case *reflectionv1alpha.ServerReflectionRequest_FileContainingExtension:
+		var extension protoreflect.ExtensionType
+		extension, err = r.extensionResolver.FindExtensionByNumber(
+			protoreflect.FullName(messageRequest.FileContainingExtension.GetContainingType()),
+			protoreflect.FieldNumber(messageRequest.FileContainingExtension.GetExtensionNumber()),
+		)
+		if err == nil {
+			response.MessageResponse, err = fileDescriptorResponse(extension.TypeDescriptor().ParentFile(), sent)
+		}
+	case *reflectionv1alpha.ServerReflectionRequest_AllExtensionNumbersOfType:
+		response.MessageResponse, err = r.allExtensionNumbersResponse(protoreflect.FullName(messageRequest.AllExtensionNumbersOfType))
+	case *reflectionv1alpha.ServerReflectionRequest_ListServices:
+		response.MessageResponse = r.listServicesResponse()
+	default:
+		return nil, connect.NewError(
+			connect.CodeInvalidArgument,
+			fmt.Errorf("invalid MessageRequest: %T", request.MessageRequest),
+		)
+	}
+	if err != nil {
+		code := connect.CodeInternal
+		if errors.Is(err, protoregistry.NotFound) {
+			code = connect.CodeNotFound
+		}
+		response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_ErrorResponse{
+			ErrorResponse: &reflectionv1alpha.ErrorResponse{
+				ErrorCode:    int32(code),
+				ErrorMessage: err.Error(),
+			},
+		}
+	}
+	return response, nil
+}
+
+func (r *Reflector) listServicesResponse() *reflectionv1alpha.ServerReflectionResponse_ListServicesResponse {
+	names := r.namer.Names()
+	services := make([]*reflectionv1alpha.ServiceResponse, len(names))
+	for i, name := range names {
+		services[i] = &reflectionv1alpha.ServiceResponse{Name: name}
+	}
+	return &reflectionv1alpha.ServerReflectionResponse_ListServicesResponse{
+		ListServicesResponse: &reflectionv1alpha.ListServiceResponse{Service: services},
+	}
+}
+
+func (r *Reflector) allExtensionNumbersResponse(
+	name protoreflect.FullName,
+) (*reflectionv1alpha.ServerReflectionResponse_AllExtensionNumbersResponse, error) {
+	descriptor, err := r.findDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := descriptor.(protoreflect.MessageDescriptor); !ok {
+		return nil, fmt.Errorf("%s is not a message: %w", name, protoregistry.NotFound)
+	}
+	var numbers []int32
+	r.extensionResolver.RangeExtensionsByMessage(name, func(extension protoreflect.ExtensionType) bool {
+		numbers = append(numbers, int32(extension.TypeDescriptor().Number()))
+		return true
+	})
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return &reflectionv1alpha.ServerReflectionResponse_AllExtensionNumbersResponse{
+		AllExtensionNumbersResponse: &reflectionv1alpha.ExtensionNumberResponse{
+			BaseTypeName:    string(name),
+			ExtensionNumber: numbers,
+		},
+	}, nil
+}
+
+// findFileByPath finds a file with the descriptor resolver, falling back to
+// the schemas of vendored services.
+func (r *Reflector) findFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	file, err := r.descriptorResolver.FindFileByPath(path)
+	if !errors.Is(err, protoregistry.NotFound) {
+		return file, err
+	}
+	vendored, err := loadVendoredFiles()
+	if err != nil {
+		return nil, err
+	}
+	return vendored.FindFileByPath(path)
+}
+
+// findDescriptorByName finds a descriptor with the descriptor resolver,
+// falling back to the schemas of vendored services.
+func (r *Reflector) findDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	descriptor, err := r.descriptorResolver.FindDescriptorByName(name)
+	if !errors.Is(err, protoregistry.NotFound) {
+		return descriptor, err
+	}
+	vendored, err := loadVendoredFiles()
+	if err != nil {
+		return nil, err
+	}
+	return vendored.FindDescriptorByName(name)
+}
+
+// fileDescriptorResponse serializes a file and its transitive dependencies,
+// skipping any dependencies already sent on the stream. The requested file
+// is always sent, and it's always first.
+func fileDescriptorResponse(
+	file protoreflect.FileDescriptor,
+	sent map[string]struct{},
+) (*reflectionv1alpha.ServerReflectionResponse_FileDescriptorResponse, error) {
+	var encoded [][]byte
+	var add func(protoreflect.FileDescriptor, bool) error
+	add = func(file protoreflect.FileDescriptor, requested bool) error {
+		if _, ok := sent[file.Path()]; ok && !requested {
+			return nil
+		}
+		sent[file.Path()] = struct{}{}
+		data, err := proto.Marshal(protodesc.ToFileDescriptorProto(file))
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, data)
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if imports.Get(i).IsPlaceholder() {
+				continue // unresolvable, so there's nothing to send
+			}
+			if err := add(imports.Get(i).FileDescriptor, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := add(file, true); err != nil {
+		return nil, err
+	}
+	return &reflectionv1alpha.ServerReflectionResponse_FileDescriptorResponse{
+		FileDescriptorResponse: &reflectionv1alpha.FileDescriptorResponse{FileDescriptorProto: encoded},
+	}, nil
+}
+
+type descriptorResolverOption struct {
+	resolver DescriptorResolver
+}
+
+func (o *descriptorResolverOption) apply(reflector *Reflector) {
+	reflector.descriptorResolver = o.resolver
+}
+
+type extensionResolverOption struct {
+	resolver ExtensionResolver
+}
+
+func (o *extensionResolverOption) apply(reflector *Reflector) {
+	reflector.extensionResolver = o.resolver
+}
+
+//nolint:gochecknoglobals
+var (
+	vendoredOnce  sync.Once
+	vendoredFiles *protoregistry.Files
+	vendoredErr   error
+)
+
+// loadVendoredFiles returns the public schemas of the gRPC services that this
+// module implements with privately named messages. Those messages are
+// registered under connectext.* packages to avoid conflicts with grpc-go,
+// but the services are served at their usual paths.
+func loadVendoredFiles() (*protoregistry.Files, error) {
+	vendoredOnce.Do(func() {
+		vendoredFiles, vendoredErr = newVendoredFiles()
+	})
+	return vendoredFiles, vendoredErr
+}
+
+func newVendoredFiles() (*protoregistry.Files, error) {
+	files := new(protoregistry.Files)
+	health := publicFileDescriptorProto(
+		healthv1.File_connectext_grpc_health_v1_health_proto,
+		"grpc/health/v1/health.proto",
+		"google.golang.org/grpc/health/grpc_health_v1",
+	)
+	health.Service = []*descriptorpb.ServiceDescriptorProto{{
+		Name: proto.String("Health"),
+		Method: []*descriptorpb.MethodDescriptorProto{
+			{
+				Name:       proto.String("Check"),
+				InputType:  proto.String(".grpc.health.v1.HealthCheckRequest"),
+				OutputType: proto.String(".grpc.health.v1.HealthCheckResponse"),
+			},
+			{
+				Name:            proto.String("Watch"),
+				InputType:       proto.String(".grpc.health.v1.HealthCheckRequest"),
+				OutputType:      proto.String(".grpc.health.v1.HealthCheckResponse"),
+				ServerStreaming: proto.Bool(true),
+			},
+		},
+	}}
+	file, err := protodesc.NewFile(health, files)
+	if err != nil {
+		return nil, fmt.Errorf("build %s: %w", health.GetName(), err)
+	}
+	if err := files.RegisterFile(file); err != nil {
+		return nil, fmt.Errorf("register %s: %w", health.GetName(), err)
+	}
+	return files, nil
+}
+
+// publicFileDescriptorProto converts a vendored file to its public path and
+// package, which is its private package without the "connectext." prefix.
+func publicFileDescriptorProto(
+	file protoreflect.FileDescriptor,
+	path string,
+	goPackage string,
+) *descriptorpb.FileDescriptorProto {
+	const privatePrefix = "connectext."
+	fileProto := protodesc.ToFileDescriptorProto(file)
+	fileProto.Name = proto.String(path)
+	fileProto.Package = proto.String(strings.TrimPrefix(fileProto.GetPackage(), privatePrefix))
+	fileProto.Options = &descriptorpb.FileOptions{GoPackage: proto.String(goPackage)}
+	var rename func([]*descriptorpb.DescriptorProto)
+	rename = func(messages []*descriptorpb.DescriptorProto) {
+		for _, message := range messages {
+			for _, field := range message.Field {
+				if field.TypeName != nil {
+					field.TypeName = proto.String(strings.Replace(field.GetTypeName(), "."+privatePrefix, ".", 1))
+				}
+			}
+			rename(message.NestedType)
+		}
+	}
+	rename(fileProto.MessageType)
+	return fileProto
+}
@@ -0,0 +1,181 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcreflect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/grpchealth"
+	"github.com/joshcarp/connect-no/grpcreflect"
+	"github.com/joshcarp/connect-no/internal/assert"
+	reflectionv1alpha "github.com/joshcarp/connect-no/internal/gen/connectext/grpc/reflection/v1alpha"
+	pingv1connect "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestReflection(t *testing.T) {
+	t.Parallel()
+	reflector := grpcreflect.NewStaticReflector(pingv1connect.PingServiceName)
+	mux := http.NewServeMux()
+	mux.Handle(grpcreflect.NewHandlerV1(reflector))
+	mux.Handle(grpcreflect.NewHandlerV1Alpha(reflector))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	testReflection := func(t *testing.T, serviceName string, options ...connect.ClientOption) { //nolint:thelper
+		client := connect.NewClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse](
+			server.Client(),
+			server.URL+"/"+serviceName+"/ServerReflectionInfo",
+			options...,
+		)
+		stream := client.CallBidiStream(context.Background())
+		call := func(request *reflectionv1alpha.ServerReflectionRequest) *reflectionv1alpha.ServerReflectionResponse {
+			t.Helper()
+			assert.Nil(t, stream.Send(request))
+			response, err := stream.Receive()
+			assert.Nil(t, err)
+			return response
+		}
+
+		response := call(&reflectionv1alpha.ServerReflectionRequest{
+			Host:           "example.com",
+			MessageRequest: &reflectionv1alpha.ServerReflectionRequest_ListServices{},
+		})
+		assert.Equal(t, response.ValidHost, "example.com")
+		services := response.GetListServicesResponse().GetService()
+		assert.Equal(t, len(services), 1)
+		assert.Equal(t, services[0].Name, pingv1connect.PingServiceName)
+
+		response = call(&reflectionv1alpha.ServerReflectionRequest{
+			MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: pingv1connect.PingServiceName,
+			},
+		})
+		files := response.GetFileDescriptorResponse().GetFileDescriptorProto()
+		assert.Equal(t, len(files), 1)
+		var file descriptorpb.FileDescriptorProto
+		assert.Nil(t, proto.Unmarshal(files[0], &file))
+		assert.Equal(t, file.GetName(), "connect/ping/v1/ping.proto")
+		assert.Equal(t, file.GetService()[0].GetName(), "PingService")
+
+		// Requested files are sent again, even if they've been sent before.
+		response = call(&reflectionv1alpha.ServerReflectionRequest{
+			MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileByFilename{
+				FileByFilename: "connect/ping/v1/ping.proto",
+			},
+		})
+		assert.Equal(t, len(response.GetFileDescriptorResponse().GetFileDescriptorProto()), 1)
+
+		response = call(&reflectionv1alpha.ServerReflectionRequest{
+			MessageRequest: &reflectionv1alpha.ServerReflectionRequest_AllExtensionNumbersOfType{
+				AllExtensionNumbersOfType: "connect.ping.v1.PingRequest",
+			},
+		})
+		assert.Equal(t, response.GetAllExtensionNumbersResponse().GetBaseTypeName(), "connect.ping.v1.PingRequest")
+		assert.Zero(t, len(response.GetAllExtensionNumbersResponse().GetExtensionNumber()))
+
+		// Unknown symbols don't end the stream.
+		response = call(&reflectionv1alpha.ServerReflectionRequest{
+			MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: "acme.foo.v1.FooService",
+			},
+		})
+		assert.Equal(t, response.GetErrorResponse().GetErrorCode(), int32(connect.CodeNotFound))
+		assert.Equal(t, response.GetOriginalRequest().GetFileContainingSymbol(), "acme.foo.v1.FooService")
+
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+	}
+	for _, serviceName := range []string{grpcreflect.ReflectV1ServiceName, grpcreflect.ReflectV1AlphaServiceName} {
+		serviceName := serviceName
+		t.Run(serviceName, func(t *testing.T) {
+			t.Parallel()
+			t.Run("grpc", func(t *testing.T) {
+				testReflection(t, serviceName, connect.WithGRPC())
+			})
+			t.Run("connect", func(t *testing.T) {
+				testReflection(t, serviceName)
+			})
+		})
+	}
+}
+
+func TestReflectionVendoredHealth(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(grpcreflect.NewHandlerV1(grpcreflect.NewStaticReflector(grpchealth.HealthV1ServiceName)))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse](
+		server.Client(),
+		server.URL+"/"+grpcreflect.ReflectV1ServiceName+"/ServerReflectionInfo",
+	)
+	stream := client.CallBidiStream(context.Background())
+	call := func(request *reflectionv1alpha.ServerReflectionRequest) *reflectionv1alpha.ServerReflectionResponse {
+		t.Helper()
+		assert.Nil(t, stream.Send(request))
+		response, err := stream.Receive()
+		assert.Nil(t, err)
+		return response
+	}
+
+	// The messages are registered as connectext.grpc.health.v1, but clients
+	// look the service up by its public name.
+	response := call(&reflectionv1alpha.ServerReflectionRequest{
+		MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: grpchealth.HealthV1ServiceName,
+		},
+	})
+	files := response.GetFileDescriptorResponse().GetFileDescriptorProto()
+	assert.Equal(t, len(files), 1)
+	var file descriptorpb.FileDescriptorProto
+	assert.Nil(t, proto.Unmarshal(files[0], &file))
+	assert.Equal(t, file.GetName(), "grpc/health/v1/health.proto")
+	assert.Equal(t, file.GetPackage(), "grpc.health.v1")
+	assert.Equal(t, len(file.GetService()), 1)
+	methods := file.GetService()[0].GetMethod()
+	assert.Equal(t, len(methods), 2)
+	assert.Equal(t, methods[0].GetName(), "Check")
+	assert.Equal(t, methods[0].GetInputType(), ".grpc.health.v1.HealthCheckRequest")
+	assert.Equal(t, methods[1].GetName(), "Watch")
+	assert.True(t, methods[1].GetServerStreaming())
+	for _, message := range file.GetMessageType() {
+		for _, field := range message.GetField() {
+			if field.TypeName != nil {
+				assert.Equal(t, field.GetTypeName(), ".grpc.health.v1.HealthCheckResponse.ServingStatus")
+			}
+		}
+	}
+
+	response = call(&reflectionv1alpha.ServerReflectionRequest{
+		MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileByFilename{
+			FileByFilename: "grpc/health/v1/health.proto",
+		},
+	})
+	assert.Equal(t, len(response.GetFileDescriptorResponse().GetFileDescriptorProto()), 1)
+
+	assert.Nil(t, stream.CloseRequest())
+	assert.Nil(t, stream.CloseResponse())
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // A Handler is the server-side implementation of a single RPC defined by a
@@ -29,8 +30,15 @@ import (
 type Handler struct {
 	spec             Spec
 	implementation   StreamingHandlerFunc
-	protocolHandlers []protocolHandler
-	acceptPost       string // Accept-Post header
+	protocolHandlers map[string][]ProtocolHandler // by HTTP method
+	allowMethod      string                       // Allow header
+	acceptPost       string                       // Accept-Post header
+	defaultTimeout   time.Duration
+	maxTimeout       time.Duration
+	drainer          *Drainer
+	limiter          *concurrencyLimiter
+	rejected         StreamingHandlerFunc   // serves calls rejected by the limiter
+	transcoding      *ProtocolHandlerParams // nil unless the procedure is unary
 }
 
 // NewUnaryHandler constructs a [Handler] for a request-response procedure.
@@ -57,11 +65,14 @@ func NewUnaryHandler[Req, Res any](
 		return res, err
 	})
 	config := newHandlerConfig(procedure, options)
+	if config.cachesResponses() {
+		untyped = newCachingUnaryFunc[Res](config, untyped)
+	}
 	if interceptor := config.Interceptor; interceptor != nil {
 		untyped = interceptor.WrapUnary(untyped)
 	}
 	// Given a stream, how should we call the unary function?
-	implementation := func(ctx context.Context, conn StreamingHandlerConn) error {
+	implementation := StreamingHandlerFunc(func(ctx context.Context, conn StreamingHandlerConn) error {
 		var msg Req
 		if err := conn.Receive(&msg); err != nil {
 			return err
@@ -79,15 +90,39 @@ func NewUnaryHandler[Req, Res any](
 		mergeHeaders(conn.ResponseHeader(), response.Header())
 		mergeHeaders(conn.ResponseTrailer(), response.Trailer())
 		return conn.Send(response.Any())
+	})
+
+	// Rejected calls go through the interceptors, but not the implementation.
+	rejectedUnary := UnaryFunc(func(ctx context.Context, _ AnyRequest) (AnyResponse, error) {
+		return nil, limitErrorFromContext(ctx)
+	})
+	if interceptor := config.Interceptor; interceptor != nil {
+		rejectedUnary = interceptor.WrapUnary(rejectedUnary)
 	}
+	rejected := StreamingHandlerFunc(func(ctx context.Context, conn StreamingHandlerConn) error {
+		_, err := rejectedUnary(ctx, &Request[Req]{
+			Msg:    new(Req),
+			spec:   conn.Spec(),
+			peer:   conn.Peer(),
+			header: conn.RequestHeader(),
+		})
+		return err
+	})
 
 	protocolHandlers := config.newProtocolHandlers(StreamTypeUnary)
-	return &Handler{
+	return config.register(&Handler{
 		spec:             config.newSpec(StreamTypeUnary),
-		implementation:   implementation,
-		protocolHandlers: protocolHandlers,
+		implementation:   config.wrapRequestInitializer(config.wrapValidators(implementation)),
+		protocolHandlers: mappedMethodHandlers(protocolHandlers),
+		allowMethod:      sortedAllowMethodValue(protocolHandlers),
 		acceptPost:       sortedAcceptPostValue(protocolHandlers),
-	}
+		defaultTimeout:   config.DefaultTimeout,
+		maxTimeout:       config.MaxTimeout,
+		drainer:          config.Drainer,
+		limiter:          config.newLimiter(),
+		rejected:         rejected,
+		transcoding:      config.newTranscodingParams(),
+	})
 }
 
 // NewClientStreamHandler constructs a [Handler] for a client streaming procedure.
@@ -140,7 +175,7 @@ func NewServerStreamHandler[Req, Res any](
 					peer:   conn.Peer(),
 					header: conn.RequestHeader(),
 				},
-				&ServerStream[Res]{conn: conn},
+				&ServerStream[Res]{conn: conn, tokens: resumeTokenSenderFromContext(ctx)},
 			)
 		},
 		options...,
@@ -182,18 +217,20 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 		return
 	}
 
-	// The gRPC-HTTP2, gRPC-Web, and Connect protocols are all POST-only.
-	if request.Method != http.MethodPost {
-		responseWriter.Header().Set("Allow", http.MethodPost)
+	// The gRPC-HTTP2 and gRPC-Web protocols are POST-only, and the Connect
+	// protocol only allows GET for side-effect-free unary procedures.
+	protocolHandlers := h.protocolHandlers[request.Method]
+	if len(protocolHandlers) == 0 {
+		responseWriter.Header().Set("Allow", h.allowMethod)
 		responseWriter.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Find our implementation of the RPC protocol in use.
 	contentType := canonicalizeContentType(request.Header.Get("Content-Type"))
-	var protocolHandler protocolHandler
-	for _, handler := range h.protocolHandlers {
-		if _, ok := handler.ContentTypes()[contentType]; ok {
+	var protocolHandler ProtocolHandler
+	for _, handler := range protocolHandlers {
+		if handler.CanHandlePayload(request, contentType) {
 			protocolHandler = handler
 			break
 		}
@@ -204,8 +241,12 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 		return
 	}
 
-	// Establish a stream and serve the RPC.
-	request.Header.Set("Content-Type", contentType)                // prefer canonicalized value
+	request.Header.Set("Content-Type", contentType) // prefer canonicalized value
+	h.serve(responseWriter, request, protocolHandler)
+}
+
+// serve establishes a stream with the chosen protocol and serves the RPC.
+func (h *Handler) serve(responseWriter http.ResponseWriter, request *http.Request, protocolHandler ProtocolHandler) {
 	ctx, cancel, timeoutErr := protocolHandler.SetTimeout(request) //nolint: contextcheck
 	if timeoutErr != nil {
 		ctx = request.Context()
@@ -213,6 +254,10 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	if cancel != nil {
 		defer cancel()
 	}
+	ctx, cancel = h.boundTimeout(ctx)
+	if cancel != nil {
+		defer cancel()
+	}
 	connCloser, ok := protocolHandler.NewConn(
 		responseWriter,
 		request.WithContext(ctx),
@@ -226,7 +271,52 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 		_ = connCloser.Close(timeoutErr)
 		return
 	}
-	_ = connCloser.Close(h.implementation(ctx, connCloser))
+	if h.spec.StreamType == StreamTypeServer {
+		ctx = withResumeTokenSender(ctx, connCloser)
+	}
+	var finish func(error) error
+	if h.drainer != nil {
+		var call *drainingCall
+		var drainErr *Error
+		ctx, call, drainErr = h.drainer.begin(ctx, request.Body)
+		if drainErr != nil {
+			_ = connCloser.Close(drainErr)
+			return
+		}
+		defer h.drainer.end(call)
+		finish = call.finish
+	}
+	implementation := h.implementation
+	var err error
+	if h.limiter != nil {
+		var release func(error)
+		ctx, release = h.limiter.acquire(ctx)
+		if release == nil {
+			implementation = h.rejected
+		} else {
+			// Release after closing, so the limit reflects the whole call.
+			defer func() { release(err) }()
+		}
+	}
+	err = implementation(ctx, connCloser)
+	if finish != nil {
+		err = finish(err)
+	}
+	_ = connCloser.Close(err)
+}
+
+// boundTimeout supplies the default timeout if the client didn't send one, and
+// clamps the deadline to the maximum timeout.
+func (h *Handler) boundTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := h.maxTimeout
+	if _, ok := ctx.Deadline(); !ok && h.defaultTimeout > 0 && (timeout <= 0 || h.defaultTimeout < timeout) {
+		timeout = h.defaultTimeout
+	}
+	if timeout <= 0 {
+		return ctx, nil
+	}
+	// If the client's deadline is sooner, it takes precedence.
+	return context.WithTimeout(ctx, timeout)
 }
 
 type handlerConfig struct {
@@ -238,10 +328,25 @@ type handlerConfig struct {
 	Procedure                    string
 	HandleGRPC                   bool
 	HandleGRPCWeb                bool
+	HandleTwirp                  bool
+	Protocols                    []Protocol
 	RequireConnectProtocolHeader bool
 	BufferPool                   *bufferPool
 	ReadMaxBytes                 int
 	SendMaxBytes                 int
+	IdempotencyLevel             IdempotencyLevel
+	DefaultTimeout               time.Duration
+	MaxTimeout                   time.Duration
+	ETag                         func(context.Context, AnyRequest) (string, error)
+	CacheMaxAge                  time.Duration
+	Schema                       any
+	RequestInitializer           func(Spec, any) error
+	ResponseInitializer          func(Spec, any) error
+	Validators                   []Validator
+	ValidateSends                bool
+	RegisterSpec                 func(Spec)
+	Drainer                      *Drainer
+	NewLimiter                   func() *concurrencyLimiter
 }
 
 func newHandlerConfig(procedure string, options []HandlerOption) *handlerConfig {
@@ -263,42 +368,107 @@ func newHandlerConfig(procedure string, options []HandlerOption) *handlerConfig
 	return &config
 }
 
+// cachesResponses reports whether the handler sets cache headers and answers
+// revalidations. Only side-effect-free procedures are cacheable.
+func (c *handlerConfig) cachesResponses() bool {
+	return c.IdempotencyLevel == IdempotencyNoSideEffects
+}
+
 func (c *handlerConfig) newSpec(streamType StreamType) Spec {
 	return Spec{
-		Procedure:  c.Procedure,
-		StreamType: streamType,
+		Procedure:        c.Procedure,
+		StreamType:       streamType,
+		IdempotencyLevel: c.IdempotencyLevel,
+		Schema:           c.Schema,
 	}
 }
 
-func (c *handlerConfig) newProtocolHandlers(streamType StreamType) []protocolHandler {
-	protocols := []protocol{&protocolConnect{}}
+// wrapRequestInitializer prepares each message before the conn receives into
+// it, if the handler has a request initializer. It wraps any interceptors, so
+// they see prepared messages too.
+func (c *handlerConfig) wrapRequestInitializer(implementation StreamingHandlerFunc) StreamingHandlerFunc {
+	if c.RequestInitializer == nil {
+		return implementation
+	}
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return implementation(ctx, &initializingHandlerConn{
+			StreamingHandlerConn: conn,
+			initialize:           c.RequestInitializer,
+		})
+	}
+}
+
+// initializeResponse prepares a response message that the handler constructs
+// itself. Messages of compile-time types need no preparation.
+func (c *handlerConfig) initializeResponse(spec Spec, msg any) error {
+	if c.ResponseInitializer == nil {
+		return nil
+	}
+	return c.ResponseInitializer(spec, msg)
+}
+
+// newLimiter constructs the handler's concurrency limiter, if it has one.
+func (c *handlerConfig) newLimiter() *concurrencyLimiter {
+	if c.NewLimiter == nil {
+		return nil
+	}
+	return c.NewLimiter()
+}
+
+// register reports a new handler's Spec to its Mux, if any.
+func (c *handlerConfig) register(handler *Handler) *Handler {
+	if c.RegisterSpec != nil {
+		c.RegisterSpec(handler.spec)
+	}
+	return handler
+}
+
+func (c *handlerConfig) newProtocolHandlers(streamType StreamType) []ProtocolHandler {
+	var protocols []Protocol
+	if c.HandleTwirp {
+		// Twirp's content types overlap with Connect's, so it must come first.
+		protocols = append(protocols, &protocolTwirp{})
+	}
+	protocols = append(protocols, &protocolConnect{requireProtocolHeader: c.RequireConnectProtocolHeader})
 	if c.HandleGRPC {
 		protocols = append(protocols, &protocolGRPC{web: false})
 	}
 	if c.HandleGRPCWeb {
 		protocols = append(protocols, &protocolGRPC{web: true})
 	}
-	handlers := make([]protocolHandler, 0, len(protocols))
-	codecs := newReadOnlyCodecs(c.Codecs)
-	compressors := newReadOnlyCompressionPools(
-		c.CompressionPools,
-		c.CompressionNames,
-	)
+	protocols = append(protocols, c.Protocols...)
+	handlers := make([]ProtocolHandler, 0, len(protocols))
+	spec := c.newSpec(streamType)
 	for _, protocol := range protocols {
-		handlers = append(handlers, protocol.NewHandler(&protocolHandlerParams{
-			Spec:                         c.newSpec(streamType),
-			Codecs:                       codecs,
-			CompressionPools:             compressors,
-			CompressMinBytes:             c.CompressMinBytes,
-			BufferPool:                   c.BufferPool,
-			ReadMaxBytes:                 c.ReadMaxBytes,
-			SendMaxBytes:                 c.SendMaxBytes,
-			RequireConnectProtocolHeader: c.RequireConnectProtocolHeader,
-		}))
+		handlers = append(handlers, protocol.NewHandler(c.newProtocolHandlerParams(spec)))
 	}
 	return handlers
 }
 
+func (c *handlerConfig) newProtocolHandlerParams(spec Spec) *ProtocolHandlerParams {
+	return &ProtocolHandlerParams{
+		Spec:             spec,
+		codecs:           newReadOnlyCodecs(c.Codecs),
+		compressionPools: newReadOnlyCompressionPools(c.CompressionPools, c.CompressionNames),
+		CompressMinBytes: c.CompressMinBytes,
+		bufferPool:       c.BufferPool,
+		ReadMaxBytes:     c.ReadMaxBytes,
+		SendMaxBytes:     c.SendMaxBytes,
+	}
+}
+
+// newTranscodingParams bundles the configuration that HTTP/JSON transcoding
+// needs. Transcoding always uses JSON, and it doesn't support compression.
+func (c *handlerConfig) newTranscodingParams() *ProtocolHandlerParams {
+	return &ProtocolHandlerParams{
+		Spec:         c.newSpec(StreamTypeUnary),
+		codecs:       newReadOnlyCodecs(c.Codecs),
+		bufferPool:   c.BufferPool,
+		ReadMaxBytes: c.ReadMaxBytes,
+		SendMaxBytes: c.SendMaxBytes,
+	}
+}
+
 func newStreamHandler(
 	procedure string,
 	streamType StreamType,
@@ -306,14 +476,40 @@ func newStreamHandler(
 	options ...HandlerOption,
 ) *Handler {
 	config := newHandlerConfig(procedure, options)
+	rejected := StreamingHandlerFunc(func(ctx context.Context, _ StreamingHandlerConn) error {
+		return limitErrorFromContext(ctx)
+	})
 	if ic := config.Interceptor; ic != nil {
 		implementation = ic.WrapStreamingHandler(implementation)
+		rejected = ic.WrapStreamingHandler(rejected)
 	}
 	protocolHandlers := config.newProtocolHandlers(streamType)
-	return &Handler{
+	return config.register(&Handler{
 		spec:             config.newSpec(streamType),
-		implementation:   implementation,
-		protocolHandlers: protocolHandlers,
+		implementation:   config.wrapRequestInitializer(config.wrapValidators(implementation)),
+		protocolHandlers: mappedMethodHandlers(protocolHandlers),
+		allowMethod:      sortedAllowMethodValue(protocolHandlers),
 		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+		defaultTimeout:   config.DefaultTimeout,
+		maxTimeout:       config.MaxTimeout,
+		drainer:          config.Drainer,
+		limiter:          config.newLimiter(),
+		rejected:         rejected,
+	})
+}
+
+// initializingHandlerConn prepares messages to receive requests, so handlers
+// can work with messages that aren't usable as zero values, like
+// dynamicpb.Message.
+type initializingHandlerConn struct {
+	StreamingHandlerConn
+
+	initialize func(Spec, any) error
+}
+
+func (hc *initializingHandlerConn) Receive(msg any) error {
+	if err := hc.initialize(hc.Spec(), msg); err != nil {
+		return NewError(CodeInternal, err)
 	}
+	return hc.StreamingHandlerConn.Receive(msg)
 }
@@ -59,9 +59,7 @@ func Example_handler() {
 		mux,
 	)
 	// To serve HTTP/2 requests without TLS (as many gRPC clients expect), import
-	// golang.org/x/net/http2/h2c and golang.org/x/net/http2 and change to:
-	// _ = http.ListenAndServe(
-	// 	"localhost:8080",
-	// 	h2c.NewHandler(mux, &http2.Server{}),
-	// )
+	// github.com/joshcarp/connect-no/connecthttp2 and change to:
+	// server, _ := connecthttp2.NewServer("localhost:8080", mux, connecthttp2.Options{})
+	// _ = server.ListenAndServe()
 }
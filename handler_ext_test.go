@@ -42,7 +42,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		t.Parallel()
 		request, err := http.NewRequestWithContext(
 			context.Background(),
-			http.MethodGet,
+			http.MethodPut,
 			server.URL+pingProcedure,
 			strings.NewReader(""),
 		)
@@ -51,7 +51,8 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		assert.Nil(t, err)
 		defer resp.Body.Close()
 		assert.Equal(t, resp.StatusCode, http.StatusMethodNotAllowed)
-		assert.Equal(t, resp.Header.Get("Allow"), http.MethodPost)
+		// Ping has no side effects, so Connect clients may also use GET.
+		assert.Equal(t, resp.Header.Get("Allow"), http.MethodGet+", "+http.MethodPost)
 	})
 
 	t.Run("unsupported_content_type", func(t *testing.T) {
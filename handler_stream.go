@@ -86,7 +86,8 @@ func (c *ClientStream[Req]) Conn() StreamingHandlerConn {
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type ServerStream[Res any] struct {
-	conn StreamingHandlerConn
+	conn   StreamingHandlerConn
+	tokens resumeTokenSender
 }
 
 // ResponseHeader returns the response headers. Headers are sent with the first
@@ -116,6 +117,32 @@ func (s *ServerStream[Res]) Send(msg *Res) error {
 	return s.conn.Send(msg)
 }
 
+// SendWithResumeToken sends a message to the client along with an opaque
+// resume token. If the stream breaks, clients configured with
+// [WithStreamResumption] reconnect and send the token of the last message
+// they received; see [ServerStream.ResumeToken]. Tokens are only sent to
+// clients that ask for them, and an empty token sends just the message.
+//
+// Once a stream sends a message with a resume token, every subsequent message
+// should have one too: clients resume from the most recent token they
+// received, so messages without tokens would be sent again.
+func (s *ServerStream[Res]) SendWithResumeToken(msg *Res, token string) error {
+	if token != "" && s.tokens != nil {
+		if err := s.tokens.sendResumeToken(token); err != nil {
+			return err
+		}
+	}
+	return s.Send(msg)
+}
+
+// ResumeToken returns the resume token sent by a client that's reconnecting
+// after its stream broke, or an empty string if the client is starting a new
+// stream. Handlers should continue with the message after the one they sent
+// with the token.
+func (s *ServerStream[Res]) ResumeToken() string {
+	return s.conn.RequestHeader().Get(headerResumeToken)
+}
+
 // Conn exposes the underlying StreamingHandlerConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (s *ServerStream[Res]) Conn() StreamingHandlerConn {
@@ -0,0 +1,196 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// HedgingPolicy configures hedged unary calls for a [Client]. See
+// [WithHedgingPolicy].
+type HedgingPolicy struct {
+	// MaxAttempts is the maximum number of copies of a request, including the
+	// original. Values less than 2 disable hedging.
+	MaxAttempts int
+	// Delay is how long the client waits for a response before sending the
+	// next copy of the request. Zero sends all the copies at once.
+	Delay time.Duration
+	// NonFatalCodes are the error codes that don't end the call. When an
+	// attempt fails with one of these codes, the client sends the next copy
+	// immediately (if any remain) and otherwise keeps waiting for the
+	// outstanding attempts. Any other error is returned to the caller at once.
+	// By default, all errors are fatal.
+	NonFatalCodes []Code
+	// Stats, if non-nil, counts the calls hedged by the policy. Stats may be
+	// shared between clients.
+	Stats *HedgingStats
+}
+
+// HedgingStats counts hedged calls, so that operators can see how often hedges
+// are sent and how often they beat the original request. The zero value is
+// ready to use, and HedgingStats is safe to use concurrently.
+type HedgingStats struct {
+	calls       atomic.Int64
+	hedgedCalls atomic.Int64
+	hedges      atomic.Int64
+	hedgeWins   atomic.Int64
+}
+
+// Calls returns the number of calls made with the hedging policy.
+func (s *HedgingStats) Calls() int64 {
+	return s.calls.Load()
+}
+
+// HedgedCalls returns the number of calls that sent at least one hedge.
+func (s *HedgingStats) HedgedCalls() int64 {
+	return s.hedgedCalls.Load()
+}
+
+// Hedges returns the total number of additional copies of requests sent.
+func (s *HedgingStats) Hedges() int64 {
+	return s.hedges.Load()
+}
+
+// HedgeWins returns the number of calls that succeeded with the response to a
+// hedge rather than the original request. The hedge win rate is HedgeWins
+// divided by HedgedCalls.
+func (s *HedgingStats) HedgeWins() int64 {
+	return s.hedgeWins.Load()
+}
+
+// hedgingPolicy is a HedgingPolicy with its codes indexed.
+type hedgingPolicy struct {
+	HedgingPolicy
+
+	nonFatalCodes map[Code]struct{}
+}
+
+func newHedgingPolicy(policy HedgingPolicy) *hedgingPolicy {
+	if policy.Delay < 0 {
+		policy.Delay = 0
+	}
+	nonFatal := make(map[Code]struct{}, len(policy.NonFatalCodes))
+	for _, code := range policy.NonFatalCodes {
+		nonFatal[code] = struct{}{}
+	}
+	return &hedgingPolicy{
+		HedgingPolicy: policy,
+		nonFatalCodes: nonFatal,
+	}
+}
+
+// appliesTo reports whether calls to the procedure may be hedged. Only unary
+// procedures without side effects are safe to execute more than once
+// concurrently.
+func (p *hedgingPolicy) appliesTo(spec Spec) bool {
+	return p != nil &&
+		p.MaxAttempts >= 2 &&
+		spec.StreamType == StreamTypeUnary &&
+		spec.IdempotencyLevel == IdempotencyNoSideEffects
+}
+
+func (p *hedgingPolicy) isFatal(err error) bool {
+	_, nonFatal := p.nonFatalCodes[CodeOf(err)]
+	return !nonFatal
+}
+
+type hedgeResult struct {
+	attempt  int
+	response AnyResponse
+	err      error
+}
+
+// callUnaryWithHedging sends the request, and then sends another copy each
+// time the policy's delay passes without a response. It returns the first
+// successful response or fatal error, and cancels the remaining attempts.
+func callUnaryWithHedging(
+	ctx context.Context,
+	policy *hedgingPolicy,
+	request AnyRequest,
+	callOnce func(context.Context, AnyRequest, http.Header) (AnyResponse, error),
+) (AnyResponse, error) {
+	// Canceling the shared context cancels any attempts still in flight once
+	// we return.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, policy.MaxAttempts)
+	sent, pending := 0, 0
+	send := func() {
+		attempt := sent
+		header := request.Header().Clone()
+		if attempt > 0 {
+			header[headerPreviousRPCAttempts] = []string{strconv.Itoa(attempt)}
+		}
+		sent++
+		pending++
+		go func() {
+			response, err := callOnce(ctx, request, header)
+			results <- hedgeResult{attempt: attempt, response: response, err: err}
+		}()
+	}
+	defer func() {
+		if stats := policy.Stats; stats != nil {
+			stats.calls.Add(1)
+			if sent > 1 {
+				stats.hedgedCalls.Add(1)
+				stats.hedges.Add(int64(sent - 1))
+			}
+		}
+	}()
+
+	// Each attempt restarts the hedging delay.
+	var timer *time.Timer
+	hedge := func() {
+		send()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.NewTimer(policy.Delay)
+	}
+	defer func() { timer.Stop() }()
+
+	hedge()
+	for {
+		var hedgeTimer <-chan time.Time
+		if sent < policy.MaxAttempts {
+			hedgeTimer = timer.C
+		}
+		select {
+		case <-hedgeTimer:
+			hedge()
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				if stats := policy.Stats; stats != nil && result.attempt > 0 {
+					stats.hedgeWins.Add(1)
+				}
+				return result.response, nil
+			}
+			if policy.isFatal(result.err) {
+				return nil, result.err
+			}
+			if sent < policy.MaxAttempts {
+				// Don't wait out the delay: this attempt has already failed.
+				hedge()
+			} else if pending == 0 {
+				return nil, result.err
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestHedgingPolicy(t *testing.T) {
+	t.Parallel()
+	// newServer starts a server whose Ping procedure calls hook with the
+	// Grpc-Previous-Rpc-Attempts header of each attempt. The returned function
+	// lists the headers seen so far.
+	newServer := func(t *testing.T, hook func(context.Context, string) error) (*httptest.Server, func() []string) {
+		t.Helper()
+		var mu sync.Mutex
+		var attempts []string
+		server := newPingServer(t, &pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				attempt := request.Header().Get("Grpc-Previous-Rpc-Attempts")
+				mu.Lock()
+				attempts = append(attempts, attempt)
+				mu.Unlock()
+				if err := hook(ctx, attempt); err != nil {
+					return nil, err
+				}
+				return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+			},
+		})
+		return server, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), attempts...)
+		}
+	}
+	t.Run("hedge_wins", func(t *testing.T) {
+		t.Parallel()
+		canceled := make(chan struct{})
+		server, previousAttempts := newServer(t, func(ctx context.Context, attempt string) error {
+			if attempt == "" {
+				// The original request stalls until the hedge wins.
+				<-ctx.Done()
+				close(canceled)
+				return ctx.Err()
+			}
+			return nil
+		})
+		var stats connect.HedgingStats
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHedgingPolicy(connect.HedgingPolicy{
+			MaxAttempts: 2,
+			Delay:       10 * time.Millisecond,
+			Stats:       &stats,
+		}))
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+		select {
+		case <-canceled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("original request wasn't canceled")
+		}
+		// Under load, the hedge may reach the server before the original.
+		attempts := previousAttempts()
+		sort.Strings(attempts)
+		assert.Equal(t, attempts, []string{"", "1"})
+		assert.Equal(t, stats.Calls(), 1)
+		assert.Equal(t, stats.HedgedCalls(), 1)
+		assert.Equal(t, stats.Hedges(), 1)
+		assert.Equal(t, stats.HedgeWins(), 1)
+	})
+	t.Run("original_wins", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, func(context.Context, string) error { return nil })
+		var stats connect.HedgingStats
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHedgingPolicy(connect.HedgingPolicy{
+			MaxAttempts: 3,
+			Delay:       time.Minute,
+			Stats:       &stats,
+		}))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, len(previousAttempts()), 1)
+		assert.Equal(t, stats.Calls(), 1)
+		assert.Equal(t, stats.HedgedCalls(), 0)
+		assert.Equal(t, stats.HedgeWins(), 0)
+	})
+	t.Run("non_fatal", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, func(_ context.Context, attempt string) error {
+			if attempt == "" {
+				return connect.NewError(connect.CodeUnavailable, errors.New("oops"))
+			}
+			return nil
+		})
+		var stats connect.HedgingStats
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHedgingPolicy(connect.HedgingPolicy{
+			MaxAttempts:   2,
+			Delay:         time.Minute, // the failure sends the hedge immediately
+			NonFatalCodes: []connect.Code{connect.CodeUnavailable},
+			Stats:         &stats,
+		}))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, previousAttempts(), []string{"", "1"})
+		assert.Equal(t, stats.HedgeWins(), 1)
+	})
+	t.Run("fatal", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, func(context.Context, string) error {
+			return connect.NewError(connect.CodeUnavailable, errors.New("oops"))
+		})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHedgingPolicy(connect.HedgingPolicy{
+			MaxAttempts: 2,
+			Delay:       time.Minute,
+		}))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, len(previousAttempts()), 1)
+	})
+	t.Run("all_fail", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, func(context.Context, string) error {
+			return connect.NewError(connect.CodeUnavailable, errors.New("oops"))
+		})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHedgingPolicy(connect.HedgingPolicy{
+			MaxAttempts:   3,
+			NonFatalCodes: []connect.Code{connect.CodeUnavailable},
+		}))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, len(previousAttempts()), 3)
+	})
+	t.Run("side_effects", func(t *testing.T) {
+		t.Parallel()
+		server, _ := newServer(t, func(context.Context, string) error { return nil })
+		var stats connect.HedgingStats
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithHedgingPolicy(connect.HedgingPolicy{
+			MaxAttempts: 3,
+			Stats:       &stats,
+		}))
+		// Fail has side effects, so it's never hedged.
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1_test.FailRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+		assert.Equal(t, stats.Calls(), 0)
+	})
+}
@@ -0,0 +1,59 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import "fmt"
+
+// An IdempotencyLevel declares whether a procedure has side effects. It
+// determines whether a call may be safely replayed and which HTTP methods a
+// procedure may be called with.
+//
+// The values mirror the google.protobuf.MethodOptions.IdempotencyLevel
+// enumeration, so generated code can convert between them directly.
+type IdempotencyLevel int
+
+const (
+	// IdempotencyUnknown is the default idempotency level. Procedures with this
+	// level may have side effects, and it's appropriate for any procedure.
+	IdempotencyUnknown IdempotencyLevel = 0
+
+	// IdempotencyNoSideEffects indicates that a procedure doesn't mutate any
+	// state, like the "safe" methods in [RFC 9110 § 9.2.1]. Such procedures are
+	// suitable for queries: Connect clients may call them with HTTP GET, and
+	// they're always safe to retry.
+	//
+	// [RFC 9110 § 9.2.1]: https://www.rfc-editor.org/rfc/rfc9110.html#section-9.2.1
+	IdempotencyNoSideEffects IdempotencyLevel = 1
+
+	// IdempotencyIdempotent indicates that repeating a call has the same side
+	// effects as making it once, like the "idempotent" methods in
+	// [RFC 9110 § 9.2.2]. Deleting an entity by ID is a typical example. Such
+	// procedures are safe to retry, but they must still use HTTP POST.
+	//
+	// [RFC 9110 § 9.2.2]: https://www.rfc-editor.org/rfc/rfc9110.html#section-9.2.2
+	IdempotencyIdempotent IdempotencyLevel = 2
+)
+
+func (i IdempotencyLevel) String() string {
+	switch i {
+	case IdempotencyUnknown:
+		return "idempotency_unknown"
+	case IdempotencyNoSideEffects:
+		return "no_side_effects"
+	case IdempotencyIdempotent:
+		return "idempotent"
+	}
+	return fmt.Sprintf("idempotency_%d", int(i))
+}
@@ -41,7 +41,7 @@ const (
 
 // CollideServiceClient is a client for the connect.collide.v1.CollideService service.
 type CollideServiceClient interface {
-	Import(context.Context, *connect_go.Request[v1.ImportRequest]) (*connect_go.Response[v1.ImportResponse], error)
+	Import(context.Context, *connect_go.Request[v1.ImportRequest], ...connect_go.CallOption) (*connect_go.Response[v1.ImportResponse], error)
 }
 
 // NewCollideServiceClient constructs a client for the connect.collide.v1.CollideService service. By
@@ -68,8 +68,8 @@ type collideServiceClient struct {
 }
 
 // Import calls connect.collide.v1.CollideService.Import.
-func (c *collideServiceClient) Import(ctx context.Context, req *connect_go.Request[v1.ImportRequest]) (*connect_go.Response[v1.ImportResponse], error) {
-	return c._import.CallUnary(ctx, req)
+func (c *collideServiceClient) Import(ctx context.Context, req *connect_go.Request[v1.ImportRequest], opts ...connect_go.CallOption) (*connect_go.Response[v1.ImportResponse], error) {
+	return c._import.CallUnary(ctx, req, opts...)
 }
 
 // CollideServiceHandler is an implementation of the connect.collide.v1.CollideService service.
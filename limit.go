@@ -0,0 +1,225 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdaptiveInitialLimit  = 20
+	defaultAdaptiveMinLimit      = 1
+	defaultAdaptiveMaxLimit      = 1000
+	defaultAdaptiveTargetLatency = time.Second
+	defaultAdaptiveBackoffRatio  = 0.9
+)
+
+// AdaptiveConcurrencyPolicy configures a concurrency limit that adapts to the
+// handler's latency, using additive increase and multiplicative decrease
+// (AIMD). See [WithAdaptiveConcurrencyLimit].
+type AdaptiveConcurrencyPolicy struct {
+	// InitialLimit is the number of concurrent calls allowed at first. It
+	// defaults to 20.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the limit. They default to 1 and 1000.
+	MinLimit int
+	MaxLimit int
+	// TargetLatency is the longest a call should take. Calls that take longer,
+	// or that fail with CodeDeadlineExceeded, shrink the limit. It defaults to
+	// 1s.
+	TargetLatency time.Duration
+	// BackoffRatio is the factor by which slow calls shrink the limit. It
+	// defaults to 0.9.
+	BackoffRatio float64
+	// MaxWait is how long calls over the limit may wait for a slot before
+	// they're rejected. Zero rejects them immediately.
+	MaxWait time.Duration
+}
+
+// LimitInfo describes how a handler's concurrency limit treated a call.
+// Interceptors can retrieve it with [LimitInfoFromContext].
+type LimitInfo struct {
+	// Limit is the number of concurrent calls allowed when the call arrived.
+	Limit int
+	// InFlight is the number of calls being served when the call arrived,
+	// not including the call itself.
+	InFlight int
+	// QueueWait is how long the call waited for a slot.
+	QueueWait time.Duration
+	// Rejected reports whether the call was rejected. Rejected calls still go
+	// through the handler's interceptors, which see a [CodeResourceExhausted]
+	// error, but the implementation isn't called and the request body isn't
+	// read. Unary interceptors see an empty request message.
+	//
+	// Calls whose context ends while they're waiting for a slot aren't
+	// rejected, but they also skip the implementation: interceptors see
+	// [CodeCanceled] or [CodeDeadlineExceeded] instead.
+	Rejected bool
+}
+
+// LimitInfoFromContext returns the [LimitInfo] for a call, if its handler has
+// a concurrency limit.
+func LimitInfoFromContext(ctx context.Context) (LimitInfo, bool) {
+	info, ok := ctx.Value(limitInfoKey{}).(LimitInfo)
+	return info, ok
+}
+
+type limitInfoKey struct{}
+
+// concurrencyLimiter admits calls while fewer than its limit are in flight,
+// and queues the rest for up to maxWait.
+type concurrencyLimiter struct {
+	maxWait  time.Duration
+	adaptive *AdaptiveConcurrencyPolicy // nil for static limits
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  []chan struct{} // FIFO, closed when admitted
+}
+
+func newStaticLimiter(limit int, maxWait time.Duration) *concurrencyLimiter {
+	if limit < 1 {
+		return nil
+	}
+	return &concurrencyLimiter{limit: float64(limit), maxWait: maxWait}
+}
+
+func newAdaptiveLimiter(policy AdaptiveConcurrencyPolicy) *concurrencyLimiter {
+	if policy.MinLimit < 1 {
+		policy.MinLimit = defaultAdaptiveMinLimit
+	}
+	if policy.MaxLimit < 1 {
+		policy.MaxLimit = defaultAdaptiveMaxLimit
+	}
+	if policy.MaxLimit < policy.MinLimit {
+		policy.MaxLimit = policy.MinLimit
+	}
+	if policy.InitialLimit < 1 {
+		policy.InitialLimit = defaultAdaptiveInitialLimit
+	}
+	if policy.TargetLatency <= 0 {
+		policy.TargetLatency = defaultAdaptiveTargetLatency
+	}
+	if policy.BackoffRatio <= 0 || policy.BackoffRatio >= 1 {
+		policy.BackoffRatio = defaultAdaptiveBackoffRatio
+	}
+	limit := math.Max(float64(policy.MinLimit), math.Min(float64(policy.InitialLimit), float64(policy.MaxLimit)))
+	return &concurrencyLimiter{
+		limit:    limit,
+		maxWait:  policy.MaxWait,
+		adaptive: &policy,
+	}
+}
+
+// acquire waits for a slot. It returns a context carrying the call's
+// LimitInfo and, if the call was admitted, a function to call with the
+// call's error once it's complete.
+func (l *concurrencyLimiter) acquire(ctx context.Context) (context.Context, func(error)) {
+	start := time.Now()
+	l.mu.Lock()
+	info := LimitInfo{Limit: l.currentLimit(), InFlight: l.inFlight}
+	if l.inFlight < info.Limit {
+		l.inFlight++
+		l.mu.Unlock()
+		return context.WithValue(ctx, limitInfoKey{}, info), l.releaser(time.Now())
+	}
+	if l.maxWait <= 0 {
+		l.mu.Unlock()
+		info.Rejected = true
+		return context.WithValue(ctx, limitInfoKey{}, info), nil
+	}
+	waiter := make(chan struct{})
+	l.waiters = append(l.waiters, waiter)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.maxWait)
+	defer timer.Stop()
+	admitted := false
+	select {
+	case <-waiter:
+		admitted = true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	if !admitted {
+		l.mu.Lock()
+		admitted = !l.removeWaiter(waiter) // already admitted by a release
+		l.mu.Unlock()
+	}
+	info.QueueWait = time.Since(start)
+	// If the caller gave up while queued, the limit didn't reject the call.
+	info.Rejected = !admitted && ctx.Err() == nil
+	ctx = context.WithValue(ctx, limitInfoKey{}, info)
+	if !admitted {
+		return ctx, nil
+	}
+	return ctx, l.releaser(time.Now())
+}
+
+func (l *concurrencyLimiter) releaser(admitted time.Time) func(error) {
+	return func(err error) {
+		latency := time.Since(admitted)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if policy := l.adaptive; policy != nil {
+			if latency > policy.TargetLatency || CodeOf(err) == CodeDeadlineExceeded {
+				l.limit = math.Max(float64(policy.MinLimit), l.limit*policy.BackoffRatio)
+			} else if l.inFlight*2 >= l.currentLimit() {
+				l.limit = math.Min(float64(policy.MaxLimit), l.limit+1)
+			}
+		}
+		l.inFlight--
+		for len(l.waiters) > 0 && l.inFlight < l.currentLimit() {
+			l.inFlight++
+			close(l.waiters[0])
+			l.waiters = l.waiters[1:]
+		}
+	}
+}
+
+// removeWaiter removes a waiter from the queue, reporting whether it was
+// still queued. It must be called with the mutex held.
+func (l *concurrencyLimiter) removeWaiter(waiter chan struct{}) bool {
+	for i, queued := range l.waiters {
+		if queued == waiter {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// currentLimit returns the limit as a whole number of calls. It must be
+// called with the mutex held.
+func (l *concurrencyLimiter) currentLimit() int {
+	return int(l.limit)
+}
+
+// limitErrorFromContext returns the error for a call that a concurrency limit
+// didn't admit: either it was rejected, or its context ended while it waited.
+func limitErrorFromContext(ctx context.Context) error {
+	info, _ := LimitInfoFromContext(ctx)
+	if !info.Rejected {
+		return wrapIfContextError(ctx.Err())
+	}
+	if info.QueueWait > 0 {
+		return errorf(CodeResourceExhausted, "concurrency limit of %d reached after waiting %v", info.Limit, info.QueueWait)
+	}
+	return errorf(CodeResourceExhausted, "concurrency limit of %d reached", info.Limit)
+}
@@ -0,0 +1,194 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+	// newServer starts a server whose Ping blocks until the request's number
+	// is received on release, and which records the LimitInfo and outcome of
+	// each call.
+	newServer := func(t *testing.T, option connect.HandlerOption) (pingv1connect_test.PingServiceClient, chan<- int64, <-chan struct{}, func() []limitedCall) {
+		t.Helper()
+		release := make(chan int64)
+		started := make(chan struct{}, 10)
+		var mu sync.Mutex
+		var calls []limitedCall
+		interceptor := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				info, ok := connect.LimitInfoFromContext(ctx)
+				assert.True(t, ok)
+				mu.Lock()
+				i := len(calls)
+				calls = append(calls, limitedCall{LimitInfo: info})
+				mu.Unlock()
+				response, err := next(ctx, request)
+				mu.Lock()
+				calls[i].done, calls[i].code = true, connect.CodeOf(err)
+				mu.Unlock()
+				return response, err
+			}
+		})
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect_test.NewPingServiceHandler(
+			&pluggablePingServer{
+				ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+					started <- struct{}{}
+					for number := range release {
+						if number == request.Msg.Number {
+							break
+						}
+					}
+					return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+				},
+			},
+			option,
+			connect.WithInterceptors(interceptor),
+		))
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+		return client, release, started, func() []limitedCall {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]limitedCall(nil), calls...)
+		}
+	}
+	ping := func(client pingv1connect_test.PingServiceClient, number int64) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: number}))
+			done <- err
+		}()
+		return done
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		t.Parallel()
+		client, release, started, infos := newServer(t, connect.WithConcurrencyLimit(1, 0))
+		first := ping(client, 1)
+		<-started
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 2}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		release <- 1
+		assert.Nil(t, <-first)
+		recorded := infos()
+		assert.Equal(t, len(recorded), 2)
+		assert.False(t, recorded[0].Rejected)
+		assert.True(t, recorded[1].Rejected)
+		assert.Equal(t, recorded[1].Limit, 1)
+		assert.Equal(t, recorded[1].InFlight, 1)
+	})
+	t.Run("queue", func(t *testing.T) {
+		t.Parallel()
+		client, release, started, infos := newServer(t, connect.WithConcurrencyLimit(1, 10*time.Second))
+		first := ping(client, 1)
+		<-started
+		second := ping(client, 2)
+		time.Sleep(50 * time.Millisecond) // let the second call queue
+		release <- 1
+		assert.Nil(t, <-first)
+		<-started
+		release <- 2
+		assert.Nil(t, <-second)
+		recorded := infos()
+		assert.Equal(t, len(recorded), 2)
+		assert.False(t, recorded[1].Rejected)
+		assert.True(t, recorded[1].QueueWait > 0)
+	})
+	t.Run("queue_timeout", func(t *testing.T) {
+		t.Parallel()
+		client, release, started, infos := newServer(t, connect.WithConcurrencyLimit(1, 10*time.Millisecond))
+		first := ping(client, 1)
+		<-started
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 2}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		release <- 1
+		assert.Nil(t, <-first)
+		recorded := infos()
+		assert.Equal(t, len(recorded), 2)
+		assert.True(t, recorded[1].Rejected)
+		assert.True(t, recorded[1].QueueWait >= 10*time.Millisecond)
+	})
+	t.Run("queue_deadline", func(t *testing.T) {
+		t.Parallel()
+		client, release, started, infos := newServer(t, connect.WithConcurrencyLimit(1, 10*time.Second))
+		first := ping(client, 1)
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1_test.PingRequest{Number: 2}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		// The client may give up before the handler does.
+		recorded := infos()
+		for len(recorded) < 2 || !recorded[1].done {
+			time.Sleep(time.Millisecond)
+			recorded = infos()
+		}
+		release <- 1
+		assert.Nil(t, <-first)
+		assert.False(t, recorded[1].Rejected)
+		// Depending on whether the deadline or the client's cancelation reaches
+		// the handler first, it sees either code, but never ResourceExhausted.
+		code := recorded[1].code
+		assert.True(t, code == connect.CodeDeadlineExceeded || code == connect.CodeCanceled)
+	})
+	t.Run("adaptive", func(t *testing.T) {
+		t.Parallel()
+		client, release, started, infos := newServer(t, connect.WithAdaptiveConcurrencyLimit(connect.AdaptiveConcurrencyPolicy{
+			InitialLimit:  2,
+			TargetLatency: time.Millisecond,
+		}))
+		// A slow call shrinks the limit.
+		first := ping(client, 1)
+		<-started
+		time.Sleep(10 * time.Millisecond)
+		release <- 1
+		assert.Nil(t, <-first)
+		second := ping(client, 2)
+		<-started
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 3}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		release <- 2
+		assert.Nil(t, <-second)
+		recorded := infos()
+		assert.Equal(t, len(recorded), 3)
+		assert.Equal(t, recorded[0].Limit, 2)
+		assert.Equal(t, recorded[1].Limit, 1)
+		assert.True(t, recorded[2].Rejected)
+	})
+}
+
+type limitedCall struct {
+	connect.LimitInfo
+
+	done bool
+	code connect.Code // set once done
+}
@@ -0,0 +1,176 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mux routes RPCs to the handlers for many services. Unlike [http.ServeMux],
+// it answers requests for unknown services and procedures with a
+// [CodeUnimplemented] error in the caller's protocol, so gRPC and Connect
+// clients see a meaningful error rather than a plain-text 404.
+//
+// Pass the mux's Options to generated handler constructors, so they apply the
+// mux's HandlerOptions and the mux learns which procedures each service
+// handles:
+//
+//	mux := connect.NewMux(connect.WithInterceptors(logger))
+//	mux.Handle(pingv1connect.NewPingServiceHandler(&pingServer{}, mux.Options()))
+//	http.ListenAndServe(":8080", mux)
+//
+// Mux is safe to use concurrently.
+type Mux struct {
+	options     []HandlerOption
+	errorWriter *ErrorWriter
+
+	mu         sync.RWMutex
+	handlers   map[string]http.Handler // by procedure or service prefix
+	services   map[string]bool         // by prefix: whether all the service's procedures are known
+	procedures map[string]Spec         // by procedure
+	pending    map[string]Spec         // constructed with Options, but not yet handled
+}
+
+// NewMux constructs a Mux. The HandlerOptions apply to every handler
+// constructed with the mux's Options, and determine the protocols and codecs used to
+// answer requests for unknown procedures.
+func NewMux(options ...HandlerOption) *Mux {
+	return &Mux{
+		options:     options,
+		errorWriter: NewErrorWriter(options...),
+		handlers:    make(map[string]http.Handler),
+		services:    make(map[string]bool),
+		procedures:  make(map[string]Spec),
+		pending:     make(map[string]Spec),
+	}
+}
+
+// Options returns a HandlerOption that applies the mux's HandlerOptions and
+// records the Spec of each handler constructed with it. Pass it to generated
+// constructors, like NewPingServiceHandler, before any service-specific
+// options.
+func (m *Mux) Options() HandlerOption {
+	return WithHandlerOptions(
+		WithHandlerOptions(m.options...),
+		&registerSpecOption{register: m.registerSpec},
+	)
+}
+
+// Handle adds a handler to the mux. The path is either a procedure, like
+// "/acme.foo.v1.FooService/Bar", or a service's path prefix, like
+// "/acme.foo.v1.FooService/", as returned by generated constructors.
+//
+// If the handler was constructed with the mux's Options, or is a [*Handler]
+// for a single procedure, the mux answers requests for the service's unknown
+// procedures itself. Otherwise, the handler receives every request for the
+// service. Registering the same path twice panics, as it does with
+// [http.ServeMux].
+func (m *Mux) Handle(path string, handler http.Handler) {
+	if path == "" || path[0] != '/' {
+		panic("connect: mux paths must begin with a slash, got " + path) //nolint:forbidigo
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.handlers[path]; ok {
+		panic("connect: multiple registrations for " + path) //nolint:forbidigo
+	}
+	m.handlers[path] = handler
+	prefix := path[:strings.LastIndex(path, "/")+1]
+	if path != prefix {
+		if connectHandler, ok := handler.(*Handler); ok {
+			m.procedures[path] = connectHandler.spec
+		}
+		delete(m.pending, path)
+		if _, ok := m.services[prefix]; !ok {
+			m.services[prefix] = true
+		}
+		return
+	}
+	knownProcedures := false
+	for procedure, spec := range m.pending {
+		if strings.HasPrefix(procedure, prefix) {
+			m.procedures[procedure] = spec
+			delete(m.pending, procedure)
+			knownProcedures = true
+		}
+	}
+	m.services[prefix] = knownProcedures
+}
+
+// Procedures returns the Specs of the procedures registered with the mux,
+// sorted by procedure.
+func (m *Mux) Procedures() []Spec {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	specs := make([]Spec, 0, len(m.procedures))
+	for _, spec := range m.procedures {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Procedure < specs[j].Procedure
+	})
+	return specs
+}
+
+// ServeHTTP implements [http.Handler].
+func (m *Mux) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+	prefix := path[:strings.LastIndex(path, "/")+1]
+	m.mu.RLock()
+	handler, ok := m.handlers[path]
+	if !ok {
+		handler, ok = m.handlers[prefix]
+		if _, known := m.procedures[path]; !known && m.services[prefix] {
+			ok = false // the mux knows all the service's procedures
+		}
+	}
+	_, knownService := m.services[prefix]
+	m.mu.RUnlock()
+	switch {
+	case ok:
+		handler.ServeHTTP(responseWriter, request)
+	case knownService, prefix == "/":
+		m.writeNotFound(responseWriter, request, errorf(CodeUnimplemented, "unknown procedure %s", path))
+	default:
+		m.writeNotFound(responseWriter, request, errorf(CodeUnimplemented, "unknown service %s", strings.Trim(prefix, "/")))
+	}
+}
+
+func (m *Mux) registerSpec(spec Spec) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending[spec.Procedure] = spec
+}
+
+// writeNotFound writes an error in the request's protocol, or a plain 404 if
+// it's not an RPC.
+func (m *Mux) writeNotFound(responseWriter http.ResponseWriter, request *http.Request, err *Error) {
+	if !m.errorWriter.IsSupported(request) {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	_ = m.errorWriter.Write(responseWriter, request, err)
+}
+
+type registerSpecOption struct {
+	register func(Spec)
+}
+
+func (o *registerSpecOption) applyToHandler(config *handlerConfig) {
+	config.RegisterSpec = o.register
+}
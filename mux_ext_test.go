@@ -0,0 +1,108 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestMux(t *testing.T) {
+	t.Parallel()
+	mux := connect.NewMux(connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			response, err := next(ctx, request)
+			if err == nil {
+				response.Header().Set("Mux-Procedure", request.Spec().Procedure)
+			}
+			return response, err
+		}
+	})))
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(pingServer{}, mux.Options()))
+	mux.Handle("/health/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	t.Run("procedures", func(t *testing.T) {
+		t.Parallel()
+		var procedures []string
+		var streamTypes []connect.StreamType
+		for _, spec := range mux.Procedures() {
+			procedures = append(procedures, spec.Procedure)
+			streamTypes = append(streamTypes, spec.StreamType)
+		}
+		assert.Equal(t, procedures, []string{
+			"/connect.ping.v1.PingService/CountUp",
+			"/connect.ping.v1.PingService/CumSum",
+			"/connect.ping.v1.PingService/Fail",
+			"/connect.ping.v1.PingService/Ping",
+			"/connect.ping.v1.PingService/Sum",
+		})
+		assert.Equal(t, streamTypes, []connect.StreamType{
+			connect.StreamTypeServer,
+			connect.StreamTypeBidi,
+			connect.StreamTypeUnary,
+			connect.StreamTypeUnary,
+			connect.StreamTypeClient,
+		})
+	})
+	t.Run("shared_options", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+		assert.Equal(t, response.Header().Get("Mux-Procedure"), "/connect.ping.v1.PingService/Ping")
+	})
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+		for _, options := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+			for path, message := range map[string]string{
+				"/connect.ping.v1.PingService/Unknown": "unknown procedure /connect.ping.v1.PingService/Unknown",
+				"/acme.foo.v1.FooService/Bar":          "unknown service acme.foo.v1.FooService",
+			} {
+				client := connect.NewClient[pingv1_test.PingRequest, pingv1_test.PingResponse](server.Client(), server.URL+path, options...)
+				_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+				var connectErr *connect.Error
+				assert.True(t, errors.As(err, &connectErr))
+				assert.Equal(t, connectErr.Message(), message)
+			}
+		}
+	})
+	t.Run("http", func(t *testing.T) {
+		t.Parallel()
+		response, err := server.Client().Get(server.URL + "/health/live")
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		assert.Equal(t, response.StatusCode, http.StatusNoContent)
+		response, err = server.Client().Get(server.URL + "/index.html")
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		assert.Equal(t, response.StatusCode, http.StatusNotFound)
+	})
+}
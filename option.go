@@ -19,6 +19,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 )
 
 // A ClientOption configures a [Client].
@@ -57,6 +58,34 @@ func WithAcceptCompression(
 	}
 }
 
+// WithBalancer configures the client to spread calls across the endpoints
+// resolved by a [Balancer]. The client replaces the host in its URL with the
+// address of the endpoint chosen for each call, keeping the scheme and path,
+// and [Peer] reports the chosen endpoint. (Servers using TLS must present
+// certificates valid for the endpoint addresses, or the HTTP client must set
+// the expected server name.)
+//
+// Each call goes to a single endpoint: retries and hedges of a call go to the
+// same endpoint as the original attempt. Streams are balanced when they're
+// created. Calls wait for the balancer's first resolution, subject to their
+// contexts.
+func WithBalancer(balancer *Balancer) ClientOption {
+	return &balancerOption{Balancer: balancer}
+}
+
+// WithCircuitBreaker configures the client to check a [CircuitBreaker] before
+// each call, and to report each call's outcome to it. While a circuit is open,
+// calls fail immediately with [CodeUnavailable]. Share a breaker between the
+// clients for a service to track all its procedures or endpoints together.
+//
+// The breaker sits beneath the client's interceptors and retries, so each
+// retried attempt of a unary call is checked and recorded separately. Streams
+// are checked when they're created and recorded when their responses are
+// closed.
+func WithCircuitBreaker(breaker *CircuitBreaker) ClientOption {
+	return &circuitBreakerOption{Breaker: breaker}
+}
+
 // WithClientOptions composes multiple ClientOptions into one.
 func WithClientOptions(options ...ClientOption) ClientOption {
 	return &clientOptionsOption{options}
@@ -72,6 +101,55 @@ func WithGRPCWeb() ClientOption {
 	return &grpcOption{web: true}
 }
 
+// WithHTTPGet allows Connect-protocol clients to call side-effect-free unary
+// procedures with HTTP GET, encoding the request message in the URL's query
+// parameters. Only procedures with an [IdempotencyLevel] of
+// [IdempotencyNoSideEffects] are affected; see [WithIdempotency]. The gRPC and
+// gRPC-Web protocols are POST-only, so this option has no effect when combined
+// with [WithGRPC] or [WithGRPCWeb].
+//
+// GET requests can be cached by CDNs, caching proxies, and browsers. Note that
+// handlers don't set any caching headers automatically: set them in
+// interceptors or in the procedure implementations.
+//
+// GET requests require a codec with stable output, like the default Protobuf
+// and JSON codecs: with any other codec, calls fail unless
+// [WithHTTPGetMaxURLSize] allows falling back to POST. By default, clients send
+// all requests with HTTP POST.
+func WithHTTPGet() ClientOption {
+	return &httpGetOption{}
+}
+
+// WithHTTPGetMaxURLSize limits the length of the URLs generated by
+// [WithHTTPGet]. Most proxies, servers, and CDNs limit the size of URLs; 4096
+// bytes is a conservative limit that works with most infrastructure.
+//
+// If a request's URL would exceed the limit, the client first tries to
+// compress the message (if send compression is configured). If the URL is
+// still too long and fallback is true, the client sends the request with HTTP
+// POST instead. Otherwise, the call fails with [CodeResourceExhausted].
+//
+// By default, GET URLs may be of any length.
+func WithHTTPGetMaxURLSize(bytes int, fallback bool) ClientOption {
+	return &httpGetMaxURLSizeOption{Max: bytes, Fallback: fallback}
+}
+
+// WithHedgingPolicy configures the client to hedge unary calls to procedures
+// without side effects: if the server hasn't responded after the policy's
+// delay, the client sends another copy of the request, up to the policy's
+// MaxAttempts. The client returns whichever response arrives first and cancels
+// the remaining attempts. Like retries, hedging happens beneath the client's
+// interceptors, and hedged copies carry a Grpc-Previous-Rpc-Attempts header.
+//
+// Hedging only applies to procedures with [IdempotencyNoSideEffects]; for
+// those procedures, it takes precedence over [WithRetryPolicy]. Hedging trades
+// server load for tail latency, so use the policy's Stats to keep an eye on
+// how often hedges are sent and how often they win. By default, clients don't
+// hedge.
+func WithHedgingPolicy(policy HedgingPolicy) ClientOption {
+	return &hedgingPolicyOption{Policy: policy}
+}
+
 // WithProtoJSON configures a client to send JSON-encoded data instead of
 // binary Protobuf. It uses the standard Protobuf JSON mapping as implemented
 // by [google.golang.org/protobuf/encoding/protojson]: fields are named using
@@ -81,6 +159,92 @@ func WithProtoJSON() ClientOption {
 	return WithCodec(&protoJSONCodec{codecNameJSON})
 }
 
+// WithProtocol configures the client to use a custom [Protocol] in place of
+// Connect, gRPC, or gRPC-Web. The server's handlers must support the protocol
+// too; see [WithProtocols].
+func WithProtocol(protocol Protocol) ClientOption {
+	return &protocolOption{Protocol: protocol}
+}
+
+// WithRequestCoalescing configures the client to share one round-trip among
+// identical unary calls that are in flight at the same time. Calls are
+// identical if their messages marshal to the same bytes and they have the same
+// values for the named headers; any other headers are taken from the call that
+// started the round-trip. Calls with [CallOption]s are never coalesced.
+//
+// Each caller gets a copy of the response (or error) of its own, so callers
+// can't see each other's changes to messages or metadata. A caller whose
+// context is done stops waiting without affecting the others. The shared
+// round-trip isn't bound by any one caller's deadline; it's canceled once no
+// callers are waiting for it, and it's bound by [WithDefaultTimeout] if that's
+// set.
+//
+// Request coalescing requires a codec that marshals deterministically, like
+// the default Protobuf binary and JSON codecs. By default, requests aren't
+// coalesced.
+func WithRequestCoalescing(headers ...string) ClientOption {
+	return &requestCoalescingOption{headers: headers}
+}
+
+// WithResponseCache configures the client to cache the responses to unary
+// calls to side-effect-free procedures (see [WithIdempotency]). Responses are
+// keyed on the procedure, the request message, and the values of the vary
+// headers; if cache is nil, the client uses an in-memory cache of its own,
+// created with [NewLRUResponseCache]. Calls with [CallOption]s bypass the
+// cache.
+//
+// Clients follow the Cache-Control and ETag headers sent by the server. A
+// response is served from the cache until its max-age has passed; after that,
+// the client revalidates it by sending the entity tag in the If-None-Match
+// header. Responses with neither a max-age nor an entity tag, or with the
+// no-store directive, aren't cached. See [WithCacheMaxAge] and [WithETag] for
+// the handler side.
+//
+// Response caching requires a codec that marshals deterministically, like
+// the default Protobuf binary and JSON codecs. By default, responses aren't
+// cached.
+func WithResponseCache(cache ResponseCache, varyHeaders ...string) ClientOption {
+	if cache == nil {
+		cache = NewLRUResponseCache(0)
+	}
+	return &responseCacheOption{cache: cache, vary: varyHeaders}
+}
+
+// WithRetryPolicy configures the client to retry failed calls automatically.
+// Retries happen beneath the client's interceptors, so interceptors see a
+// single call no matter how many attempts it takes. Each retried attempt
+// carries a Grpc-Previous-Rpc-Attempts header with the number of preceding
+// attempts, and servers may delay or forbid retries by returning a
+// Grpc-Retry-Pushback-Ms header or trailer with the error.
+//
+// Client and server streams are retried only if they fail before the server
+// sends any messages. To replay them, the client buffers the request messages
+// it sends, up to the policy's MaxReplayBytes. Bidirectional streams are never
+// retried.
+//
+// Procedures with side effects may be executed more than once when retried,
+// so consider setting IdempotentOnly or limiting RetryableCodes to codes that
+// guarantee the server didn't process the request. By default, clients don't
+// retry.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return &retryPolicyOption{Policy: policy}
+}
+
+// WithStreamResumption configures the client to resume server streams that
+// break, for example because a proxy timed out or the server was redeployed.
+// When Receive fails with a resumable error, the client reconnects and sends
+// the resume token of the last message it received, then continues delivering
+// messages through Receive as though nothing had happened. Handlers attach
+// tokens with [ServerStream.SendWithResumeToken].
+//
+// Streams that have received messages without resume tokens aren't resumed,
+// since the server would send those messages again. Streams that fail before
+// receiving any messages are simply restarted. Resumption takes precedence
+// over [WithRetryPolicy] for server streams.
+func WithStreamResumption(policy StreamResumptionPolicy) ClientOption {
+	return &streamResumptionOption{policy: newStreamResumptionPolicy(policy)}
+}
+
 // WithSendCompression configures the client to use the specified algorithm to
 // compress request messages. If the algorithm has not been registered using
 // [WithAcceptCompression], the client will return errors at runtime.
@@ -101,6 +265,64 @@ func WithSendGzip() ClientOption {
 	return WithSendCompression(compressionGzip)
 }
 
+// A CallOption configures a single call made with a [Client], overriding the
+// client's configuration for that call only. Generated clients accept
+// CallOptions on every method, so one client can serve callers with different
+// needs.
+type CallOption interface {
+	applyToCall(*callConfig)
+}
+
+// WithCallTimeout bounds the call with a timeout, in addition to any deadline
+// on the call's context. For streams, the timeout covers the whole stream.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return &callTimeoutOption{Timeout: timeout}
+}
+
+// WithCallSendCompression configures the call to compress request messages
+// with the specified algorithm, which must have been registered with
+// [WithAcceptCompression]. Use "identity" to send the call's requests
+// uncompressed.
+func WithCallSendCompression(name string) CallOption {
+	return &callSendCompressionOption{Name: name}
+}
+
+// WithCallInterceptors adds interceptors to the call. They run inside the
+// client's interceptors, in the order given.
+func WithCallInterceptors(interceptors ...Interceptor) CallOption {
+	return &callInterceptorsOption{Interceptors: interceptors}
+}
+
+// WithCallReadMaxBytes limits the size of the response messages the call
+// accepts, replacing the client's limit. Zero allows any message size.
+func WithCallReadMaxBytes(max int) CallOption {
+	return &callReadMaxBytesOption{Max: max}
+}
+
+// WithCallSendMaxBytes limits the size of the request messages the call
+// sends, replacing the client's limit. Zero allows any message size.
+func WithCallSendMaxBytes(max int) CallOption {
+	return &callSendMaxBytesOption{Max: max}
+}
+
+// WithCallResponseHeader calls the given function with the response headers
+// once the call succeeds. For streams, the function runs when the response is
+// closed.
+//
+// Response headers are already available from unary responses and streams, so
+// this option is most useful to code that only sees the generated client's
+// return values, like a shared wrapper.
+func WithCallResponseHeader(capture func(http.Header)) CallOption {
+	return &callResponseHeaderOption{Capture: capture}
+}
+
+// WithCallResponseTrailer calls the given function with the response trailers
+// once the call succeeds. For streams, the function runs when the response is
+// closed.
+func WithCallResponseTrailer(capture func(http.Header)) CallOption {
+	return &callResponseTrailerOption{Capture: capture}
+}
+
 // A HandlerOption configures a [Handler].
 //
 // In addition to any options grouped in the documentation below, remember that
@@ -109,6 +331,27 @@ type HandlerOption interface {
 	applyToHandler(*handlerConfig)
 }
 
+// WithAdaptiveConcurrencyLimit limits the number of calls a handler serves
+// concurrently, adjusting the limit to keep latency low: the limit grows by
+// one while calls are fast and the handler is busy, and shrinks by the
+// policy's BackoffRatio when calls are slow. Like [WithConcurrencyLimit], each
+// procedure has its own limit, and calls over it are rejected with
+// [CodeResourceExhausted] before the request body is read.
+func WithAdaptiveConcurrencyLimit(policy AdaptiveConcurrencyPolicy) HandlerOption {
+	return &adaptiveConcurrencyLimitOption{policy: policy}
+}
+
+// WithCacheMaxAge configures the handler to tell clients how long they may
+// cache its responses, by setting the Cache-Control header to max-age. It has
+// no effect on responses whose Cache-Control header is set by the
+// implementation. See [WithResponseCache].
+//
+// Like [WithETag], it only applies to unary, side-effect-free procedures (see
+// [WithIdempotency]).
+func WithCacheMaxAge(maxAge time.Duration) HandlerOption {
+	return &cacheMaxAgeOption{maxAge: maxAge}
+}
+
 // WithCompression configures handlers to support a compression algorithm.
 // Clients may send messages compressed with that algorithm and/or request
 // compressed responses. The [Compressor] and [Decompressor] produced by the
@@ -130,11 +373,87 @@ func WithCompression(
 	}
 }
 
+// WithConcurrencyLimit limits the number of calls a handler serves
+// concurrently. Each procedure has its own limit, so passing
+// WithConcurrencyLimit to a generated constructor caps each of the service's
+// procedures separately. Calls over the limit wait up to maxWait for a slot,
+// in the order they arrived, and are then rejected with
+// [CodeResourceExhausted] before the request body is read. Rejections and
+// queue-wait times are visible to interceptors with [LimitInfoFromContext].
+//
+// Limits less than one disable limiting, which is the default.
+func WithConcurrencyLimit(limit int, maxWait time.Duration) HandlerOption {
+	return &concurrencyLimitOption{limit: limit, maxWait: maxWait}
+}
+
+// WithDrainer lets a [Drainer] gracefully stop the handler. Share one Drainer
+// among all of a server's handlers.
+func WithDrainer(drainer *Drainer) HandlerOption {
+	return &drainerOption{drainer: drainer}
+}
+
+// WithETag configures the handler to answer revalidations from caching
+// clients without running the implementation. Before calling the
+// implementation, the handler calls the supplied function to compute the
+// entity tag of the response: typically a version number or content hash,
+// quoted as HTTP requires (for example, `"v42"`). If it matches the request's
+// If-None-Match header, the handler responds with an empty message and the
+// Not-Modified header, the RPC equivalent of HTTP's 304 status. Otherwise, it
+// runs the implementation and sends the entity tag in the ETag header. Returning
+// an empty string skips revalidation for the call.
+//
+// Implementations of side-effect-free procedures may also set the ETag header
+// themselves, with or without this option. The handler still answers matching
+// revalidations with an empty message, but it runs the implementation to find
+// out the tag.
+//
+// Like [WithCacheMaxAge], it only applies to unary, side-effect-free
+// procedures (see [WithIdempotency]).
+func WithETag(etag func(context.Context, AnyRequest) (string, error)) HandlerOption {
+	return &etagOption{etag: etag}
+}
+
 // WithHandlerOptions composes multiple HandlerOptions into one.
 func WithHandlerOptions(options ...HandlerOption) HandlerOption {
 	return &handlerOptionsOption{options}
 }
 
+// WithMaxTimeout caps the time the handler allows for each call. If the client
+// sends a longer timeout (or none at all), the handler's context is cancelled
+// after the maximum instead. Shorter client timeouts are honored as usual.
+//
+// By default, handlers accept any timeout the client sends. Setting
+// WithMaxTimeout to zero restores the default.
+func WithMaxTimeout(timeout time.Duration) HandlerOption {
+	return &maxTimeoutOption{Timeout: timeout}
+}
+
+// WithProcedureOptions applies options only to the handler for the given
+// procedure (for example, "/acme.foo.v1.FooService/Bar"). It's most useful
+// with generated service constructors, which apply the same options to every
+// procedure in the service: placed after the service-wide options, it
+// overrides them for a single procedure.
+//
+//	path, handler := foov1connect.NewFooServiceHandler(
+//	  svc,
+//	  connect.WithMaxTimeout(5*time.Second),
+//	  connect.WithProcedureOptions(
+//	    "/acme.foo.v1.FooService/Export",
+//	    connect.WithMaxTimeout(time.Minute),
+//	  ),
+//	)
+func WithProcedureOptions(procedure string, options ...HandlerOption) HandlerOption {
+	return &procedureOptionsOption{procedure: procedure, options: options}
+}
+
+// WithProtocols adds support for custom protocols to the handler, alongside
+// the built-in Connect, gRPC, and gRPC-Web protocols. The handler chooses a
+// protocol for each request by its HTTP method and Content-Type, preferring
+// the built-in protocols. Repeated WithProtocols options are applied in order.
+func WithProtocols(protocols ...Protocol) HandlerOption {
+	return &protocolsOption{Protocols: protocols}
+}
+
 // WithRecover adds an interceptor that recovers from panics. The supplied
 // function receives the context, [Spec], request headers, and the recovered
 // value (which may be nil). It must return an error to send back to the
@@ -201,6 +520,18 @@ func WithCompressMinBytes(min int) Option {
 	return &compressMinBytesOption{Min: min}
 }
 
+// WithDefaultTimeout bounds calls whose context has no deadline. For clients,
+// the timeout is sent to the server along with the request, just as if the
+// caller had set a deadline. For handlers, it applies when the client didn't
+// send a timeout. Deadlines set by the caller or sent by the client are
+// never extended.
+//
+// By default, clients and handlers don't impose a timeout. Setting
+// WithDefaultTimeout to zero restores the default.
+func WithDefaultTimeout(timeout time.Duration) Option {
+	return &defaultTimeoutOption{Timeout: timeout}
+}
+
 // WithReadMaxBytes limits the performance impact of pathologically large
 // messages sent by the other party. For handlers, WithReadMaxBytes limits the size
 // of a message that the client can send. For clients, WithReadMaxBytes limits the
@@ -230,6 +561,27 @@ func WithSendMaxBytes(max int) Option {
 	return &sendMaxBytesOption{Max: max}
 }
 
+// WithSendValidation makes the validators configured with [WithValidator]
+// check each message before it's sent, too. Clients and handlers that send an
+// invalid message get an error from Send, and the message isn't sent.
+func WithSendValidation() Option {
+	return &sendValidationOption{}
+}
+
+// WithIdempotency declares the idempotency level of a procedure. Clients and
+// handlers use it to decide whether a call may be replayed and whether it may
+// use HTTP GET. The level is also visible to interceptors in [Spec].
+//
+// Most users don't need to set this manually: protoc-gen-connect-go sets it
+// from the schema. For Protobuf, declare it with a method option:
+//
+//	rpc Ping(PingRequest) returns (PingResponse) {
+//	  option idempotency_level = NO_SIDE_EFFECTS;
+//	}
+func WithIdempotency(level IdempotencyLevel) Option {
+	return &idempotencyOption{Level: level}
+}
+
 // WithInterceptors configures a client or handler's interceptor stack. Repeated
 // WithInterceptors options are applied in order, so
 //
@@ -286,6 +638,80 @@ func WithOptions(options ...Option) Option {
 	return &optionsOption{options}
 }
 
+// WithTwirp configures clients to use the Twirp protocol, and handlers to
+// serve it alongside Connect, gRPC, and gRPC-Web. Twirp only supports unary
+// procedures, the Protobuf and JSON codecs, and no compression; calls to
+// streaming procedures fail with [CodeUnimplemented].
+//
+// Twirp requests use a different path from the other protocols, so handlers
+// only serve them if they're mounted with [TwirpRoute]. Clients add the Twirp
+// prefix to their URLs automatically.
+func WithTwirp() Option {
+	return &twirpOption{}
+}
+
+// WithValidator validates each message a client or handler receives: every
+// response for clients, and every request for handlers. On streams, each
+// message is validated as it's received, so handlers can reject a bad message
+// mid-stream. Use [WithSendValidation] to validate sent messages too.
+//
+// Validators run in order, and the first error rejects the message. Unless
+// the error is already an [*Error], it's wrapped in one with
+// [CodeInvalidArgument]. Errors wrapping a [*ValidationError] get a
+// google.rpc.BadRequest [ErrorDetail] describing the invalid fields.
+//
+// With no validators, WithValidator uses the messages' own Validate() error
+// methods, as generated by plugins like protoc-gen-validate. Repeated
+// WithValidator options are applied in order.
+func WithValidator(validators ...Validator) Option {
+	return &validatorOption{Validators: validators}
+}
+
+type balancerOption struct {
+	Balancer *Balancer
+}
+
+func (o *balancerOption) applyToClient(config *clientConfig) {
+	config.Balancer = o.Balancer
+}
+
+type circuitBreakerOption struct {
+	Breaker *CircuitBreaker
+}
+
+func (o *circuitBreakerOption) applyToClient(config *clientConfig) {
+	config.CircuitBreaker = o.Breaker
+}
+
+type concurrencyLimitOption struct {
+	limit   int
+	maxWait time.Duration
+}
+
+func (o *concurrencyLimitOption) applyToHandler(config *handlerConfig) {
+	config.NewLimiter = func() *concurrencyLimiter {
+		return newStaticLimiter(o.limit, o.maxWait)
+	}
+}
+
+type adaptiveConcurrencyLimitOption struct {
+	policy AdaptiveConcurrencyPolicy
+}
+
+func (o *adaptiveConcurrencyLimitOption) applyToHandler(config *handlerConfig) {
+	config.NewLimiter = func() *concurrencyLimiter {
+		return newAdaptiveLimiter(o.policy)
+	}
+}
+
+type cacheMaxAgeOption struct {
+	maxAge time.Duration
+}
+
+func (o *cacheMaxAgeOption) applyToHandler(config *handlerConfig) {
+	config.CacheMaxAge = o.maxAge
+}
+
 type clientOptionsOption struct {
 	options []ClientOption
 }
@@ -359,6 +785,18 @@ func (o *compressMinBytesOption) applyToHandler(config *handlerConfig) {
 	config.CompressMinBytes = o.Min
 }
 
+type defaultTimeoutOption struct {
+	Timeout time.Duration
+}
+
+func (o *defaultTimeoutOption) applyToClient(config *clientConfig) {
+	config.DefaultTimeout = o.Timeout
+}
+
+func (o *defaultTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.DefaultTimeout = o.Timeout
+}
+
 type readMaxBytesOption struct {
 	Max int
 }
@@ -383,6 +821,16 @@ func (o *sendMaxBytesOption) applyToHandler(config *handlerConfig) {
 	config.SendMaxBytes = o.Max
 }
 
+type sendValidationOption struct{}
+
+func (o *sendValidationOption) applyToClient(config *clientConfig) {
+	config.ValidateSends = true
+}
+
+func (o *sendValidationOption) applyToHandler(config *handlerConfig) {
+	config.ValidateSends = true
+}
+
 type handlerOptionsOption struct {
 	options []HandlerOption
 }
@@ -393,12 +841,60 @@ func (o *handlerOptionsOption) applyToHandler(config *handlerConfig) {
 	}
 }
 
+type maxTimeoutOption struct {
+	Timeout time.Duration
+}
+
+func (o *maxTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.MaxTimeout = o.Timeout
+}
+
+type procedureOptionsOption struct {
+	procedure string
+	options   []HandlerOption
+}
+
+func (o *procedureOptionsOption) applyToHandler(config *handlerConfig) {
+	if config.Procedure != o.procedure {
+		return
+	}
+	for _, option := range o.options {
+		option.applyToHandler(config)
+	}
+}
+
+type protocolsOption struct {
+	Protocols []Protocol
+}
+
+func (o *protocolsOption) applyToHandler(config *handlerConfig) {
+	for _, protocol := range o.Protocols {
+		config.Protocols = append(config.Protocols, &codedErrorProtocol{Protocol: protocol})
+	}
+}
+
 type requireConnectProtocolHeaderOption struct{}
 
 func (o *requireConnectProtocolHeaderOption) applyToHandler(config *handlerConfig) {
 	config.RequireConnectProtocolHeader = true
 }
 
+type drainerOption struct {
+	drainer *Drainer
+}
+
+func (o *drainerOption) applyToHandler(config *handlerConfig) {
+	config.Drainer = o.drainer
+}
+
+type etagOption struct {
+	etag func(context.Context, AnyRequest) (string, error)
+}
+
+func (o *etagOption) applyToHandler(config *handlerConfig) {
+	config.ETag = o.etag
+}
+
 type grpcOption struct {
 	web bool
 }
@@ -407,6 +903,60 @@ func (o *grpcOption) applyToClient(config *clientConfig) {
 	config.Protocol = &protocolGRPC{web: o.web}
 }
 
+type protocolOption struct {
+	Protocol Protocol
+}
+
+func (o *protocolOption) applyToClient(config *clientConfig) {
+	config.Protocol = &codedErrorProtocol{Protocol: o.Protocol}
+}
+
+type twirpOption struct{}
+
+func (o *twirpOption) applyToClient(config *clientConfig) {
+	config.Protocol = &protocolTwirp{}
+}
+
+func (o *twirpOption) applyToHandler(config *handlerConfig) {
+	config.HandleTwirp = true
+}
+
+type httpGetOption struct{}
+
+func (o *httpGetOption) applyToClient(config *clientConfig) {
+	config.EnableGet = true
+}
+
+type hedgingPolicyOption struct {
+	Policy HedgingPolicy
+}
+
+func (o *hedgingPolicyOption) applyToClient(config *clientConfig) {
+	config.HedgingPolicy = newHedgingPolicy(o.Policy)
+}
+
+type httpGetMaxURLSizeOption struct {
+	Max      int
+	Fallback bool
+}
+
+func (o *httpGetMaxURLSizeOption) applyToClient(config *clientConfig) {
+	config.GetURLMaxBytes = o.Max
+	config.GetUseFallback = o.Fallback
+}
+
+type idempotencyOption struct {
+	Level IdempotencyLevel
+}
+
+func (o *idempotencyOption) applyToClient(config *clientConfig) {
+	config.IdempotencyLevel = o.Level
+}
+
+func (o *idempotencyOption) applyToHandler(config *handlerConfig) {
+	config.IdempotencyLevel = o.Level
+}
+
 type interceptorsOption struct {
 	Interceptors []Interceptor
 }
@@ -448,6 +998,41 @@ func (o *optionsOption) applyToHandler(config *handlerConfig) {
 	}
 }
 
+type requestCoalescingOption struct {
+	headers []string
+}
+
+func (o *requestCoalescingOption) applyToClient(config *clientConfig) {
+	config.CoalesceRequests = true
+	config.CoalesceHeaders = o.headers
+}
+
+type responseCacheOption struct {
+	cache ResponseCache
+	vary  []string
+}
+
+func (o *responseCacheOption) applyToClient(config *clientConfig) {
+	config.ResponseCache = o.cache
+	config.ResponseCacheVary = o.vary
+}
+
+type retryPolicyOption struct {
+	Policy RetryPolicy
+}
+
+func (o *retryPolicyOption) applyToClient(config *clientConfig) {
+	config.RetryPolicy = newRetryPolicy(o.Policy)
+}
+
+type streamResumptionOption struct {
+	policy *streamResumptionPolicy
+}
+
+func (o *streamResumptionOption) applyToClient(config *clientConfig) {
+	config.StreamResumptionPolicy = o.policy
+}
+
 type sendCompressionOption struct {
 	Name string
 }
@@ -476,3 +1061,78 @@ func withProtoJSONCodecs() HandlerOption {
 		WithCodec(&protoJSONCodec{codecNameJSONCharsetUTF8}),
 	)
 }
+
+type validatorOption struct {
+	Validators []Validator
+}
+
+func (o *validatorOption) applyToClient(config *clientConfig) {
+	config.Validators = append(config.Validators, o.validators()...)
+}
+
+func (o *validatorOption) applyToHandler(config *handlerConfig) {
+	config.Validators = append(config.Validators, o.validators()...)
+}
+
+func (o *validatorOption) validators() []Validator {
+	if len(o.Validators) == 0 {
+		return []Validator{selfValidator{}}
+	}
+	return o.Validators
+}
+
+type callTimeoutOption struct {
+	Timeout time.Duration
+}
+
+func (o *callTimeoutOption) applyToCall(config *callConfig) {
+	config.Timeout = o.Timeout
+}
+
+type callSendCompressionOption struct {
+	Name string
+}
+
+func (o *callSendCompressionOption) applyToCall(config *callConfig) {
+	config.RequestCompressionName = o.Name
+}
+
+type callInterceptorsOption struct {
+	Interceptors []Interceptor
+}
+
+func (o *callInterceptorsOption) applyToCall(config *callConfig) {
+	config.Interceptors = append(config.Interceptors, o.Interceptors...)
+}
+
+type callReadMaxBytesOption struct {
+	Max int
+}
+
+func (o *callReadMaxBytesOption) applyToCall(config *callConfig) {
+	config.ReadMaxBytes = &o.Max
+}
+
+type callSendMaxBytesOption struct {
+	Max int
+}
+
+func (o *callSendMaxBytesOption) applyToCall(config *callConfig) {
+	config.SendMaxBytes = &o.Max
+}
+
+type callResponseHeaderOption struct {
+	Capture func(http.Header)
+}
+
+func (o *callResponseHeaderOption) applyToCall(config *callConfig) {
+	config.OnResponseHeader = o.Capture
+}
+
+type callResponseTrailerOption struct {
+	Capture func(http.Header)
+}
+
+func (o *callResponseTrailerOption) applyToCall(config *callConfig) {
+	config.OnResponseTrailer = o.Capture
+}
@@ -42,15 +42,15 @@ const (
 // PingServiceClient is a client for the connect.ping.v1.PingService service.
 type PingServiceClient interface {
 	// Ping sends a ping to the server to determine if it's reachable.
-	Ping(context.Context, *connect_go.Request[v1.PingRequest]) (*connect_go.Response[v1.PingResponse], error)
+	Ping(context.Context, *connect_go.Request[v1.PingRequest], ...connect_go.CallOption) (*connect_go.Response[v1.PingResponse], error)
 	// Fail always fails.
-	Fail(context.Context, *connect_go.Request[v1.FailRequest]) (*connect_go.Response[v1.FailResponse], error)
+	Fail(context.Context, *connect_go.Request[v1.FailRequest], ...connect_go.CallOption) (*connect_go.Response[v1.FailResponse], error)
 	// Sum calculates the sum of the numbers sent on the stream.
-	Sum(context.Context) *connect_go.ClientStreamForClient[v1.SumRequest, v1.SumResponse]
+	Sum(context.Context, ...connect_go.CallOption) *connect_go.ClientStreamForClient[v1.SumRequest, v1.SumResponse]
 	// CountUp returns a stream of the numbers up to the given request.
-	CountUp(context.Context, *connect_go.Request[v1.CountUpRequest]) (*connect_go.ServerStreamForClient[v1.CountUpResponse], error)
+	CountUp(context.Context, *connect_go.Request[v1.CountUpRequest], ...connect_go.CallOption) (*connect_go.ServerStreamForClient[v1.CountUpResponse], error)
 	// CumSum determines the cumulative sum of all the numbers sent on the stream.
-	CumSum(context.Context) *connect_go.BidiStreamForClient[v1.CumSumRequest, v1.CumSumResponse]
+	CumSum(context.Context, ...connect_go.CallOption) *connect_go.BidiStreamForClient[v1.CumSumRequest, v1.CumSumResponse]
 }
 
 // NewPingServiceClient constructs a client for the connect.ping.v1.PingService service. By default,
@@ -66,7 +66,8 @@ func NewPingServiceClient(httpClient connect_go.HTTPClient, baseURL string, opts
 		ping: connect_go.NewClient[v1.PingRequest, v1.PingResponse](
 			httpClient,
 			baseURL+"/connect.ping.v1.PingService/Ping",
-			opts...,
+			connect_go.WithIdempotency(connect_go.IdempotencyNoSideEffects),
+			connect_go.WithClientOptions(opts...),
 		),
 		fail: connect_go.NewClient[v1.FailRequest, v1.FailResponse](
 			httpClient,
@@ -101,28 +102,28 @@ type pingServiceClient struct {
 }
 
 // Ping calls connect.ping.v1.PingService.Ping.
-func (c *pingServiceClient) Ping(ctx context.Context, req *connect_go.Request[v1.PingRequest]) (*connect_go.Response[v1.PingResponse], error) {
-	return c.ping.CallUnary(ctx, req)
+func (c *pingServiceClient) Ping(ctx context.Context, req *connect_go.Request[v1.PingRequest], opts ...connect_go.CallOption) (*connect_go.Response[v1.PingResponse], error) {
+	return c.ping.CallUnary(ctx, req, opts...)
 }
 
 // Fail calls connect.ping.v1.PingService.Fail.
-func (c *pingServiceClient) Fail(ctx context.Context, req *connect_go.Request[v1.FailRequest]) (*connect_go.Response[v1.FailResponse], error) {
-	return c.fail.CallUnary(ctx, req)
+func (c *pingServiceClient) Fail(ctx context.Context, req *connect_go.Request[v1.FailRequest], opts ...connect_go.CallOption) (*connect_go.Response[v1.FailResponse], error) {
+	return c.fail.CallUnary(ctx, req, opts...)
 }
 
 // Sum calls connect.ping.v1.PingService.Sum.
-func (c *pingServiceClient) Sum(ctx context.Context) *connect_go.ClientStreamForClient[v1.SumRequest, v1.SumResponse] {
-	return c.sum.CallClientStream(ctx)
+func (c *pingServiceClient) Sum(ctx context.Context, opts ...connect_go.CallOption) *connect_go.ClientStreamForClient[v1.SumRequest, v1.SumResponse] {
+	return c.sum.CallClientStream(ctx, opts...)
 }
 
 // CountUp calls connect.ping.v1.PingService.CountUp.
-func (c *pingServiceClient) CountUp(ctx context.Context, req *connect_go.Request[v1.CountUpRequest]) (*connect_go.ServerStreamForClient[v1.CountUpResponse], error) {
-	return c.countUp.CallServerStream(ctx, req)
+func (c *pingServiceClient) CountUp(ctx context.Context, req *connect_go.Request[v1.CountUpRequest], opts ...connect_go.CallOption) (*connect_go.ServerStreamForClient[v1.CountUpResponse], error) {
+	return c.countUp.CallServerStream(ctx, req, opts...)
 }
 
 // CumSum calls connect.ping.v1.PingService.CumSum.
-func (c *pingServiceClient) CumSum(ctx context.Context) *connect_go.BidiStreamForClient[v1.CumSumRequest, v1.CumSumResponse] {
-	return c.cumSum.CallBidiStream(ctx)
+func (c *pingServiceClient) CumSum(ctx context.Context, opts ...connect_go.CallOption) *connect_go.BidiStreamForClient[v1.CumSumRequest, v1.CumSumResponse] {
+	return c.cumSum.CallBidiStream(ctx, opts...)
 }
 
 // PingServiceHandler is an implementation of the connect.ping.v1.PingService service.
@@ -149,7 +150,8 @@ func NewPingServiceHandler(svc PingServiceHandler, opts ...connect_go.HandlerOpt
 	mux.Handle("/connect.ping.v1.PingService/Ping", connect_go.NewUnaryHandler(
 		"/connect.ping.v1.PingService/Ping",
 		svc.Ping,
-		opts...,
+		connect_go.WithIdempotency(connect_go.IdempotencyNoSideEffects),
+		connect_go.WithHandlerOptions(opts...),
 	))
 	mux.Handle("/connect.ping.v1.PingService/Fail", connect_go.NewUnaryHandler(
 		"/connect.ping.v1.PingService/Fail",
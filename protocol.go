@@ -15,6 +15,7 @@
 package connect
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -26,12 +27,15 @@ import (
 	"strings"
 )
 
-// The names of the Connect, gRPC, and gRPC-Web protocols (as exposed by
-// [Peer.Protocol]). Additional protocols may be added in the future.
+// The names of the Connect, gRPC, gRPC-Web, and Twirp protocols, and of
+// HTTP/JSON transcoding (as exposed by [Peer.Protocol]). Additional protocols
+// may be added in the future.
 const (
-	ProtocolConnect = "connect"
-	ProtocolGRPC    = "grpc"
-	ProtocolGRPCWeb = "grpcweb"
+	ProtocolConnect  = "connect"
+	ProtocolGRPC     = "grpc"
+	ProtocolGRPCWeb  = "grpcweb"
+	ProtocolTwirp    = "twirp"
+	ProtocolHTTPJSON = "httpjson"
 )
 
 const (
@@ -55,38 +59,93 @@ var errNoTimeout = errors.New("no timeout")
 // protocols might encode durations differently, put them into a different HTTP
 // header, or ignore them entirely.
 //
-// We don't have any short-term plans to export this interface; it's just here
-// to separate the protocol-specific portions of connect from the
-// protocol-agnostic plumbing.
-type protocol interface {
-	NewHandler(*protocolHandlerParams) protocolHandler
-	NewClient(*protocolClientParams) (protocolClient, error)
+// The Connect, gRPC, and gRPC-Web protocols are built in. Other protocols may
+// be added to handlers with [WithProtocols] and used by clients with
+// [WithProtocol]. Handlers choose a protocol for each request by HTTP method
+// and Content-Type, so a custom protocol's content types must not overlap
+// with those of the built-in protocols.
+type Protocol interface {
+	NewHandler(*ProtocolHandlerParams) ProtocolHandler
+	NewClient(*ProtocolClientParams) (ProtocolClient, error)
 }
 
-// HandlerParams are the arguments provided to a Protocol's NewHandler
+// ProtocolHandlerParams are the arguments provided to a Protocol's NewHandler
 // method, bundled into a struct to allow backward-compatible argument
 // additions. Protocol implementations should take care to use the supplied
 // Spec rather than constructing their own, since new fields may have been
-// added.
-type protocolHandlerParams struct {
-	Spec                         Spec
-	Codecs                       readOnlyCodecs
-	CompressionPools             readOnlyCompressionPools
-	CompressMinBytes             int
-	BufferPool                   *bufferPool
-	ReadMaxBytes                 int
-	SendMaxBytes                 int
-	RequireConnectProtocolHeader bool
-}
-
-// Handler is the server side of a protocol. HTTP handlers typically support
-// multiple protocols, codecs, and compressors.
-type protocolHandler interface {
+// added. To construct them outside of a [Handler], use
+// [NewProtocolHandlerParams].
+type ProtocolHandlerParams struct {
+	Spec             Spec
+	CompressMinBytes int
+	ReadMaxBytes     int
+	SendMaxBytes     int
+
+	codecs           readOnlyCodecs
+	compressionPools readOnlyCompressionPools
+	bufferPool       *bufferPool
+}
+
+// Codec returns the handler's Codec with the given name, or nil if the
+// handler doesn't support it.
+func (p *ProtocolHandlerParams) Codec(name string) Codec {
+	return p.codecs.Get(name)
+}
+
+// CodecNames returns the names of the handler's codecs, in no particular
+// order.
+func (p *ProtocolHandlerParams) CodecNames() []string {
+	return p.codecs.Names()
+}
+
+// ProtobufCodec returns the handler's Protobuf codec, falling back to the
+// default implementation if necessary. It's useful for protocols that
+// marshal errors as Protobuf, regardless of the request's codec.
+func (p *ProtocolHandlerParams) ProtobufCodec() Codec {
+	return p.codecs.Protobuf()
+}
+
+// CompressionNames returns the names of the handler's compression algorithms,
+// most preferred first.
+func (p *ProtocolHandlerParams) CompressionNames() []string {
+	return p.compressionPools.Names()
+}
+
+// Compress compresses src into dst with the named compression algorithm.
+func (p *ProtocolHandlerParams) Compress(name string, dst, src *bytes.Buffer) error {
+	return compressWith(p.compressionPools, name, dst, src)
+}
+
+// Decompress decompresses src into dst with the named compression algorithm.
+// It returns an error with [CodeResourceExhausted] if the decompressed data is
+// larger than ReadMaxBytes.
+func (p *ProtocolHandlerParams) Decompress(name string, dst, src *bytes.Buffer) error {
+	return decompressWith(p.compressionPools, name, dst, src, p.ReadMaxBytes)
+}
+
+// NewProtocolHandlerParams constructs the parameters that a [Handler] with
+// the given options passes to each Protocol's NewHandler method. It's useful
+// for testing Protocol implementations, or for using them without a Handler.
+func NewProtocolHandlerParams(spec Spec, options ...HandlerOption) *ProtocolHandlerParams {
+	return newHandlerConfig(spec.Procedure, options).newProtocolHandlerParams(spec)
+}
+
+// ProtocolHandler is the server side of a protocol. HTTP handlers typically
+// support multiple protocols, codecs, and compressors.
+type ProtocolHandler interface {
+	// Methods is the set of HTTP methods that the protocol can handle.
+	Methods() map[string]struct{}
+
 	// ContentTypes is the set of HTTP Content-Types that the protocol can
 	// handle.
 	ContentTypes() map[string]struct{}
 
-	// SetTimeout runs before NewStream. Implementations may inspect the HTTP
+	// CanHandlePayload reports whether the protocol can handle a request with
+	// the given (canonicalized) Content-Type. Requests without a body, like
+	// Connect GET requests, may describe their payload elsewhere.
+	CanHandlePayload(*http.Request, string) bool
+
+	// SetTimeout runs before NewConn. Implementations may inspect the HTTP
 	// request, parse any timeout set by the client, and return a modified
 	// context and cancellation function.
 	//
@@ -94,32 +153,71 @@ type protocolHandler interface {
 	// request's context, a nil cancellation function, and a nil error.
 	SetTimeout(*http.Request) (context.Context, context.CancelFunc, error)
 
-	// NewConn constructs a HandlerConn for the message exchange.
-	NewConn(http.ResponseWriter, *http.Request) (handlerConnCloser, bool)
+	// NewConn constructs a ProtocolHandlerConn for the message exchange. If it
+	// can't, it should write an appropriate response itself and return false.
+	NewConn(http.ResponseWriter, *http.Request) (ProtocolHandlerConn, bool)
 }
 
-// ClientParams are the arguments provided to a Protocol's NewClient method,
-// bundled into a struct to allow backward-compatible argument additions.
-// Protocol implementations should take care to use the supplied Spec rather
-// than constructing their own, since new fields may have been added.
-type protocolClientParams struct {
+// ProtocolHandlerConn extends StreamingHandlerConn with a method for handlers
+// to terminate the message exchange (and optionally send an error to the
+// client).
+type ProtocolHandlerConn interface {
+	StreamingHandlerConn
+
+	Close(error) error
+}
+
+// ProtocolClientParams are the arguments provided to a Protocol's NewClient
+// method, bundled into a struct to allow backward-compatible argument
+// additions. To construct them outside of a [Client], use
+// [NewProtocolClientParams].
+type ProtocolClientParams struct {
 	CompressionName  string
-	CompressionPools readOnlyCompressionPools
 	Codec            Codec
 	CompressMinBytes int
 	HTTPClient       HTTPClient
 	URL              string
-	BufferPool       *bufferPool
 	ReadMaxBytes     int
 	SendMaxBytes     int
 	// The gRPC family of protocols always needs access to a Protobuf codec to
 	// marshal and unmarshal errors.
 	Protobuf Codec
+
+	compressionPools readOnlyCompressionPools
+	bufferPool       *bufferPool
+}
+
+// CompressionNames returns the names of the client's compression algorithms,
+// most preferred first.
+func (p *ProtocolClientParams) CompressionNames() []string {
+	return p.compressionPools.Names()
+}
+
+// Compress compresses src into dst with the named compression algorithm.
+func (p *ProtocolClientParams) Compress(name string, dst, src *bytes.Buffer) error {
+	return compressWith(p.compressionPools, name, dst, src)
+}
+
+// Decompress decompresses src into dst with the named compression algorithm.
+// It returns an error with [CodeResourceExhausted] if the decompressed data is
+// larger than ReadMaxBytes.
+func (p *ProtocolClientParams) Decompress(name string, dst, src *bytes.Buffer) error {
+	return decompressWith(p.compressionPools, name, dst, src, p.ReadMaxBytes)
+}
+
+// NewProtocolClientParams constructs the parameters that a [Client] for the
+// URL, with the given options, passes to its Protocol's NewClient method.
+func NewProtocolClientParams(httpClient HTTPClient, url string, options ...ClientOption) (*ProtocolClientParams, error) {
+	config, err := newClientConfig(url, options)
+	if err != nil {
+		return nil, err
+	}
+	return config.newProtocolClientParams(httpClient, url), nil
 }
 
-// Client is the client side of a protocol. HTTP clients typically use a single
-// protocol, codec, and compressor to send requests.
-type protocolClient interface {
+// ProtocolClient is the client side of a protocol. HTTP clients typically use
+// a single protocol, codec, and compressor to send requests.
+type ProtocolClient interface {
 	// Peer describes the server for the RPC.
 	Peer() Peer
 
@@ -135,31 +233,80 @@ type protocolClient interface {
 	NewConn(context.Context, Spec, http.Header) StreamingClientConn
 }
 
-// errorTranslatingHandlerConnCloser wraps a handlerConnCloser to ensure that
+// codedErrorProtocol wraps a Protocol from outside this package, so that its
+// conns return coded errors and write coded errors to the network, just like
+// the built-in protocols'.
+type codedErrorProtocol struct {
+	Protocol
+}
+
+func (p *codedErrorProtocol) NewHandler(params *ProtocolHandlerParams) ProtocolHandler {
+	return &codedErrorProtocolHandler{ProtocolHandler: p.Protocol.NewHandler(params)}
+}
+
+func (p *codedErrorProtocol) NewClient(params *ProtocolClientParams) (ProtocolClient, error) {
+	client, err := p.Protocol.NewClient(params)
+	if err != nil {
+		return nil, err
+	}
+	return &codedErrorProtocolClient{ProtocolClient: client}, nil
+}
+
+type codedErrorProtocolHandler struct {
+	ProtocolHandler
+}
+
+func (h *codedErrorProtocolHandler) NewConn(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+) (ProtocolHandlerConn, bool) {
+	conn, ok := h.ProtocolHandler.NewConn(responseWriter, request)
+	if !ok {
+		return nil, false
+	}
+	return wrapHandlerConnWithCodedErrors(conn), true
+}
+
+type codedErrorProtocolClient struct {
+	ProtocolClient
+}
+
+func (c *codedErrorProtocolClient) NewConn(ctx context.Context, spec Spec, header http.Header) StreamingClientConn {
+	return wrapClientConnWithCodedErrors(c.ProtocolClient.NewConn(ctx, spec, header))
+}
+
+// errorTranslatingHandlerConnCloser wraps a ProtocolHandlerConn to ensure that
 // we always return coded errors to users and write coded errors to the
 // network.
 //
 // It's used in protocol implementations.
 type errorTranslatingHandlerConnCloser struct {
-	handlerConnCloser
+	ProtocolHandlerConn
 
 	toWire   func(error) error
 	fromWire func(error) error
 }
 
 func (hc *errorTranslatingHandlerConnCloser) Send(msg any) error {
-	return hc.fromWire(hc.handlerConnCloser.Send(msg))
+	return hc.fromWire(hc.ProtocolHandlerConn.Send(msg))
 }
 
 func (hc *errorTranslatingHandlerConnCloser) Receive(msg any) error {
-	return hc.fromWire(hc.handlerConnCloser.Receive(msg))
+	return hc.fromWire(hc.ProtocolHandlerConn.Receive(msg))
 }
 
 func (hc *errorTranslatingHandlerConnCloser) Close(err error) error {
-	closeErr := hc.handlerConnCloser.Close(hc.toWire(err))
+	closeErr := hc.ProtocolHandlerConn.Close(hc.toWire(err))
 	return hc.fromWire(closeErr)
 }
 
+func (hc *errorTranslatingHandlerConnCloser) sendResumeToken(token string) error {
+	if sender, ok := hc.ProtocolHandlerConn.(resumeTokenSender); ok {
+		return hc.fromWire(sender.sendResumeToken(token))
+	}
+	return nil
+}
+
 // errorTranslatingClientConn wraps a StreamingClientConn to make sure that we always
 // return coded errors from clients.
 //
@@ -186,14 +333,21 @@ func (cc *errorTranslatingClientConn) CloseResponse() error {
 	return cc.fromWire(cc.StreamingClientConn.CloseResponse())
 }
 
+func (cc *errorTranslatingClientConn) resumeToken() string {
+	if receiver, ok := cc.StreamingClientConn.(resumeTokenReceiver); ok {
+		return receiver.resumeToken()
+	}
+	return ""
+}
+
 // wrapHandlerConnWithCodedErrors ensures that we (1) automatically code
 // context-related errors correctly when writing them to the network, and (2)
 // return *Errors from all exported APIs.
-func wrapHandlerConnWithCodedErrors(conn handlerConnCloser) handlerConnCloser {
+func wrapHandlerConnWithCodedErrors(conn ProtocolHandlerConn) ProtocolHandlerConn {
 	return &errorTranslatingHandlerConnCloser{
-		handlerConnCloser: conn,
-		toWire:            wrapIfContextError,
-		fromWire:          wrapIfUncoded,
+		ProtocolHandlerConn: conn,
+		toWire:              wrapIfContextError,
+		fromWire:            wrapIfUncoded,
 	}
 }
 
@@ -206,7 +360,32 @@ func wrapClientConnWithCodedErrors(conn StreamingClientConn) StreamingClientConn
 	}
 }
 
-func sortedAcceptPostValue(handlers []protocolHandler) string {
+func mappedMethodHandlers(handlers []ProtocolHandler) map[string][]ProtocolHandler {
+	methodHandlers := make(map[string][]ProtocolHandler)
+	for _, handler := range handlers {
+		for method := range handler.Methods() {
+			methodHandlers[method] = append(methodHandlers[method], handler)
+		}
+	}
+	return methodHandlers
+}
+
+func sortedAllowMethodValue(handlers []ProtocolHandler) string {
+	methods := make(map[string]struct{})
+	for _, handler := range handlers {
+		for method := range handler.Methods() {
+			methods[method] = struct{}{}
+		}
+	}
+	allow := make([]string, 0, len(methods))
+	for method := range methods {
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+	return strings.Join(allow, ", ")
+}
+
+func sortedAcceptPostValue(handlers []ProtocolHandler) string {
 	contentTypes := make(map[string]struct{})
 	for _, handler := range handlers {
 		for contentType := range handler.ContentTypes() {
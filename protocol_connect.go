@@ -24,6 +24,7 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
@@ -47,14 +48,32 @@ const (
 	connectUnaryContentTypePrefix     = "application/"
 	connectUnaryContentTypeJSON       = connectUnaryContentTypePrefix + "json"
 	connectStreamingContentTypePrefix = "application/connect+"
+
+	connectUnaryEncodingQueryParameter    = "encoding"
+	connectUnaryMessageQueryParameter     = "message"
+	connectUnaryBase64QueryParameter      = "base64"
+	connectUnaryCompressionQueryParameter = "compression"
+	connectUnaryConnectQueryParameter     = "connect"
+	connectUnaryConnectQueryValue         = "v" + connectProtocolVersion
 )
 
-type protocolConnect struct{}
+// protocolConnect implements the Connect protocol. Its fields configure
+// features that the other protocols don't have.
+type protocolConnect struct {
+	requireProtocolHeader bool // handlers reject requests without a protocol version
+	enableGet             bool // clients send side-effect-free unary calls with GET
+	getURLMaxBytes        int
+	getUseFallback        bool
+}
 
 // NewHandler implements protocol, so it must return an interface.
-func (*protocolConnect) NewHandler(params *protocolHandlerParams) protocolHandler {
+func (p *protocolConnect) NewHandler(params *ProtocolHandlerParams) ProtocolHandler {
+	methods := map[string]struct{}{http.MethodPost: {}}
+	if params.Spec.StreamType == StreamTypeUnary && params.Spec.IdempotencyLevel == IdempotencyNoSideEffects {
+		methods[http.MethodGet] = struct{}{}
+	}
 	contentTypes := make(map[string]struct{})
-	for _, name := range params.Codecs.Names() {
+	for _, name := range params.codecs.Names() {
 		if params.Spec.StreamType == StreamTypeUnary {
 			contentTypes[connectUnaryContentTypePrefix+name] = struct{}{}
 			continue
@@ -62,29 +81,57 @@ func (*protocolConnect) NewHandler(params *protocolHandlerParams) protocolHandle
 		contentTypes[connectStreamingContentTypePrefix+name] = struct{}{}
 	}
 	return &connectHandler{
-		protocolHandlerParams: *params,
+		ProtocolHandlerParams: *params,
+		requireProtocolHeader: p.requireProtocolHeader,
+		methods:               methods,
 		accept:                contentTypes,
 	}
 }
 
 // NewClient implements protocol, so it must return an interface.
-func (*protocolConnect) NewClient(params *protocolClientParams) (protocolClient, error) {
+func (p *protocolConnect) NewClient(params *ProtocolClientParams) (ProtocolClient, error) {
 	if err := validateRequestURL(params.URL); err != nil {
 		return nil, err
 	}
-	return &connectClient{protocolClientParams: *params}, nil
+	return &connectClient{
+		ProtocolClientParams: *params,
+		enableGet:            p.enableGet,
+		getURLMaxBytes:       p.getURLMaxBytes,
+		getUseFallback:       p.getUseFallback,
+	}, nil
 }
 
 type connectHandler struct {
-	protocolHandlerParams
+	ProtocolHandlerParams
 
-	accept map[string]struct{}
+	requireProtocolHeader bool
+	methods               map[string]struct{}
+	accept                map[string]struct{}
+}
+
+func (h *connectHandler) Methods() map[string]struct{} {
+	return h.methods
 }
 
 func (h *connectHandler) ContentTypes() map[string]struct{} {
 	return h.accept
 }
 
+func (h *connectHandler) CanHandlePayload(request *http.Request, contentType string) bool {
+	if isTwirpRoute(request) {
+		return false
+	}
+	if request.Method == http.MethodGet {
+		// GET requests don't have a body, so the codec is in the query string.
+		contentType = connectContentTypeFromCodecName(
+			h.Spec.StreamType,
+			request.URL.Query().Get(connectUnaryEncodingQueryParameter),
+		)
+	}
+	_, ok := h.accept[contentType]
+	return ok
+}
+
 func (*connectHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
 	timeout := request.Header.Get(connectHeaderTimeout)
 	if timeout == "" {
@@ -107,34 +154,71 @@ func (*connectHandler) SetTimeout(request *http.Request) (context.Context, conte
 func (h *connectHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (ProtocolHandlerConn, bool) {
+	isGet := request.Method == http.MethodGet
+	var query url.Values
+	if isGet {
+		query = request.URL.Query()
+	}
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
 	var contentEncoding, acceptEncoding string
 	if h.Spec.StreamType == StreamTypeUnary {
-		contentEncoding = request.Header.Get(connectUnaryHeaderCompression)
+		if isGet {
+			contentEncoding = query.Get(connectUnaryCompressionQueryParameter)
+		} else {
+			contentEncoding = request.Header.Get(connectUnaryHeaderCompression)
+		}
 		acceptEncoding = request.Header.Get(connectUnaryHeaderAcceptCompression)
 	} else {
 		contentEncoding = request.Header.Get(connectStreamingHeaderCompression)
 		acceptEncoding = request.Header.Get(connectStreamingHeaderAcceptCompression)
 	}
 	requestCompression, responseCompression, failed := negotiateCompression(
-		h.CompressionPools,
+		h.compressionPools,
 		contentEncoding,
 		acceptEncoding,
 	)
 	if failed == nil {
 		failed = checkServerStreamsCanFlush(h.Spec, responseWriter)
 	}
-	if failed == nil {
+	if failed == nil && isGet {
+		version := query.Get(connectUnaryConnectQueryParameter)
+		if version == "" && h.requireProtocolHeader {
+			failed = errorf(CodeInvalidArgument, "missing required query parameter: set %s to %q", connectUnaryConnectQueryParameter, connectUnaryConnectQueryValue)
+		} else if version != "" && version != connectUnaryConnectQueryValue {
+			failed = errorf(CodeInvalidArgument, "%s must be %q: got %q", connectUnaryConnectQueryParameter, connectUnaryConnectQueryValue, version)
+		}
+	}
+	if failed == nil && !isGet {
 		version := request.Header.Get(connectHeaderProtocolVersion)
-		if version == "" && h.RequireConnectProtocolHeader {
+		if version == "" && h.requireProtocolHeader {
 			failed = errorf(CodeInvalidArgument, "missing required header: set %s to %q", connectHeaderProtocolVersion, connectProtocolVersion)
 		} else if version != "" && version != connectProtocolVersion {
 			failed = errorf(CodeInvalidArgument, "%s must be %q: got %q", connectHeaderProtocolVersion, connectProtocolVersion, version)
 		}
 	}
 
+	// GET requests carry the message, codec, and compression in the query
+	// string rather than the body and headers.
+	requestBody := request.Body
+	contentType := request.Header.Get(headerContentType)
+	if isGet {
+		if failed == nil && !query.Has(connectUnaryEncodingQueryParameter) {
+			failed = errorf(CodeInvalidArgument, "missing %s parameter", connectUnaryEncodingQueryParameter)
+		} else if failed == nil && !query.Has(connectUnaryMessageQueryParameter) {
+			failed = errorf(CodeInvalidArgument, "missing %s parameter", connectUnaryMessageQueryParameter)
+		}
+		requestBody = io.NopCloser(connectQueryValueReader(
+			query.Get(connectUnaryMessageQueryParameter),
+			query.Get(connectUnaryBase64QueryParameter) == "1",
+		))
+		contentType = connectContentTypeFromCodecName(
+			h.Spec.StreamType,
+			query.Get(connectUnaryEncodingQueryParameter),
+		)
+	}
+
 	// Write any remaining headers here:
 	// (1) any writes to the stream will implicitly send the headers, so we
 	// should get all of gRPC's required response headers ready.
@@ -143,7 +227,7 @@ func (h *connectHandler) NewConn(
 	// Since we know that these header keys are already in canonical form, we can
 	// skip the normalization in Header.Set.
 	header := responseWriter.Header()
-	header[headerContentType] = []string{request.Header.Get(headerContentType)}
+	header[headerContentType] = []string{contentType}
 	acceptCompressionHeader := connectUnaryHeaderAcceptCompression
 	if h.Spec.StreamType != StreamTypeUnary {
 		acceptCompressionHeader = connectStreamingHeaderAcceptCompression
@@ -155,18 +239,16 @@ func (h *connectHandler) NewConn(
 			header[connectStreamingHeaderCompression] = []string{responseCompression}
 		}
 	}
-	header[acceptCompressionHeader] = []string{h.CompressionPools.CommaSeparatedNames()}
+	header[acceptCompressionHeader] = []string{h.compressionPools.CommaSeparatedNames()}
 
-	codecName := connectCodecFromContentType(
-		h.Spec.StreamType,
-		request.Header.Get(headerContentType),
-	)
-	codec := h.Codecs.Get(codecName) // handler.go guarantees this is not nil
+	codecName := connectCodecFromContentType(h.Spec.StreamType, contentType)
+	codec := h.codecs.Get(codecName) // handler.go guarantees this is not nil
 
-	var conn handlerConnCloser
+	var conn ProtocolHandlerConn
 	peer := Peer{
 		Addr:     request.RemoteAddr,
 		Protocol: ProtocolConnect,
+		Query:    query,
 	}
 	if h.Spec.StreamType == StreamTypeUnary {
 		conn = &connectUnaryHandlerConn{
@@ -179,16 +261,16 @@ func (h *connectHandler) NewConn(
 				codec:            codec,
 				compressMinBytes: h.CompressMinBytes,
 				compressionName:  responseCompression,
-				compressionPool:  h.CompressionPools.Get(responseCompression),
-				bufferPool:       h.BufferPool,
+				compressionPool:  h.compressionPools.Get(responseCompression),
+				bufferPool:       h.bufferPool,
 				header:           responseWriter.Header(),
 				sendMaxBytes:     h.SendMaxBytes,
 			},
 			unmarshaler: connectUnaryUnmarshaler{
-				reader:          request.Body,
+				reader:          requestBody,
 				codec:           codec,
-				compressionPool: h.CompressionPools.Get(requestCompression),
-				bufferPool:      h.BufferPool,
+				compressionPool: h.compressionPools.Get(requestCompression),
+				bufferPool:      h.bufferPool,
 				readMaxBytes:    h.ReadMaxBytes,
 			},
 			responseTrailer: make(http.Header),
@@ -204,8 +286,8 @@ func (h *connectHandler) NewConn(
 					writer:           responseWriter,
 					codec:            codec,
 					compressMinBytes: h.CompressMinBytes,
-					compressionPool:  h.CompressionPools.Get(responseCompression),
-					bufferPool:       h.BufferPool,
+					compressionPool:  h.compressionPools.Get(responseCompression),
+					bufferPool:       h.bufferPool,
 					sendMaxBytes:     h.SendMaxBytes,
 				},
 			},
@@ -213,8 +295,8 @@ func (h *connectHandler) NewConn(
 				envelopeReader: envelopeReader{
 					reader:          request.Body,
 					codec:           codec,
-					compressionPool: h.CompressionPools.Get(requestCompression),
-					bufferPool:      h.BufferPool,
+					compressionPool: h.compressionPools.Get(requestCompression),
+					bufferPool:      h.bufferPool,
 					readMaxBytes:    h.ReadMaxBytes,
 				},
 			},
@@ -232,7 +314,11 @@ func (h *connectHandler) NewConn(
 }
 
 type connectClient struct {
-	protocolClientParams
+	ProtocolClientParams
+
+	enableGet      bool
+	getURLMaxBytes int
+	getUseFallback bool
 }
 
 func (c *connectClient) Peer() Peer {
@@ -264,7 +350,7 @@ func (c *connectClient) WriteRequestHeader(streamType StreamType, header http.He
 			header[connectStreamingHeaderCompression] = []string{c.CompressionName}
 		}
 	}
-	if acceptCompression := c.CompressionPools.CommaSeparatedNames(); acceptCompression != "" {
+	if acceptCompression := c.compressionPools.CommaSeparatedNames(); acceptCompression != "" {
 		header[acceptCompressionHeader] = []string{acceptCompression}
 	}
 }
@@ -290,27 +376,38 @@ func (c *connectClient) NewConn(
 			spec:             spec,
 			peer:             c.Peer(),
 			duplexCall:       duplexCall,
-			compressionPools: c.CompressionPools,
-			bufferPool:       c.BufferPool,
-			marshaler: connectUnaryMarshaler{
-				writer:           duplexCall,
-				codec:            c.Codec,
-				compressMinBytes: c.CompressMinBytes,
-				compressionName:  c.CompressionName,
-				compressionPool:  c.CompressionPools.Get(c.CompressionName),
-				bufferPool:       c.BufferPool,
-				header:           duplexCall.Header(),
-				sendMaxBytes:     c.SendMaxBytes,
+			compressionPools: c.compressionPools,
+			bufferPool:       c.bufferPool,
+			marshaler: connectUnaryRequestMarshaler{
+				connectUnaryMarshaler: connectUnaryMarshaler{
+					writer:           duplexCall,
+					codec:            c.Codec,
+					compressMinBytes: c.CompressMinBytes,
+					compressionName:  c.CompressionName,
+					compressionPool:  c.compressionPools.Get(c.CompressionName),
+					bufferPool:       c.bufferPool,
+					header:           duplexCall.Header(),
+					sendMaxBytes:     c.SendMaxBytes,
+				},
 			},
 			unmarshaler: connectUnaryUnmarshaler{
 				reader:       duplexCall,
 				codec:        c.Codec,
-				bufferPool:   c.BufferPool,
+				bufferPool:   c.bufferPool,
 				readMaxBytes: c.ReadMaxBytes,
 			},
 			responseHeader:  make(http.Header),
 			responseTrailer: make(http.Header),
 		}
+		if c.enableGet && spec.IdempotencyLevel == IdempotencyNoSideEffects {
+			unaryConn.marshaler.enableGet = true
+			unaryConn.marshaler.getURLMaxBytes = c.getURLMaxBytes
+			unaryConn.marshaler.getUseFallback = c.getUseFallback
+			unaryConn.marshaler.duplexCall = duplexCall
+			if stable, ok := c.Codec.(stableCodec); ok {
+				unaryConn.marshaler.stableCodec = stable
+			}
+		}
 		conn = unaryConn
 		duplexCall.SetValidateResponse(unaryConn.validateResponse)
 	} else {
@@ -318,16 +415,16 @@ func (c *connectClient) NewConn(
 			spec:             spec,
 			peer:             c.Peer(),
 			duplexCall:       duplexCall,
-			compressionPools: c.CompressionPools,
-			bufferPool:       c.BufferPool,
+			compressionPools: c.compressionPools,
+			bufferPool:       c.bufferPool,
 			codec:            c.Codec,
 			marshaler: connectStreamingMarshaler{
 				envelopeWriter: envelopeWriter{
 					writer:           duplexCall,
 					codec:            c.Codec,
 					compressMinBytes: c.CompressMinBytes,
-					compressionPool:  c.CompressionPools.Get(c.CompressionName),
-					bufferPool:       c.BufferPool,
+					compressionPool:  c.compressionPools.Get(c.CompressionName),
+					bufferPool:       c.bufferPool,
 					sendMaxBytes:     c.SendMaxBytes,
 				},
 			},
@@ -335,7 +432,7 @@ func (c *connectClient) NewConn(
 				envelopeReader: envelopeReader{
 					reader:       duplexCall,
 					codec:        c.Codec,
-					bufferPool:   c.BufferPool,
+					bufferPool:   c.bufferPool,
 					readMaxBytes: c.ReadMaxBytes,
 				},
 			},
@@ -354,7 +451,7 @@ type connectUnaryClientConn struct {
 	duplexCall       *duplexHTTPCall
 	compressionPools readOnlyCompressionPools
 	bufferPool       *bufferPool
-	marshaler        connectUnaryMarshaler
+	marshaler        connectUnaryRequestMarshaler
 	unmarshaler      connectUnaryUnmarshaler
 	responseHeader   http.Header
 	responseTrailer  http.Header
@@ -485,6 +582,10 @@ func (cc *connectStreamingClientConn) CloseRequest() error {
 	return cc.duplexCall.CloseWrite()
 }
 
+func (cc *connectStreamingClientConn) resumeToken() string {
+	return cc.unmarshaler.resumeToken
+}
+
 func (cc *connectStreamingClientConn) Receive(msg any) error {
 	cc.duplexCall.BlockUntilResponseReady()
 	err := cc.unmarshaler.Unmarshal(msg)
@@ -665,6 +766,16 @@ func (hc *connectStreamingHandlerConn) Send(msg any) error {
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (hc *connectStreamingHandlerConn) sendResumeToken(token string) error {
+	if hc.request.Header.Get(headerAcceptResumeToken) == "" {
+		return nil
+	}
+	if err := hc.marshaler.WriteResumeToken(token); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
 func (hc *connectStreamingHandlerConn) ResponseHeader() http.Header {
 	return hc.responseWriter.Header()
 }
@@ -804,6 +915,118 @@ func (m *connectUnaryMarshaler) write(data []byte) *Error {
 	return nil
 }
 
+// connectUnaryRequestMarshaler marshals unary requests, sending them with HTTP
+// GET when the procedure and client configuration allow it.
+type connectUnaryRequestMarshaler struct {
+	connectUnaryMarshaler
+
+	enableGet      bool
+	getURLMaxBytes int
+	getUseFallback bool
+	stableCodec    stableCodec
+	duplexCall     *duplexHTTPCall
+}
+
+func (m *connectUnaryRequestMarshaler) Marshal(message any) *Error {
+	if !m.enableGet {
+		return m.connectUnaryMarshaler.Marshal(message)
+	}
+	if m.stableCodec == nil {
+		if m.getUseFallback {
+			return m.connectUnaryMarshaler.Marshal(message)
+		}
+		return errorf(CodeInternal, "codec %s doesn't support stable marshaling: can't use HTTP GET", m.codec.Name())
+	}
+	return m.marshalWithGet(message)
+}
+
+func (m *connectUnaryRequestMarshaler) marshalWithGet(message any) *Error {
+	var data []byte
+	if message != nil {
+		var err error
+		data, err = m.stableCodec.MarshalStable(message)
+		if err != nil {
+			return errorf(CodeInternal, "marshal message stable: %w", err)
+		}
+	}
+	isTooBig := m.sendMaxBytes > 0 && len(data) > m.sendMaxBytes
+	if isTooBig && m.compressionPool == nil {
+		return NewError(CodeResourceExhausted, fmt.Errorf(
+			"message size %d exceeds sendMaxBytes %d: enabling request compression may help",
+			len(data),
+			m.sendMaxBytes,
+		))
+	}
+	if !isTooBig {
+		getURL := m.buildGetURL(data, false /* compressed */)
+		if m.fitsInURL(getURL) {
+			return m.writeWithGet(getURL)
+		}
+		if m.compressionPool == nil {
+			if m.getUseFallback {
+				return m.write(data)
+			}
+			return NewError(CodeResourceExhausted, fmt.Errorf(
+				"url size %d exceeds getURLMaxBytes %d: enabling request compression may help",
+				len(getURL.String()),
+				m.getURLMaxBytes,
+			))
+		}
+	}
+	// Try compressing the message to make it fit.
+	uncompressed := bytes.NewBuffer(data)
+	defer m.bufferPool.Put(uncompressed)
+	compressed := m.bufferPool.Get()
+	defer m.bufferPool.Put(compressed)
+	if err := m.compressionPool.Compress(compressed, uncompressed); err != nil {
+		return err
+	}
+	if m.sendMaxBytes > 0 && compressed.Len() > m.sendMaxBytes {
+		return NewError(CodeResourceExhausted, fmt.Errorf("compressed message size %d exceeds sendMaxBytes %d", compressed.Len(), m.sendMaxBytes))
+	}
+	getURL := m.buildGetURL(compressed.Bytes(), true /* compressed */)
+	if m.fitsInURL(getURL) {
+		return m.writeWithGet(getURL)
+	}
+	if m.getUseFallback {
+		m.header.Set(connectUnaryHeaderCompression, m.compressionName)
+		return m.write(compressed.Bytes())
+	}
+	return NewError(CodeResourceExhausted, fmt.Errorf("compressed url size %d exceeds getURLMaxBytes %d", len(getURL.String()), m.getURLMaxBytes))
+}
+
+func (m *connectUnaryRequestMarshaler) fitsInURL(getURL *url.URL) bool {
+	return m.getURLMaxBytes <= 0 || len(getURL.String()) <= m.getURLMaxBytes
+}
+
+func (m *connectUnaryRequestMarshaler) buildGetURL(data []byte, compressed bool) *url.URL {
+	getURL := *m.duplexCall.URL()
+	query := getURL.Query()
+	query.Set(connectUnaryConnectQueryParameter, connectUnaryConnectQueryValue)
+	query.Set(connectUnaryEncodingQueryParameter, m.codec.Name())
+	if m.stableCodec.IsBinary() || compressed {
+		query.Set(connectUnaryMessageQueryParameter, base64.RawURLEncoding.EncodeToString(data))
+		query.Set(connectUnaryBase64QueryParameter, "1")
+	} else {
+		query.Set(connectUnaryMessageQueryParameter, string(data))
+	}
+	if compressed {
+		query.Set(connectUnaryCompressionQueryParameter, m.compressionName)
+	}
+	getURL.RawQuery = query.Encode()
+	return &getURL
+}
+
+func (m *connectUnaryRequestMarshaler) writeWithGet(getURL *url.URL) *Error {
+	// The protocol version is in the query string, and GET requests don't have
+	// a body to describe.
+	delete(m.header, connectHeaderProtocolVersion)
+	delete(m.header, headerContentType)
+	m.duplexCall.SetMethod(http.MethodGet)
+	*m.duplexCall.URL() = *getURL
+	return nil
+}
+
 type connectUnaryUnmarshaler struct {
 	reader          io.Reader
 	codec           Codec
@@ -1034,6 +1257,19 @@ func connectUserAgent() string {
 	return fmt.Sprintf("connect-go/%s (%s)", Version, runtime.Version())
 }
 
+// connectQueryValueReader reads a query parameter value, decoding it from
+// URL-safe base64 (with or without padding) if necessary.
+func connectQueryValueReader(data string, base64Encoded bool) io.Reader {
+	reader := strings.NewReader(data)
+	if !base64Encoded {
+		return reader
+	}
+	if len(data)%4 != 0 {
+		return base64.NewDecoder(base64.RawURLEncoding, reader)
+	}
+	return base64.NewDecoder(base64.URLEncoding, reader)
+}
+
 func connectCodecFromContentType(streamType StreamType, contentType string) string {
 	if streamType == StreamTypeUnary {
 		return strings.TrimPrefix(contentType, connectUnaryContentTypePrefix)
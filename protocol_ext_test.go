@@ -0,0 +1,371 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestCustomProtocol(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				if request.Peer().Protocol != legacyProtocolName {
+					return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("unexpected protocol %q", request.Peer().Protocol))
+				}
+				if request.Msg.Number < 0 {
+					return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("number must be non-negative"))
+				}
+				response := connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number})
+				response.Header().Set("Legacy-Echo", request.Header().Get("Legacy-Echo"))
+				return response, nil
+			},
+			countUp: func(ctx context.Context, request *connect.Request[pingv1_test.CountUpRequest], stream *connect.ServerStream[pingv1_test.CountUpResponse]) error {
+				return stream.Send(&pingv1_test.CountUpResponse{Number: 1})
+			},
+		},
+		connect.WithProtocols(&legacyProtocol{}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	t.Run("legacy", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithProtocol(&legacyProtocol{}),
+		)
+		request := connect.NewRequest(&pingv1_test.PingRequest{Number: 42})
+		request.Header().Set("Legacy-Echo", "hello")
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, int64(42))
+		assert.Equal(t, response.Header().Get("Legacy-Echo"), "hello")
+
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: -1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.Equal(t, err.Error(), "invalid_argument: number must be non-negative")
+
+		// The legacy protocol doesn't support streaming.
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1_test.CountUpRequest{Number: 1}))
+		if err == nil {
+			assert.False(t, stream.Receive())
+			err = stream.Err()
+			_ = stream.Close()
+		}
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+	})
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		// The built-in protocols still work alongside the custom one, but
+		// their requests aren't served with the legacy protocol.
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+	})
+	t.Run("accept_post", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect_test.PingServiceName+"/Ping",
+			strings.NewReader("{}"),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "text/plain")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		_ = response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusUnsupportedMediaType)
+		assert.True(t, strings.Contains(response.Header.Get("Accept-Post"), legacyContentType))
+	})
+}
+
+func TestProtocolParams(t *testing.T) {
+	t.Parallel()
+	t.Run("handler", func(t *testing.T) {
+		t.Parallel()
+		params := connect.NewProtocolHandlerParams(
+			connect.Spec{Procedure: pingv1connect_test.PingServiceName + "/Ping", StreamType: connect.StreamTypeUnary},
+			connect.WithReadMaxBytes(1024),
+		)
+		assert.Equal(t, params.Spec.Procedure, pingv1connect_test.PingServiceName+"/Ping")
+		assert.Equal(t, params.ReadMaxBytes, 1024)
+		assert.NotNil(t, params.Codec("proto"))
+		assert.NotNil(t, params.Codec("json"))
+		assert.Equal(t, params.CompressionNames(), []string{"gzip"})
+		var compressed, decompressed bytes.Buffer
+		assert.Nil(t, params.Compress("gzip", &compressed, bytes.NewBufferString("hello")))
+		assert.Nil(t, params.Decompress("gzip", &decompressed, &compressed))
+		assert.Equal(t, decompressed.String(), "hello")
+	})
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		url := "https://example.com/" + pingv1connect_test.PingServiceName + "/Ping"
+		params, err := connect.NewProtocolClientParams(http.DefaultClient, url, connect.WithProtoJSON(), connect.WithSendGzip())
+		assert.Nil(t, err)
+		assert.Equal(t, params.URL, url)
+		assert.Equal(t, params.Codec.Name(), "json")
+		assert.Equal(t, params.Protobuf.Name(), "proto")
+		assert.Equal(t, params.CompressionName, "gzip")
+		client, err := (&legacyProtocol{}).NewClient(params)
+		assert.Nil(t, err)
+		assert.Equal(t, client.Peer().Protocol, legacyProtocolName)
+
+		_, err = connect.NewProtocolClientParams(http.DefaultClient, url, connect.WithSendCompression("br"))
+		assert.NotNil(t, err)
+	})
+}
+
+const (
+	legacyProtocolName = "legacy"
+	legacyContentType  = "application/x-legacy"
+	legacyCodeHeader   = "Legacy-Code"
+	legacyEncoding     = "Legacy-Encoding"
+)
+
+// legacyProtocol is a minimal unary-only protocol: requests and responses are
+// single Protobuf-encoded messages, optionally compressed, and errors are
+// described by a header and a plain-text body.
+type legacyProtocol struct{}
+
+func (*legacyProtocol) NewHandler(params *connect.ProtocolHandlerParams) connect.ProtocolHandler {
+	return &legacyHandler{params: params}
+}
+
+func (*legacyProtocol) NewClient(params *connect.ProtocolClientParams) (connect.ProtocolClient, error) {
+	return &legacyClient{params: params}, nil
+}
+
+type legacyHandler struct {
+	params *connect.ProtocolHandlerParams
+}
+
+func (h *legacyHandler) Methods() map[string]struct{} {
+	return map[string]struct{}{http.MethodPost: {}}
+}
+
+func (h *legacyHandler) ContentTypes() map[string]struct{} {
+	return map[string]struct{}{legacyContentType: {}}
+}
+
+func (h *legacyHandler) CanHandlePayload(_ *http.Request, contentType string) bool {
+	return contentType == legacyContentType
+}
+
+func (h *legacyHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+	return request.Context(), nil, nil
+}
+
+func (h *legacyHandler) NewConn(responseWriter http.ResponseWriter, request *http.Request) (connect.ProtocolHandlerConn, bool) {
+	return &legacyHandlerConn{
+		params:         h.params,
+		responseWriter: responseWriter,
+		request:        request,
+		responseHeader: make(http.Header),
+	}, true
+}
+
+type legacyHandlerConn struct {
+	params         *connect.ProtocolHandlerParams
+	responseWriter http.ResponseWriter
+	request        *http.Request
+	responseHeader http.Header
+	received       bool
+	response       bytes.Buffer
+}
+
+func (c *legacyHandlerConn) Spec() connect.Spec { return c.params.Spec }
+
+func (c *legacyHandlerConn) Peer() connect.Peer {
+	return connect.Peer{Addr: c.request.RemoteAddr, Protocol: legacyProtocolName}
+}
+
+func (c *legacyHandlerConn) RequestHeader() http.Header   { return c.request.Header }
+func (c *legacyHandlerConn) ResponseHeader() http.Header  { return c.responseHeader }
+func (c *legacyHandlerConn) ResponseTrailer() http.Header { return c.responseHeader }
+
+func (c *legacyHandlerConn) Receive(msg any) error {
+	if c.received {
+		return io.EOF
+	}
+	c.received = true
+	if c.params.Spec.StreamType != connect.StreamTypeUnary {
+		return connect.NewError(connect.CodeUnimplemented, errors.New("legacy protocol is unary-only"))
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(c.request.Body); err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	if err := c.params.Decompress(c.request.Header.Get(legacyEncoding), &data, &body); err != nil {
+		return err
+	}
+	return c.params.Codec("proto").Unmarshal(data.Bytes(), msg)
+}
+
+func (c *legacyHandlerConn) Send(msg any) error {
+	data, err := c.params.Codec("proto").Marshal(msg)
+	if err != nil {
+		return err
+	}
+	names := c.params.CompressionNames()
+	if len(names) == 0 {
+		_, err = c.response.Write(data)
+		return err
+	}
+	c.responseHeader.Set(legacyEncoding, names[0])
+	return c.params.Compress(names[0], &c.response, bytes.NewBuffer(data))
+}
+
+func (c *legacyHandlerConn) Close(err error) error {
+	header := c.responseWriter.Header()
+	for key, values := range c.responseHeader {
+		header[key] = values
+	}
+	header.Set("Content-Type", legacyContentType)
+	if err != nil {
+		header.Del(legacyEncoding)
+		header.Set(legacyCodeHeader, connect.CodeOf(err).String())
+		var connectErr *connect.Error
+		message := err.Error()
+		if errors.As(err, &connectErr) {
+			message = connectErr.Message()
+		}
+		c.responseWriter.WriteHeader(http.StatusOK)
+		_, writeErr := io.WriteString(c.responseWriter, message)
+		return writeErr
+	}
+	c.responseWriter.WriteHeader(http.StatusOK)
+	_, writeErr := c.responseWriter.Write(c.response.Bytes())
+	return writeErr
+}
+
+type legacyClient struct {
+	params *connect.ProtocolClientParams
+}
+
+func (c *legacyClient) Peer() connect.Peer {
+	return connect.Peer{Addr: c.params.URL, Protocol: legacyProtocolName}
+}
+
+func (c *legacyClient) WriteRequestHeader(_ connect.StreamType, header http.Header) {
+	header.Set("Content-Type", legacyContentType)
+}
+
+func (c *legacyClient) NewConn(ctx context.Context, spec connect.Spec, header http.Header) connect.StreamingClientConn {
+	return &legacyClientConn{
+		ctx:           ctx,
+		params:        c.params,
+		peer:          c.Peer(),
+		spec:          spec,
+		requestHeader: header,
+	}
+}
+
+type legacyClientConn struct {
+	ctx           context.Context //nolint:containedctx
+	params        *connect.ProtocolClientParams
+	peer          connect.Peer
+	spec          connect.Spec
+	requestHeader http.Header
+	request       bytes.Buffer
+	response      *http.Response
+	err           error
+	received      bool
+}
+
+func (c *legacyClientConn) Spec() connect.Spec           { return c.spec }
+func (c *legacyClientConn) Peer() connect.Peer           { return c.peer }
+func (c *legacyClientConn) RequestHeader() http.Header   { return c.requestHeader }
+func (c *legacyClientConn) ResponseTrailer() http.Header { return make(http.Header) }
+
+func (c *legacyClientConn) ResponseHeader() http.Header {
+	if c.response == nil {
+		return make(http.Header)
+	}
+	return c.response.Header
+}
+
+func (c *legacyClientConn) Send(msg any) error {
+	data, err := c.params.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.request.Write(data)
+	return err
+}
+
+func (c *legacyClientConn) CloseRequest() error {
+	request, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.params.URL, &c.request)
+	if err != nil {
+		return err
+	}
+	request.Header = c.requestHeader
+	c.response, c.err = c.params.HTTPClient.Do(request)
+	return nil
+}
+
+func (c *legacyClientConn) Receive(msg any) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.received {
+		return io.EOF
+	}
+	c.received = true
+	if c.response.StatusCode != http.StatusOK {
+		return connect.NewError(connect.CodeUnavailable, fmt.Errorf("HTTP status %s", c.response.Status))
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(c.response.Body); err != nil {
+		return err
+	}
+	if codeText := c.response.Header.Get(legacyCodeHeader); codeText != "" {
+		var code connect.Code
+		if err := code.UnmarshalText([]byte(codeText)); err != nil {
+			return err
+		}
+		return connect.NewError(code, errors.New(body.String()))
+	}
+	var data bytes.Buffer
+	if err := c.params.Decompress(c.response.Header.Get(legacyEncoding), &data, &body); err != nil {
+		return err
+	}
+	return c.params.Codec.Unmarshal(data.Bytes(), msg)
+}
+
+func (c *legacyClientConn) CloseResponse() error {
+	if c.response == nil {
+		return nil
+	}
+	return c.response.Body.Close()
+}
@@ -64,6 +64,7 @@ var (
 		{time.Hour, 'H'},
 	}
 	grpcTimeoutUnitLookup        = make(map[byte]time.Duration)
+	grpcAllowedMethods           = map[string]struct{}{http.MethodPost: {}}
 	errTrailersWithoutGRPCStatus = fmt.Errorf("gRPC protocol error: no %s trailer", grpcHeaderStatus)
 )
 
@@ -78,47 +79,56 @@ type protocolGRPC struct {
 }
 
 // NewHandler implements protocol, so it must return an interface.
-func (g *protocolGRPC) NewHandler(params *protocolHandlerParams) protocolHandler {
+func (g *protocolGRPC) NewHandler(params *ProtocolHandlerParams) ProtocolHandler {
 	bare, prefix := grpcContentTypeDefault, grpcContentTypePrefix
 	if g.web {
 		bare, prefix = grpcWebContentTypeDefault, grpcWebContentTypePrefix
 	}
 	contentTypes := make(map[string]struct{})
-	for _, name := range params.Codecs.Names() {
+	for _, name := range params.codecs.Names() {
 		contentTypes[prefix+name] = struct{}{}
 	}
-	if params.Codecs.Get(codecNameProto) != nil {
+	if params.codecs.Get(codecNameProto) != nil {
 		contentTypes[bare] = struct{}{}
 	}
 	return &grpcHandler{
-		protocolHandlerParams: *params,
+		ProtocolHandlerParams: *params,
 		web:                   g.web,
 		accept:                contentTypes,
 	}
 }
 
 // NewClient implements protocol, so it must return an interface.
-func (g *protocolGRPC) NewClient(params *protocolClientParams) (protocolClient, error) {
+func (g *protocolGRPC) NewClient(params *ProtocolClientParams) (ProtocolClient, error) {
 	if err := validateRequestURL(params.URL); err != nil {
 		return nil, err
 	}
 	return &grpcClient{
-		protocolClientParams: *params,
+		ProtocolClientParams: *params,
 		web:                  g.web,
 	}, nil
 }
 
 type grpcHandler struct {
-	protocolHandlerParams
+	ProtocolHandlerParams
 
 	web    bool
 	accept map[string]struct{}
 }
 
+func (g *grpcHandler) Methods() map[string]struct{} {
+	return grpcAllowedMethods
+}
+
 func (g *grpcHandler) ContentTypes() map[string]struct{} {
 	return g.accept
 }
 
+func (g *grpcHandler) CanHandlePayload(_ *http.Request, contentType string) bool {
+	_, ok := g.accept[contentType]
+	return ok
+}
+
 func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
 	timeout, err := grpcParseTimeout(request.Header.Get(grpcHeaderTimeout))
 	if err != nil && !errors.Is(err, errNoTimeout) {
@@ -136,11 +146,11 @@ func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.
 func (g *grpcHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (ProtocolHandlerConn, bool) {
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
 	requestCompression, responseCompression, failed := negotiateCompression(
-		g.CompressionPools,
+		g.compressionPools,
 		request.Header.Get(grpcHeaderCompression),
 		request.Header.Get(grpcHeaderAcceptCompression),
 	)
@@ -157,13 +167,13 @@ func (g *grpcHandler) NewConn(
 	// skip the normalization in Header.Set.
 	header := responseWriter.Header()
 	header[headerContentType] = []string{request.Header.Get(headerContentType)}
-	header[grpcHeaderAcceptCompression] = []string{g.CompressionPools.CommaSeparatedNames()}
+	header[grpcHeaderAcceptCompression] = []string{g.compressionPools.CommaSeparatedNames()}
 	if responseCompression != compressionIdentity {
 		header[grpcHeaderCompression] = []string{responseCompression}
 	}
 
 	codecName := grpcCodecFromContentType(g.web, request.Header.Get(headerContentType))
-	codec := g.Codecs.Get(codecName) // handler.go guarantees this is not nil
+	codec := g.codecs.Get(codecName) // handler.go guarantees this is not nil
 	protocolName := ProtocolGRPC
 	if g.web {
 		protocolName = ProtocolGRPCWeb
@@ -175,15 +185,15 @@ func (g *grpcHandler) NewConn(
 			Protocol: protocolName,
 		},
 		web:        g.web,
-		bufferPool: g.BufferPool,
-		protobuf:   g.Codecs.Protobuf(), // for errors
+		bufferPool: g.bufferPool,
+		protobuf:   g.codecs.Protobuf(), // for errors
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
 				writer:           responseWriter,
-				compressionPool:  g.CompressionPools.Get(responseCompression),
+				compressionPool:  g.compressionPools.Get(responseCompression),
 				codec:            codec,
 				compressMinBytes: g.CompressMinBytes,
-				bufferPool:       g.BufferPool,
+				bufferPool:       g.bufferPool,
 				sendMaxBytes:     g.SendMaxBytes,
 			},
 		},
@@ -195,8 +205,8 @@ func (g *grpcHandler) NewConn(
 			envelopeReader: envelopeReader{
 				reader:          request.Body,
 				codec:           codec,
-				compressionPool: g.CompressionPools.Get(requestCompression),
-				bufferPool:      g.BufferPool,
+				compressionPool: g.compressionPools.Get(requestCompression),
+				bufferPool:      g.bufferPool,
 				readMaxBytes:    g.ReadMaxBytes,
 			},
 			web: g.web,
@@ -211,7 +221,7 @@ func (g *grpcHandler) NewConn(
 }
 
 type grpcClient struct {
-	protocolClientParams
+	ProtocolClientParams
 
 	web bool
 }
@@ -237,7 +247,7 @@ func (g *grpcClient) WriteRequestHeader(_ StreamType, header http.Header) {
 	if g.CompressionName != "" && g.CompressionName != compressionIdentity {
 		header[grpcHeaderCompression] = []string{g.CompressionName}
 	}
-	if acceptCompression := g.CompressionPools.CommaSeparatedNames(); acceptCompression != "" {
+	if acceptCompression := g.compressionPools.CommaSeparatedNames(); acceptCompression != "" {
 		header[grpcHeaderAcceptCompression] = []string{acceptCompression}
 	}
 	if !g.web {
@@ -270,16 +280,16 @@ func (g *grpcClient) NewConn(
 		spec:             spec,
 		peer:             g.Peer(),
 		duplexCall:       duplexCall,
-		compressionPools: g.CompressionPools,
-		bufferPool:       g.BufferPool,
+		compressionPools: g.compressionPools,
+		bufferPool:       g.bufferPool,
 		protobuf:         g.Protobuf,
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
 				writer:           duplexCall,
-				compressionPool:  g.CompressionPools.Get(g.CompressionName),
+				compressionPool:  g.compressionPools.Get(g.CompressionName),
 				codec:            g.Codec,
 				compressMinBytes: g.CompressMinBytes,
-				bufferPool:       g.BufferPool,
+				bufferPool:       g.bufferPool,
 				sendMaxBytes:     g.SendMaxBytes,
 			},
 		},
@@ -287,7 +297,7 @@ func (g *grpcClient) NewConn(
 			envelopeReader: envelopeReader{
 				reader:       duplexCall,
 				codec:        g.Codec,
-				bufferPool:   g.BufferPool,
+				bufferPool:   g.bufferPool,
 				readMaxBytes: g.ReadMaxBytes,
 			},
 		},
@@ -348,6 +358,10 @@ func (cc *grpcClientConn) CloseRequest() error {
 	return cc.duplexCall.CloseWrite()
 }
 
+func (cc *grpcClientConn) resumeToken() string {
+	return cc.unmarshaler.envelopeReader.resumeToken
+}
+
 func (cc *grpcClientConn) Receive(msg any) error {
 	cc.duplexCall.BlockUntilResponseReady()
 	err := cc.unmarshaler.Unmarshal(msg)
@@ -463,6 +477,20 @@ func (hc *grpcHandlerConn) Send(msg any) error {
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (hc *grpcHandlerConn) sendResumeToken(token string) error {
+	if hc.request.Header.Get(headerAcceptResumeToken) == "" {
+		return nil
+	}
+	if !hc.wroteToBody {
+		mergeHeaders(hc.responseWriter.Header(), hc.responseHeader)
+		hc.wroteToBody = true
+	}
+	if err := hc.marshaler.WriteResumeToken(token); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
 func (hc *grpcHandlerConn) ResponseHeader() http.Header {
 	return hc.responseHeader
 }
@@ -76,7 +76,7 @@ func TestGRPCHandlerSender(t *testing.T) {
 	})
 }
 
-func testGRPCHandlerConnMetadata(t *testing.T, conn handlerConnCloser) {
+func testGRPCHandlerConnMetadata(t *testing.T, conn ProtocolHandlerConn) {
 	// Closing the sender shouldn't unpredictably mutate user-visible headers or
 	// trailers.
 	t.Helper()
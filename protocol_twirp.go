@@ -0,0 +1,449 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	twirpPathPrefix       = "/twirp"
+	twirpContentTypeProto = "application/protobuf"
+	twirpContentTypeJSON  = "application/json"
+
+	// Twirp uses different names for some codes, and has two codes of its own.
+	twirpCodeDataLoss  = "dataloss"
+	twirpCodeMalformed = "malformed"
+	twirpCodeBadRoute  = "bad_route"
+)
+
+// TwirpRoute mounts a service's handlers on their Twirp routes, which add
+// a "/twirp" prefix to the path: for example, the Twirp route for
+// "/acme.foo.v1.FooService/Bar" is "/twirp/acme.foo.v1.FooService/Bar". It
+// takes and returns a path and handler, just like generated constructors, so
+// it's easy to serve both routes:
+//
+//	path, handler := foov1connect.NewFooServiceHandler(svc, connect.WithTwirp())
+//	mux.Handle(path, handler)
+//	mux.Handle(connect.TwirpRoute(path, handler))
+//
+// Requests on the Twirp route always use the Twirp protocol, so the handlers
+// must be constructed with [WithTwirp].
+func TwirpRoute(path string, handler http.Handler) (string, http.Handler) {
+	return twirpPathPrefix + path, http.StripPrefix(
+		twirpPathPrefix,
+		http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			ctx := context.WithValue(request.Context(), twirpRouteKey{}, struct{}{})
+			handler.ServeHTTP(responseWriter, request.WithContext(ctx))
+		}),
+	)
+}
+
+type twirpRouteKey struct{}
+
+// isTwirpRoute reports whether the request arrived on a Twirp route.
+func isTwirpRoute(request *http.Request) bool {
+	return request.Context().Value(twirpRouteKey{}) != nil
+}
+
+// protocolTwirp implements Twirp, which is much like the unary half of the
+// Connect protocol: requests are POSTs of a single message, and errors are
+// JSON. Twirp doesn't support streaming, compression, or timeouts.
+type protocolTwirp struct{}
+
+// NewHandler implements protocol, so it must return an interface.
+func (*protocolTwirp) NewHandler(params *ProtocolHandlerParams) ProtocolHandler {
+	contentTypes := make(map[string]struct{})
+	for _, name := range params.codecs.Names() {
+		if contentType := twirpContentTypeFromCodecName(name); contentType != "" {
+			contentTypes[contentType] = struct{}{}
+		}
+	}
+	return &twirpHandler{
+		ProtocolHandlerParams: *params,
+		accept:                contentTypes,
+	}
+}
+
+// NewClient implements protocol, so it must return an interface.
+func (*protocolTwirp) NewClient(params *ProtocolClientParams) (ProtocolClient, error) {
+	if err := validateRequestURL(params.URL); err != nil {
+		return nil, err
+	}
+	if twirpContentTypeFromCodecName(params.Codec.Name()) == "" {
+		return nil, errorf(CodeInternal, "Twirp doesn't support codec %q: use Protobuf or JSON", params.Codec.Name())
+	}
+	return &twirpClient{ProtocolClientParams: *params}, nil
+}
+
+type twirpHandler struct {
+	ProtocolHandlerParams
+
+	accept map[string]struct{}
+}
+
+func (h *twirpHandler) Methods() map[string]struct{} {
+	return map[string]struct{}{http.MethodPost: {}}
+}
+
+func (h *twirpHandler) ContentTypes() map[string]struct{} {
+	return h.accept
+}
+
+func (h *twirpHandler) CanHandlePayload(request *http.Request, contentType string) bool {
+	if !isTwirpRoute(request) {
+		return false
+	}
+	_, ok := h.accept[contentType]
+	return ok
+}
+
+func (*twirpHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+	return request.Context(), nil, nil
+}
+
+func (h *twirpHandler) NewConn(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+) (ProtocolHandlerConn, bool) {
+	contentType := request.Header.Get(headerContentType)
+	responseWriter.Header()[headerContentType] = []string{contentType}
+	codec := h.codecs.Get(twirpCodecFromContentType(contentType)) // handler.go guarantees this is not nil
+	conn := &twirpHandlerConn{
+		spec: h.Spec,
+		peer: Peer{
+			Addr:     request.RemoteAddr,
+			Protocol: ProtocolTwirp,
+		},
+		request:        request,
+		responseWriter: responseWriter,
+		marshaler: connectUnaryMarshaler{
+			writer:       responseWriter,
+			codec:        codec,
+			bufferPool:   h.bufferPool,
+			header:       responseWriter.Header(),
+			sendMaxBytes: h.SendMaxBytes,
+		},
+		unmarshaler: connectUnaryUnmarshaler{
+			reader:       request.Body,
+			codec:        codec,
+			bufferPool:   h.bufferPool,
+			readMaxBytes: h.ReadMaxBytes,
+		},
+		responseTrailer: make(http.Header),
+	}
+	if h.Spec.StreamType != StreamTypeUnary {
+		_ = conn.Close(errorf(CodeUnimplemented, "%s is a streaming procedure: Twirp only supports unary procedures", h.Spec.Procedure))
+		return nil, false
+	}
+	return wrapHandlerConnWithCodedErrors(conn), true
+}
+
+type twirpClient struct {
+	ProtocolClientParams
+}
+
+func (c *twirpClient) Peer() Peer {
+	return newPeerFromURL(c.URL, ProtocolTwirp)
+}
+
+func (c *twirpClient) WriteRequestHeader(_ StreamType, header http.Header) {
+	// We know these header keys are in canonical form, so we can bypass all the
+	// checks in Header.Set.
+	if header.Get(headerUserAgent) == "" {
+		header[headerUserAgent] = []string{connectUserAgent()}
+	}
+	header[headerContentType] = []string{twirpContentTypeFromCodecName(c.Codec.Name())}
+}
+
+func (c *twirpClient) NewConn(
+	ctx context.Context,
+	spec Spec,
+	header http.Header,
+) StreamingClientConn {
+	if spec.StreamType != StreamTypeUnary {
+		return &errorClientConn{
+			spec:   spec,
+			err:    errorf(CodeUnimplemented, "%s is a streaming procedure: Twirp only supports unary procedures", spec.Procedure),
+			header: header,
+		}
+	}
+	// Clients are configured with the procedure's Connect URL, so we insert
+	// the Twirp prefix before the procedure's path.
+	url := strings.TrimSuffix(c.URL, spec.Procedure) + twirpPathPrefix + spec.Procedure
+	duplexCall := newDuplexHTTPCall(ctx, c.HTTPClient, url, spec, header)
+	conn := &twirpClientConn{
+		spec:       spec,
+		peer:       c.Peer(),
+		duplexCall: duplexCall,
+		bufferPool: c.bufferPool,
+		marshaler: connectUnaryMarshaler{
+			writer:       duplexCall,
+			codec:        c.Codec,
+			bufferPool:   c.bufferPool,
+			header:       duplexCall.Header(),
+			sendMaxBytes: c.SendMaxBytes,
+		},
+		unmarshaler: connectUnaryUnmarshaler{
+			reader:       duplexCall,
+			codec:        c.Codec,
+			bufferPool:   c.bufferPool,
+			readMaxBytes: c.ReadMaxBytes,
+		},
+		responseHeader: make(http.Header),
+	}
+	duplexCall.SetValidateResponse(conn.validateResponse)
+	return wrapClientConnWithCodedErrors(conn)
+}
+
+type twirpClientConn struct {
+	spec           Spec
+	peer           Peer
+	duplexCall     *duplexHTTPCall
+	bufferPool     *bufferPool
+	marshaler      connectUnaryMarshaler
+	unmarshaler    connectUnaryUnmarshaler
+	responseHeader http.Header
+}
+
+func (cc *twirpClientConn) Spec() Spec {
+	return cc.spec
+}
+
+func (cc *twirpClientConn) Peer() Peer {
+	return cc.peer
+}
+
+func (cc *twirpClientConn) Send(msg any) error {
+	if err := cc.marshaler.Marshal(msg); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (cc *twirpClientConn) RequestHeader() http.Header {
+	return cc.duplexCall.Header()
+}
+
+func (cc *twirpClientConn) CloseRequest() error {
+	return cc.duplexCall.CloseWrite()
+}
+
+func (cc *twirpClientConn) Receive(msg any) error {
+	cc.duplexCall.BlockUntilResponseReady()
+	if err := cc.unmarshaler.Unmarshal(msg); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (cc *twirpClientConn) ResponseHeader() http.Header {
+	cc.duplexCall.BlockUntilResponseReady()
+	return cc.responseHeader
+}
+
+func (cc *twirpClientConn) ResponseTrailer() http.Header {
+	// Twirp doesn't have trailers.
+	return make(http.Header)
+}
+
+func (cc *twirpClientConn) CloseResponse() error {
+	return cc.duplexCall.CloseRead()
+}
+
+func (cc *twirpClientConn) validateResponse(response *http.Response) *Error {
+	mergeHeaders(cc.responseHeader, response.Header)
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+	unmarshaler := connectUnaryUnmarshaler{
+		reader:     response.Body,
+		bufferPool: cc.bufferPool,
+	}
+	var wireErr twirpWireError
+	if err := unmarshaler.UnmarshalFunc(&wireErr, json.Unmarshal); err != nil || wireErr.Code == "" {
+		return NewError(
+			connectHTTPToCode(response.StatusCode),
+			errors.New(response.Status),
+		)
+	}
+	serverErr := wireErr.asError()
+	mergeHeaders(serverErr.meta, cc.responseHeader)
+	return serverErr
+}
+
+type twirpHandlerConn struct {
+	spec            Spec
+	peer            Peer
+	request         *http.Request
+	responseWriter  http.ResponseWriter
+	marshaler       connectUnaryMarshaler
+	unmarshaler     connectUnaryUnmarshaler
+	responseTrailer http.Header
+	wroteBody       bool
+}
+
+func (hc *twirpHandlerConn) Spec() Spec {
+	return hc.spec
+}
+
+func (hc *twirpHandlerConn) Peer() Peer {
+	return hc.peer
+}
+
+func (hc *twirpHandlerConn) Receive(msg any) error {
+	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (hc *twirpHandlerConn) RequestHeader() http.Header {
+	return hc.request.Header
+}
+
+func (hc *twirpHandlerConn) Send(msg any) error {
+	hc.wroteBody = true
+	hc.writeResponseHeader()
+	if err := hc.marshaler.Marshal(msg); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (hc *twirpHandlerConn) ResponseHeader() http.Header {
+	return hc.responseWriter.Header()
+}
+
+func (hc *twirpHandlerConn) ResponseTrailer() http.Header {
+	return hc.responseTrailer
+}
+
+func (hc *twirpHandlerConn) Close(err error) error {
+	if !hc.wroteBody {
+		hc.writeResponseHeader()
+	}
+	if err == nil {
+		return hc.request.Body.Close()
+	}
+	// Twirp errors always use application/json.
+	hc.responseWriter.Header().Set(headerContentType, twirpContentTypeJSON)
+	hc.responseWriter.WriteHeader(twirpCodeToHTTP(CodeOf(err)))
+	data, marshalErr := json.Marshal(newTwirpWireError(err))
+	if marshalErr != nil {
+		_ = hc.request.Body.Close()
+		return errorf(CodeInternal, "marshal error: %w", err)
+	}
+	if _, writeErr := hc.responseWriter.Write(data); writeErr != nil {
+		_ = hc.request.Body.Close()
+		return writeErr
+	}
+	return hc.request.Body.Close()
+}
+
+// writeResponseHeader sends any trailers as headers, since Twirp doesn't have
+// trailers.
+func (hc *twirpHandlerConn) writeResponseHeader() {
+	mergeHeaders(hc.responseWriter.Header(), hc.responseTrailer)
+}
+
+// twirpWireError is the JSON representation of a Twirp error.
+type twirpWireError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"msg"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+func newTwirpWireError(err error) *twirpWireError {
+	wire := &twirpWireError{
+		Code:    twirpCodeFromCode(CodeOf(err)),
+		Message: err.Error(),
+	}
+	if connectErr, ok := asError(err); ok {
+		wire.Message = connectErr.Message()
+		if len(connectErr.meta) > 0 {
+			wire.Meta = make(map[string]string, len(connectErr.meta))
+			for key, values := range connectErr.meta {
+				if len(values) > 0 {
+					wire.Meta[key] = values[0]
+				}
+			}
+		}
+	}
+	return wire
+}
+
+func (e *twirpWireError) asError() *Error {
+	err := NewError(codeFromTwirpCode(e.Code), errors.New(e.Message))
+	err.wireErr = true
+	for key, value := range e.Meta {
+		err.Meta().Set(key, value)
+	}
+	return err
+}
+
+func twirpCodeFromCode(code Code) string {
+	if code == CodeDataLoss {
+		return twirpCodeDataLoss
+	}
+	return code.String()
+}
+
+func codeFromTwirpCode(twirpCode string) Code {
+	switch twirpCode {
+	case twirpCodeDataLoss:
+		return CodeDataLoss
+	case twirpCodeMalformed:
+		return CodeInvalidArgument
+	case twirpCodeBadRoute:
+		return CodeUnimplemented
+	}
+	var code Code
+	if err := code.UnmarshalText([]byte(twirpCode)); err != nil {
+		return CodeUnknown
+	}
+	return code
+}
+
+func twirpCodeToHTTP(code Code) int {
+	// Twirp uses the same status codes as Connect, except that Unimplemented
+	// is 501 Not Implemented.
+	if code == CodeUnimplemented {
+		return 501
+	}
+	return connectCodeToHTTP(code)
+}
+
+func twirpContentTypeFromCodecName(name string) string {
+	switch name {
+	case codecNameProto:
+		return twirpContentTypeProto
+	case codecNameJSON:
+		return twirpContentTypeJSON
+	default:
+		return ""
+	}
+}
+
+func twirpCodecFromContentType(contentType string) string {
+	if contentType == twirpContentTypeProto {
+		return codecNameProto
+	}
+	return codecNameJSON
+}
@@ -0,0 +1,123 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestTwirp(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	path, handler := pingv1connect_test.NewPingServiceHandler(pingServer{}, connect.WithTwirp())
+	mux.Handle(path, handler)
+	mux.Handle(connect.TwirpRoute(path, handler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	testClient := func(t *testing.T, options ...connect.ClientOption) { //nolint:thelper
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append([]connect.ClientOption{connect.WithTwirp()}, options...)...,
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, int64(42))
+
+		_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1_test.FailRequest{Code: int32(connect.CodeDataLoss)}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDataLoss)
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Message(), errorMessage)
+		assert.Equal(t, connectErr.Meta().Get(handlerHeader), headerValue)
+
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1_test.CountUpRequest{Number: 1}))
+		if err == nil {
+			assert.False(t, stream.Receive())
+			err = stream.Err()
+			_ = stream.Close()
+		}
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+	}
+	t.Run("proto", func(t *testing.T) {
+		t.Parallel()
+		testClient(t)
+	})
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		testClient(t, connect.WithProtoJSON())
+	})
+	t.Run("wire", func(t *testing.T) {
+		t.Parallel()
+		post := func(procedure, body string) *http.Response {
+			t.Helper()
+			request, err := http.NewRequestWithContext(
+				context.Background(),
+				http.MethodPost,
+				server.URL+"/twirp/"+pingv1connect_test.PingServiceName+"/"+procedure,
+				strings.NewReader(body),
+			)
+			assert.Nil(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			response, err := server.Client().Do(request)
+			assert.Nil(t, err)
+			t.Cleanup(func() { _ = response.Body.Close() })
+			return response
+		}
+
+		response := post("Ping", `{"number": "42"}`)
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(string(body), `"number":"42"`))
+
+		response = post("Fail", `{"code": 15}`) // data loss
+		assert.Equal(t, response.StatusCode, http.StatusInternalServerError)
+		var twirpErr struct {
+			Code    string            `json:"code"`
+			Message string            `json:"msg"`
+			Meta    map[string]string `json:"meta"`
+		}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&twirpErr))
+		assert.Equal(t, twirpErr.Code, "dataloss")
+		assert.Equal(t, twirpErr.Message, errorMessage)
+		assert.Equal(t, twirpErr.Meta[handlerHeader], headerValue)
+
+		response = post("CountUp", `{"number": "1"}`)
+		assert.Equal(t, response.StatusCode, http.StatusNotImplemented)
+	})
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		// The Connect route is unaffected.
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithProtoJSON())
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, int64(42))
+	})
+}
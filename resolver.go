@@ -0,0 +1,193 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDNSRefresh  = 30 * time.Second
+	defaultFileRefresh = 5 * time.Second
+)
+
+// A Resolver resolves a target into the network addresses of the endpoints
+// that serve it. Resolvers feed a [Balancer], which picks one of the
+// endpoints for each call.
+type Resolver interface {
+	// Resolve watches the target, calling update with the complete list of
+	// endpoint addresses (in "host:port" form) each time it changes. Resolve
+	// runs in its own goroutine and should return once ctx is done. Resolvers
+	// whose endpoints never change may return as soon as they've called
+	// update.
+	//
+	// When a lookup fails, resolvers should call update with the error rather
+	// than with an empty list: the balancer keeps the last good list of
+	// endpoints, and fails calls with the error until the first lookup
+	// succeeds.
+	Resolve(ctx context.Context, update func(addrs []string, err error))
+}
+
+// NewStaticResolver constructs a [Resolver] for a fixed list of endpoint
+// addresses.
+func NewStaticResolver(addrs ...string) Resolver {
+	return &staticResolver{addrs: addrs}
+}
+
+// NewDNSResolver constructs a [Resolver] that looks up the A and AAAA records
+// for host every refresh interval and combines each address with port. If
+// refresh isn't positive, it defaults to 30 seconds.
+func NewDNSResolver(host, port string, refresh time.Duration) Resolver {
+	if refresh <= 0 {
+		refresh = defaultDNSRefresh
+	}
+	return &pollingResolver{
+		refresh: refresh,
+		lookup: func(ctx context.Context) ([]string, error) {
+			ips, err := net.DefaultResolver.LookupHost(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			addrs := make([]string, len(ips))
+			for i, ip := range ips {
+				addrs[i] = net.JoinHostPort(ip, port)
+			}
+			return addrs, nil
+		},
+	}
+}
+
+// NewDNSSRVResolver constructs a [Resolver] that looks up the
+// _service._proto.name SRV records every refresh interval. Endpoints are
+// ordered by priority, as they are by [net.LookupSRV]. If refresh isn't
+// positive, it defaults to 30 seconds.
+func NewDNSSRVResolver(service, proto, name string, refresh time.Duration) Resolver {
+	if refresh <= 0 {
+		refresh = defaultDNSRefresh
+	}
+	return &pollingResolver{
+		refresh: refresh,
+		lookup: func(ctx context.Context) ([]string, error) {
+			_, records, err := net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+			if err != nil {
+				return nil, err
+			}
+			addrs := make([]string, len(records))
+			for i, record := range records {
+				addrs[i] = net.JoinHostPort(
+					strings.TrimSuffix(record.Target, "."),
+					strconv.Itoa(int(record.Port)),
+				)
+			}
+			return addrs, nil
+		},
+	}
+}
+
+// NewFileResolver constructs a [Resolver] that reads endpoint addresses from
+// a file, one per line, and reloads it every refresh interval. Blank lines and
+// lines starting with "#" are ignored. If refresh isn't positive, it defaults
+// to 5 seconds.
+func NewFileResolver(path string, refresh time.Duration) Resolver {
+	if refresh <= 0 {
+		refresh = defaultFileRefresh
+	}
+	return &pollingResolver{
+		refresh: refresh,
+		lookup: func(context.Context) ([]string, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			var addrs []string
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				addrs = append(addrs, line)
+			}
+			return addrs, scanner.Err()
+		},
+	}
+}
+
+type staticResolver struct {
+	addrs []string
+}
+
+func (r *staticResolver) Resolve(_ context.Context, update func([]string, error)) {
+	update(r.addrs, nil)
+}
+
+// pollingResolver repeats a lookup on an interval, calling update whenever
+// the set of addresses changes. Lookups that find no addresses count as
+// failures: an empty file or DNS answer is far more likely to be a mistake
+// than a backend with no endpoints.
+type pollingResolver struct {
+	refresh time.Duration
+	lookup  func(context.Context) ([]string, error)
+}
+
+func (r *pollingResolver) Resolve(ctx context.Context, update func([]string, error)) {
+	var last []string
+	for {
+		addrs, err := r.lookup(ctx)
+		if err == nil && len(addrs) == 0 {
+			err = errors.New("lookup found no addresses")
+		}
+		if err != nil {
+			update(nil, err)
+		} else if last == nil || !sameAddrs(addrs, last) {
+			update(addrs, nil)
+			last = addrs
+		}
+		timer := time.NewTimer(r.refresh)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// sameAddrs reports whether two lists contain the same addresses, ignoring
+// order. DNS servers often rotate records, which shouldn't count as a change.
+func sameAddrs(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	sortedLeft := append([]string(nil), left...)
+	sortedRight := append([]string(nil), right...)
+	sort.Strings(sortedLeft)
+	sort.Strings(sortedRight)
+	for i := range sortedLeft {
+		if sortedLeft[i] != sortedRight[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	headerResumeToken       = "Resume-Token"
+	headerAcceptResumeToken = "Accept-Resume-Token"
+
+	defaultResumeMaxReconnects = 5
+	defaultResumeMaxDowntime   = 30 * time.Second
+)
+
+// StreamResumptionPolicy configures how a [Client] resumes broken server
+// streams. See [WithStreamResumption].
+type StreamResumptionPolicy struct {
+	// MaxReconnects is the maximum number of times a stream reconnects over
+	// its lifetime. It defaults to 5.
+	MaxReconnects int
+	// MaxDowntime limits the total time a stream spends reconnecting over its
+	// lifetime, including backoff delays. It defaults to 30 seconds.
+	MaxDowntime time.Duration
+	// InitialBackoff is the delay before the first reconnect after a failure.
+	// It defaults to 100ms, and grows exponentially while reconnects keep
+	// failing, up to MaxBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between reconnects. It defaults to 5s.
+	MaxBackoff time.Duration
+	// ResumableCodes are the error codes sent by the server that trigger a
+	// reconnect. They default to just [CodeUnavailable]. Broken connections
+	// always trigger a reconnect, but other errors that didn't come from the
+	// server, like failures to unmarshal a message, never do.
+	ResumableCodes []Code
+}
+
+// streamResumptionPolicy is a StreamResumptionPolicy with defaults applied.
+type streamResumptionPolicy struct {
+	StreamResumptionPolicy
+
+	backoff *retryPolicy // computes delays between reconnects
+}
+
+func newStreamResumptionPolicy(policy StreamResumptionPolicy) *streamResumptionPolicy {
+	if policy.MaxReconnects <= 0 {
+		policy.MaxReconnects = defaultResumeMaxReconnects
+	}
+	if policy.MaxDowntime <= 0 {
+		policy.MaxDowntime = defaultResumeMaxDowntime
+	}
+	backoff := newRetryPolicy(RetryPolicy{
+		MaxAttempts:    policy.MaxReconnects + 1,
+		InitialBackoff: policy.InitialBackoff,
+		MaxBackoff:     policy.MaxBackoff,
+		RetryableCodes: policy.ResumableCodes,
+	})
+	policy.InitialBackoff = backoff.InitialBackoff
+	policy.MaxBackoff = backoff.MaxBackoff
+	return &streamResumptionPolicy{
+		StreamResumptionPolicy: policy,
+		backoff:                backoff,
+	}
+}
+
+// resumable reports whether an error may be resumed from.
+func (p *streamResumptionPolicy) resumable(err error) bool {
+	if err == nil || errors.Is(err, io.EOF) {
+		return false
+	}
+	if connectErr, ok := asError(err); ok && connectErr.wireErr {
+		_, resumable := p.backoff.retryableCodes[connectErr.Code()]
+		return resumable
+	}
+	// The stream broke before the server could send an error.
+	return isTransportError(err)
+}
+
+// isTransportError reports whether an error came from the network while
+// reading the response, rather than from the server or from decoding its
+// messages.
+func isTransportError(err error) bool {
+	if connectErr, ok := asError(err); ok && connectErr.Code() == CodeUnavailable {
+		return true
+	}
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) || isRSTError(err)
+}
+
+// resumeTokenSender is implemented by handler conns for server streams.
+type resumeTokenSender interface {
+	sendResumeToken(token string) error
+}
+
+// resumeTokenReceiver is implemented by client conns for server streams.
+type resumeTokenReceiver interface {
+	// resumeToken returns the token sent with the most recently received
+	// message that had one.
+	resumeToken() string
+}
+
+type resumeTokenSenderKey struct{}
+
+// withResumeTokenSender makes the handler's conn available to ServerStream,
+// even if interceptors wrap it.
+func withResumeTokenSender(ctx context.Context, conn StreamingHandlerConn) context.Context {
+	if sender, ok := conn.(resumeTokenSender); ok {
+		return context.WithValue(ctx, resumeTokenSenderKey{}, sender)
+	}
+	return ctx
+}
+
+func resumeTokenSenderFromContext(ctx context.Context) resumeTokenSender {
+	sender, _ := ctx.Value(resumeTokenSenderKey{}).(resumeTokenSender)
+	return sender
+}
+
+// resumableClientConn is a StreamingClientConn for server streams that
+// transparently reconnects when the stream breaks. If the server has sent any
+// messages, it sends the most recent resume token, so the server can pick up
+// where it left off. Streams that have received messages without resume
+// tokens can't be resumed.
+type resumableClientConn struct {
+	StreamingClientConn
+
+	ctx    context.Context //nolint:containedctx
+	spec   Spec
+	policy *streamResumptionPolicy
+	newRaw func(context.Context, Spec, http.Header) StreamingClientConn
+	header http.Header // headers of the original request
+
+	request       any
+	requestClosed bool
+	received      bool
+	token         string
+	reconnects    int
+	downtime      time.Duration
+}
+
+func newResumableClientConn(
+	ctx context.Context,
+	spec Spec,
+	policy *streamResumptionPolicy,
+	header http.Header,
+	newRaw func(context.Context, Spec, http.Header) StreamingClientConn,
+) *resumableClientConn {
+	header.Set(headerAcceptResumeToken, "1")
+	return &resumableClientConn{
+		StreamingClientConn: newRaw(ctx, spec, header),
+		ctx:                 ctx,
+		spec:                spec,
+		policy:              policy,
+		newRaw:              newRaw,
+		header:              header,
+	}
+}
+
+func (cc *resumableClientConn) Send(msg any) error {
+	// Server streams send a single message, which we keep a copy of in case we
+	// need to reconnect.
+	if protoMessage, ok := msg.(proto.Message); ok {
+		cc.request = proto.Clone(protoMessage)
+	} else {
+		cc.request = msg
+	}
+	return cc.StreamingClientConn.Send(msg)
+}
+
+func (cc *resumableClientConn) CloseRequest() error {
+	cc.requestClosed = true
+	return cc.StreamingClientConn.CloseRequest()
+}
+
+func (cc *resumableClientConn) Receive(msg any) error {
+	err := cc.StreamingClientConn.Receive(msg)
+	if err != nil && cc.canResume(err) {
+		err = cc.resume(msg, err)
+	}
+	if err != nil {
+		return err
+	}
+	cc.received = true
+	if receiver, ok := cc.StreamingClientConn.(resumeTokenReceiver); ok {
+		if token := receiver.resumeToken(); token != "" {
+			cc.token = token
+		}
+	}
+	return nil
+}
+
+func (cc *resumableClientConn) canResume(err error) bool {
+	if !cc.requestClosed || cc.ctx.Err() != nil || !cc.policy.resumable(err) {
+		return false
+	}
+	// Without a token, reconnecting would replay messages the caller has
+	// already seen.
+	return !cc.received || cc.token != ""
+}
+
+// resume reconnects until the stream delivers a message or the policy's
+// limits are reached. If it gives up, it returns the last error.
+func (cc *resumableClientConn) resume(msg any, err error) error {
+	start := time.Now()
+	defer func() { cc.downtime += time.Since(start) }()
+	backoff := cc.policy.backoff.newCall()
+	for cc.reconnects < cc.policy.MaxReconnects && cc.policy.resumable(err) {
+		delay, ok := backoff.nextDelay(err)
+		if !ok {
+			return err
+		}
+		if cc.downtime+time.Since(start)+delay > cc.policy.MaxDowntime {
+			return err
+		}
+		if !cc.wait(delay) {
+			return err
+		}
+		cc.reconnects++
+		err = cc.reconnect(msg)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (cc *resumableClientConn) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-cc.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// reconnect starts a new stream from the most recent resume token, and
+// receives its first message.
+func (cc *resumableClientConn) reconnect(msg any) error {
+	_ = cc.StreamingClientConn.CloseResponse()
+	header := cc.header.Clone()
+	if cc.token != "" {
+		header.Set(headerResumeToken, cc.token)
+	}
+	cc.StreamingClientConn = cc.newRaw(cc.ctx, cc.spec, header)
+	if err := cc.StreamingClientConn.Send(cc.request); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if err := cc.StreamingClientConn.CloseRequest(); err != nil {
+		return err
+	}
+	return cc.StreamingClientConn.Receive(msg)
+}
@@ -0,0 +1,220 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStreamResumption(t *testing.T) {
+	t.Parallel()
+	policy := connect.StreamResumptionPolicy{InitialBackoff: time.Millisecond}
+	count := func(t *testing.T, client pingv1connect_test.PingServiceClient, upTo int64) ([]int64, error) {
+		t.Helper()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1_test.CountUpRequest{Number: upTo}))
+		assert.Nil(t, err)
+		var numbers []int64
+		for stream.Receive() {
+			numbers = append(numbers, stream.Msg().Number)
+		}
+		assert.Nil(t, stream.Close())
+		return numbers, stream.Err()
+	}
+	// resumeBehavior describes how the server breaks streams.
+	type resumeBehavior struct {
+		failAfter int  // messages sent by each failing stream
+		failures  int  // number of streams that fail, or -1 for all of them
+		tokens    bool // send resume tokens
+		abort     bool // break the connection instead of returning an error
+	}
+	// newServer starts a server whose CountUp procedure breaks streams as
+	// described by behavior, and resumes them from the tokens it sent. The
+	// returned function lists the resume token of each stream.
+	newServer := func(t *testing.T, behavior resumeBehavior) (*httptest.Server, func() []string) {
+		t.Helper()
+		var mu sync.Mutex
+		var resumes []string
+		resumed := func(token string) int {
+			mu.Lock()
+			defer mu.Unlock()
+			resumes = append(resumes, token)
+			return len(resumes)
+		}
+		server := newPingServer(t, &pluggablePingServer{
+			countUp: func(ctx context.Context, request *connect.Request[pingv1_test.CountUpRequest], stream *connect.ServerStream[pingv1_test.CountUpResponse]) error {
+				start := int64(1)
+				if token := stream.ResumeToken(); token != "" {
+					last, err := strconv.ParseInt(token, 10, 64)
+					if err != nil {
+						return connect.NewError(connect.CodeInvalidArgument, err)
+					}
+					start = last + 1
+				}
+				streams := resumed(stream.ResumeToken())
+				fail := behavior.failures < 0 || streams <= behavior.failures
+				for number := start; number <= request.Msg.Number; number++ {
+					if fail && number-start == int64(behavior.failAfter) {
+						if behavior.abort {
+							panic(http.ErrAbortHandler) //nolint:forbidigo
+						}
+						return connect.NewError(connect.CodeUnavailable, errors.New("draining"))
+					}
+					var token string
+					if behavior.tokens {
+						token = strconv.FormatInt(number, 10)
+					}
+					if err := stream.SendWithResumeToken(&pingv1_test.CountUpResponse{Number: number}, token); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+		return server, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), resumes...)
+		}
+	}
+	t.Run("unavailable", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{failAfter: 3, failures: 1, tokens: true})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithStreamResumption(policy))
+		numbers, err := count(t, client, 6)
+		assert.Nil(t, err)
+		assert.Equal(t, numbers, []int64{1, 2, 3, 4, 5, 6})
+		assert.Equal(t, resumedFrom(), []string{"", "3"})
+	})
+	t.Run("broken_connection", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{failAfter: 3, failures: 1, tokens: true, abort: true})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithStreamResumption(policy))
+		numbers, err := count(t, client, 6)
+		assert.Nil(t, err)
+		assert.Equal(t, numbers, []int64{1, 2, 3, 4, 5, 6})
+		assert.Equal(t, resumedFrom(), []string{"", "3"})
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{failAfter: 2, failures: 2, tokens: true})
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithGRPC(),
+			connect.WithStreamResumption(policy),
+		)
+		numbers, err := count(t, client, 6)
+		assert.Nil(t, err)
+		assert.Equal(t, numbers, []int64{1, 2, 3, 4, 5, 6})
+		assert.Equal(t, resumedFrom(), []string{"", "2", "4"})
+	})
+	t.Run("without_tokens", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{failAfter: 3, failures: 1})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithStreamResumption(policy))
+		numbers, err := count(t, client, 6)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, numbers, []int64{1, 2, 3})
+		assert.Equal(t, len(resumedFrom()), 1)
+	})
+	t.Run("before_first_message", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{failAfter: 0, failures: 1})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithStreamResumption(policy))
+		numbers, err := count(t, client, 3)
+		assert.Nil(t, err)
+		assert.Equal(t, numbers, []int64{1, 2, 3})
+		assert.Equal(t, resumedFrom(), []string{"", ""})
+	})
+	t.Run("unmarshal_error", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{tokens: true})
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithCodec(failUnmarshalCodec{}),
+			connect.WithStreamResumption(policy),
+		)
+		numbers, err := count(t, client, 3)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.Equal(t, len(numbers), 0)
+		assert.Equal(t, len(resumedFrom()), 1)
+	})
+	t.Run("max_reconnects", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{failAfter: 1, failures: -1, tokens: true})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithStreamResumption(connect.StreamResumptionPolicy{
+			MaxReconnects:  2,
+			InitialBackoff: time.Millisecond,
+		}))
+		numbers, err := count(t, client, 6)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, numbers, []int64{1, 2, 3})
+		assert.Equal(t, resumedFrom(), []string{"", "1", "2"})
+	})
+	t.Run("max_downtime", func(t *testing.T) {
+		t.Parallel()
+		server, resumedFrom := newServer(t, resumeBehavior{failAfter: 1, failures: 1, tokens: true})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithStreamResumption(connect.StreamResumptionPolicy{
+			MaxDowntime:    50 * time.Millisecond,
+			InitialBackoff: time.Second,
+		}))
+		numbers, err := count(t, client, 6)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, numbers, []int64{1})
+		assert.Equal(t, len(resumedFrom()), 1)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		server, _ := newServer(t, resumeBehavior{tokens: true})
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL)
+		numbers, err := count(t, client, 3)
+		assert.Nil(t, err)
+		assert.Equal(t, numbers, []int64{1, 2, 3})
+	})
+}
+
+// failUnmarshalCodec marshals Protobuf messages, but can't unmarshal them.
+type failUnmarshalCodec struct{}
+
+func (failUnmarshalCodec) Name() string {
+	return "proto"
+}
+
+func (failUnmarshalCodec) Marshal(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("not protobuf: %T", message)
+	}
+	return proto.Marshal(protoMessage)
+}
+
+func (failUnmarshalCodec) Unmarshal([]byte, any) error {
+	return errors.New("boom")
+}
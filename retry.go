@@ -0,0 +1,413 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	headerRetryPushback         = "Grpc-Retry-Pushback-Ms"
+	headerPreviousRPCAttempts   = "Grpc-Previous-Rpc-Attempts"
+	defaultRetryInitialBackoff  = 100 * time.Millisecond
+	defaultRetryMaxBackoff      = 5 * time.Second
+	defaultRetryMultiplier      = 2
+	defaultRetryJitter          = 0.2
+	defaultRetryMaxReplayBytes  = 256 * 1024 // 256KiB, like grpc-go
+	retryBudgetMinimumThreshold = 2
+)
+
+// RetryPolicy configures automatic retries for a [Client]. See
+// [WithRetryPolicy].
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the original
+	// call. Values less than 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It defaults to
+	// 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. It defaults to 5s.
+	MaxBackoff time.Duration
+	// BackoffMultiplier is the factor by which the delay grows after each
+	// retry. It defaults to 2.
+	BackoffMultiplier float64
+	// Jitter randomizes each delay by up to this fraction in either direction,
+	// so that clients which failed together don't retry together. It defaults
+	// to 0.2; negative values disable jitter.
+	Jitter float64
+	// RetryableCodes are the error codes that trigger a retry. They default to
+	// just [CodeUnavailable]. Attempts that exceed PerAttemptTimeout are always
+	// retryable.
+	RetryableCodes []Code
+	// PerAttemptTimeout bounds each attempt of a unary call, in addition to any
+	// deadline on the caller's context. Zero means no per-attempt timeout.
+	PerAttemptTimeout time.Duration
+	// Budget, if non-nil, limits retries across all the calls that share it.
+	Budget *RetryBudget
+	// MaxReplayBytes limits the size of the request messages buffered so that
+	// client and server streams can be replayed. Once a stream sends more than
+	// this many bytes, it's no longer retried. It defaults to 256KiB. Streams
+	// of messages that don't implement proto.Message are never replayed.
+	MaxReplayBytes int
+	// IdempotentOnly restricts retries to procedures with an [IdempotencyLevel]
+	// other than [IdempotencyUnknown].
+	IdempotentOnly bool
+}
+
+// A RetryBudget limits retries across many calls, so that retries can't turn
+// an outage into a storm. It works like gRPC's retry throttling: each failed
+// attempt costs a token, each successful call returns tokenRatio tokens, and
+// calls aren't retried while fewer than half of maxTokens remain.
+//
+// Share a single budget between all the clients that call a backend to
+// throttle the retries sent to it. A RetryBudget is safe to use concurrently.
+type RetryBudget struct {
+	mu        sync.Mutex
+	maxTokens float64
+	tokens    float64
+	ratio     float64
+}
+
+// NewRetryBudget constructs a full [RetryBudget]. The gRPC defaults are 10
+// tokens and a ratio of 0.1: at steady state, about one retry per ten
+// successful calls.
+func NewRetryBudget(maxTokens int, tokenRatio float64) *RetryBudget {
+	if maxTokens < retryBudgetMinimumThreshold {
+		maxTokens = retryBudgetMinimumThreshold
+	}
+	return &RetryBudget{
+		maxTokens: float64(maxTokens),
+		tokens:    float64(maxTokens),
+		ratio:     tokenRatio,
+	}
+}
+
+// onFailure records a failed attempt and reports whether retries are still
+// allowed.
+func (b *RetryBudget) onFailure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(b.tokens-1, 0)
+	return b.tokens > b.maxTokens/2
+}
+
+func (b *RetryBudget) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.tokens+b.ratio, b.maxTokens)
+}
+
+// retryPolicy is a RetryPolicy with defaults applied.
+type retryPolicy struct {
+	RetryPolicy
+
+	retryableCodes map[Code]struct{}
+}
+
+func newRetryPolicy(policy RetryPolicy) *retryPolicy {
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.BackoffMultiplier < 1 {
+		policy.BackoffMultiplier = defaultRetryMultiplier
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = defaultRetryJitter
+	} else if policy.Jitter > 1 {
+		policy.Jitter = 1
+	}
+	if policy.MaxReplayBytes <= 0 {
+		policy.MaxReplayBytes = defaultRetryMaxReplayBytes
+	}
+	codes := policy.RetryableCodes
+	if len(codes) == 0 {
+		codes = []Code{CodeUnavailable}
+	}
+	retryable := make(map[Code]struct{}, len(codes))
+	for _, code := range codes {
+		retryable[code] = struct{}{}
+	}
+	return &retryPolicy{
+		RetryPolicy:    policy,
+		retryableCodes: retryable,
+	}
+}
+
+// appliesTo reports whether calls to the procedure may be retried at all.
+func (p *retryPolicy) appliesTo(spec Spec) bool {
+	if p == nil || p.MaxAttempts < 2 {
+		return false
+	}
+	return !p.IdempotentOnly || spec.IdempotencyLevel != IdempotencyUnknown
+}
+
+// newCall starts tracking the attempts of a single call.
+func (p *retryPolicy) newCall() *retryCall {
+	return &retryCall{policy: p, backoff: p.InitialBackoff}
+}
+
+// retryCall tracks the attempts of a single call.
+type retryCall struct {
+	policy   *retryPolicy
+	attempts int // completed attempts
+	backoff  time.Duration
+}
+
+// header returns the request headers for the next attempt.
+func (c *retryCall) header(original http.Header) http.Header {
+	header := original.Clone()
+	if c.attempts > 0 {
+		header[headerPreviousRPCAttempts] = []string{strconv.Itoa(c.attempts)}
+	}
+	return header
+}
+
+// onSuccess records a successful attempt.
+func (c *retryCall) onSuccess() {
+	c.attempts++
+	if budget := c.policy.Budget; budget != nil {
+		budget.onSuccess()
+	}
+}
+
+// retry records a failed attempt, and reports whether the call should be
+// retried. If so, it waits for the backoff delay (or the server's pushback)
+// before returning. Per-attempt timeouts are always retryable.
+func (c *retryCall) retry(ctx context.Context, err error, attemptTimedOut bool) bool {
+	c.attempts++
+	if err == nil || errors.Is(err, io.EOF) || ctx.Err() != nil {
+		return false
+	}
+	_, retryable := c.policy.retryableCodes[CodeOf(err)]
+	if !retryable && !attemptTimedOut {
+		return false
+	}
+	if budget := c.policy.Budget; budget != nil && !budget.onFailure() {
+		return false
+	}
+	if c.attempts >= c.policy.MaxAttempts {
+		return false
+	}
+	delay, ok := c.nextDelay(err)
+	if !ok {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		// The next attempt would start after the caller's deadline.
+		return false
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// nextDelay computes the delay before the next attempt. Servers may override
+// the delay or forbid retries by sending pushback metadata.
+func (c *retryCall) nextDelay(err error) (time.Duration, bool) {
+	if connectErr, ok := asError(err); ok {
+		if pushback := connectErr.Meta().Get(headerRetryPushback); pushback != "" {
+			millis, parseErr := strconv.ParseInt(pushback, 10 /* base */, 64 /* bitsize */)
+			if parseErr != nil || millis < 0 {
+				return 0, false
+			}
+			c.backoff = c.policy.InitialBackoff
+			return time.Duration(millis) * time.Millisecond, true
+		}
+	}
+	delay := c.backoff
+	next := time.Duration(float64(c.backoff) * c.policy.BackoffMultiplier)
+	if next > c.policy.MaxBackoff || next < 0 {
+		next = c.policy.MaxBackoff
+	}
+	c.backoff = next
+	if jitter := c.policy.Jitter; jitter > 0 {
+		//nolint:gosec // jitter doesn't need a cryptographic RNG
+		delay = time.Duration(float64(delay) * (1 + jitter*(2*rand.Float64()-1)))
+	}
+	return delay, true
+}
+
+// callUnaryWithRetry calls a unary procedure until an attempt succeeds or the
+// policy forbids further retries.
+func callUnaryWithRetry(
+	ctx context.Context,
+	policy *retryPolicy,
+	request AnyRequest,
+	callOnce func(context.Context, AnyRequest, http.Header) (AnyResponse, error),
+) (AnyResponse, error) {
+	call := policy.newCall()
+	for {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.PerAttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.PerAttemptTimeout)
+		}
+		response, err := callOnce(attemptCtx, request, call.header(request.Header()))
+		// Only our own per-attempt deadline makes an attempt retryable: a
+		// CodeDeadlineExceeded error from the server may just as well report that
+		// one of its own dependencies timed out.
+		attemptTimedOut := policy.PerAttemptTimeout > 0 && ctx.Err() == nil &&
+			(errors.Is(attemptCtx.Err(), context.DeadlineExceeded) || attemptDeadlinePassed(attemptCtx))
+		cancel()
+		if err == nil {
+			call.onSuccess()
+			return response, nil
+		}
+		if !call.retry(ctx, err, attemptTimedOut) {
+			return nil, err
+		}
+	}
+}
+
+// attemptDeadlinePassed reports whether the attempt's deadline has passed,
+// even if the context's timer hasn't fired yet.
+func attemptDeadlinePassed(attemptCtx context.Context) bool {
+	deadline, ok := attemptCtx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// retryClientConn is a StreamingClientConn for client and server streams
+// that transparently replays the stream if it fails before the server sends
+// any messages. It buffers sent messages up to the policy's MaxReplayBytes.
+// Buffered messages are cloned, so only streams of Protobuf messages can be
+// replayed: callers may reuse other messages after sending them.
+//
+// Callers must not use Send and Receive concurrently, so bidirectional
+// streams are never retried.
+type retryClientConn struct {
+	StreamingClientConn
+
+	ctx    context.Context //nolint:containedctx
+	spec   Spec
+	call   *retryCall
+	newRaw func(context.Context, Spec, http.Header) StreamingClientConn
+	header http.Header // headers of the first attempt
+
+	sent          []any
+	sentBytes     int
+	replayable    bool
+	requestClosed bool
+}
+
+func newRetryClientConn(
+	ctx context.Context,
+	spec Spec,
+	policy *retryPolicy,
+	header http.Header,
+	newRaw func(context.Context, Spec, http.Header) StreamingClientConn,
+) *retryClientConn {
+	return &retryClientConn{
+		StreamingClientConn: newRaw(ctx, spec, header),
+		ctx:                 ctx,
+		spec:                spec,
+		call:                policy.newCall(),
+		newRaw:              newRaw,
+		header:              header,
+		replayable:          true,
+	}
+}
+
+func (cc *retryClientConn) Send(msg any) error {
+	if cc.replayable {
+		cc.buffer(msg)
+	}
+	err := cc.StreamingClientConn.Send(msg)
+	if err != nil && errors.Is(err, io.EOF) && cc.replayable {
+		// The server has already ended this attempt. Keep buffering: Receive
+		// decides whether to replay the stream.
+		return nil
+	}
+	return err
+}
+
+func (cc *retryClientConn) CloseRequest() error {
+	cc.requestClosed = true
+	return cc.StreamingClientConn.CloseRequest()
+}
+
+func (cc *retryClientConn) Receive(msg any) error {
+	err := cc.StreamingClientConn.Receive(msg)
+	for err != nil && cc.replayable && cc.requestClosed {
+		if !cc.call.retry(cc.ctx, err, false /* attemptTimedOut */) {
+			break
+		}
+		err = cc.replay(msg)
+	}
+	if err == nil && cc.replayable {
+		// The server has started responding, so the stream is committed.
+		cc.call.onSuccess()
+		cc.commit()
+	}
+	return err
+}
+
+// replay starts a new attempt, resends the buffered messages, and receives
+// the first response message.
+func (cc *retryClientConn) replay(msg any) error {
+	_ = cc.StreamingClientConn.CloseResponse()
+	cc.StreamingClientConn = cc.newRaw(cc.ctx, cc.spec, cc.call.header(cc.header))
+	for _, sent := range cc.sent {
+		if err := cc.StreamingClientConn.Send(sent); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	if err := cc.StreamingClientConn.CloseRequest(); err != nil {
+		return err
+	}
+	return cc.StreamingClientConn.Receive(msg)
+}
+
+func (cc *retryClientConn) buffer(msg any) {
+	if msg == nil {
+		cc.sent = append(cc.sent, msg)
+		return
+	}
+	protoMessage, ok := msg.(proto.Message)
+	if !ok {
+		// We can't copy the message, and replaying it after the caller has
+		// modified it would send the wrong data.
+		cc.commit()
+		return
+	}
+	cc.sentBytes += proto.Size(protoMessage)
+	if cc.sentBytes > cc.call.policy.MaxReplayBytes {
+		cc.commit()
+		return
+	}
+	cc.sent = append(cc.sent, proto.Clone(protoMessage))
+}
+
+// commit stops buffering: the stream can no longer be replayed.
+func (cc *retryClientConn) commit() {
+	cc.replayable = false
+	cc.sent = nil
+}
@@ -0,0 +1,366 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestRetryPolicyUnary(t *testing.T) {
+	t.Parallel()
+	policy := connect.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+	// newServer starts a server whose Ping procedure fails the first failures
+	// calls with code, and whose Fail procedure fails with the code in the
+	// request. The returned function lists the Grpc-Previous-Rpc-Attempts header
+	// of each call.
+	newServer := func(t *testing.T, failures int, code connect.Code) (*httptest.Server, func() []string) {
+		t.Helper()
+		var mu sync.Mutex
+		var attempts []string
+		record := func(header http.Header) int {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, header.Get("Grpc-Previous-Rpc-Attempts"))
+			return len(attempts)
+		}
+		server := newPingServer(t, &failPingServer{
+			pluggablePingServer: pluggablePingServer{
+				ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+					if record(request.Header()) <= failures {
+						return nil, connect.NewError(code, errors.New("oops"))
+					}
+					return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+				},
+			},
+			fail: func(ctx context.Context, request *connect.Request[pingv1_test.FailRequest]) (*connect.Response[pingv1_test.FailResponse], error) {
+				record(request.Header())
+				return nil, connect.NewError(connect.Code(request.Msg.Code), errors.New("fail"))
+			},
+		})
+		return server, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), attempts...)
+		}
+	}
+	t.Run("eventual_success", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 2, connect.CodeUnavailable)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(policy))
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+		assert.Equal(t, previousAttempts(), []string{"", "1", "2"})
+	})
+	t.Run("max_attempts", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 5, connect.CodeUnavailable)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(policy))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, len(previousAttempts()), 3)
+	})
+	t.Run("not_retryable", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 1, connect.CodeInvalidArgument)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(policy))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.Equal(t, len(previousAttempts()), 1)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 2, connect.CodeUnavailable)
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithGRPC(),
+			connect.WithRetryPolicy(policy),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, len(previousAttempts()), 3)
+	})
+	t.Run("idempotent_only", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 0, 0)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(connect.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			RetryableCodes: []connect.Code{connect.CodeResourceExhausted},
+			IdempotentOnly: true,
+		}))
+		// Fail has side effects, so it isn't retried.
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1_test.FailRequest{
+			Code: int32(connect.CodeResourceExhausted),
+		}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		assert.Equal(t, len(previousAttempts()), 1)
+	})
+}
+
+func TestRetryPolicyPushback(t *testing.T) {
+	t.Parallel()
+	policy := connect.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Hour, // only pushback lets the test finish
+	}
+	// newServer starts a server whose Ping procedure fails the first call with
+	// the given Grpc-Retry-Pushback-Ms, and counts its calls.
+	newServer := func(t *testing.T, pushback string) (*httptest.Server, *atomic.Int64) {
+		t.Helper()
+		var calls atomic.Int64
+		server := newPingServer(t, &pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				if calls.Add(1) > 1 {
+					return connect.NewResponse(&pingv1_test.PingResponse{}), nil
+				}
+				err := connect.NewError(connect.CodeUnavailable, errors.New("oops"))
+				err.Meta().Set("Grpc-Retry-Pushback-Ms", pushback)
+				return nil, err
+			},
+		})
+		return server, &calls
+	}
+	t.Run("delay", func(t *testing.T) {
+		t.Parallel()
+		server, calls := newServer(t, "1")
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(policy))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, calls.Load(), int64(2))
+	})
+	t.Run("forbid", func(t *testing.T) {
+		t.Parallel()
+		server, calls := newServer(t, "-1")
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithGRPC(),
+			connect.WithRetryPolicy(policy),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, calls.Load(), int64(1))
+	})
+}
+
+func TestRetryPolicyPerAttemptTimeout(t *testing.T) {
+	t.Parallel()
+	var attempts int
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+			mu.Lock()
+			attempts++
+			attempt := attempts
+			mu.Unlock()
+			switch {
+			case request.Msg.Text == "timeout" && attempt == 1:
+				// Without a timeout header, the context ends only when the client
+				// gives up on the attempt.
+				<-ctx.Done()
+				return nil, connect.NewError(connect.CodeDeadlineExceeded, ctx.Err())
+			case request.Msg.Text == "downstream":
+				// The server's own dependency timed out: the client's attempt
+				// didn't.
+				return nil, connect.NewError(connect.CodeDeadlineExceeded, errors.New("downstream timeout"))
+			}
+			return connect.NewResponse(&pingv1_test.PingResponse{Number: request.Msg.Number}), nil
+		},
+	}))
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		// Ignore the client's timeout, so the client's own per-attempt deadline
+		// always ends the attempt.
+		request.Header.Del("Connect-Timeout-Ms")
+		mux.ServeHTTP(responseWriter, request)
+	}))
+	t.Cleanup(server.Close)
+	client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(connect.RetryPolicy{
+		MaxAttempts:       2,
+		InitialBackoff:    time.Millisecond,
+		PerAttemptTimeout: 50 * time.Millisecond,
+	}))
+	t.Run("attempt_timeout", func(t *testing.T) {
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1, Text: "timeout"}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 1)
+		mu.Lock()
+		assert.Equal(t, attempts, 2)
+		attempts = 0
+		mu.Unlock()
+	})
+	t.Run("server_deadline_exceeded", func(t *testing.T) {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Text: "downstream"}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		mu.Lock()
+		assert.Equal(t, attempts, 1)
+		mu.Unlock()
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int64
+	server := newPingServer(t, &pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+			calls.Add(1)
+			return nil, connect.NewError(connect.CodeUnavailable, errors.New("oops"))
+		},
+	})
+	client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(connect.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		Budget:         connect.NewRetryBudget(4, 0.1),
+	}))
+	// The budget starts with 4 tokens and allows retries while more than 2
+	// remain, so the first call gets one retry and later calls get none.
+	for i := 0; i < 3; i++ {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	}
+	assert.Equal(t, calls.Load(), int64(4))
+}
+
+func TestRetryPolicyStreams(t *testing.T) {
+	t.Parallel()
+	policy := connect.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+	// newServer starts a server whose Sum and CountUp procedures fail the first
+	// failures calls with CodeUnavailable. The returned function lists the
+	// Grpc-Previous-Rpc-Attempts header of each call.
+	newServer := func(t *testing.T, failures int) (*httptest.Server, func() []string) {
+		t.Helper()
+		var mu sync.Mutex
+		var attempts []string
+		attempt := func(header http.Header) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, header.Get("Grpc-Previous-Rpc-Attempts"))
+			if len(attempts) > failures {
+				return nil
+			}
+			return connect.NewError(connect.CodeUnavailable, errors.New("oops"))
+		}
+		server := newPingServer(t, &pluggablePingServer{
+			sum: func(ctx context.Context, stream *connect.ClientStream[pingv1_test.SumRequest]) (*connect.Response[pingv1_test.SumResponse], error) {
+				var sum int64
+				for stream.Receive() {
+					sum += stream.Msg().Number
+				}
+				if err := stream.Err(); err != nil {
+					return nil, err
+				}
+				if err := attempt(stream.RequestHeader()); err != nil {
+					return nil, err
+				}
+				return connect.NewResponse(&pingv1_test.SumResponse{Sum: sum}), nil
+			},
+			countUp: func(ctx context.Context, request *connect.Request[pingv1_test.CountUpRequest], stream *connect.ServerStream[pingv1_test.CountUpResponse]) error {
+				if err := attempt(request.Header()); err != nil {
+					return err
+				}
+				for i := int64(1); i <= request.Msg.Number; i++ {
+					if err := stream.Send(&pingv1_test.CountUpResponse{Number: i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+		return server, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), attempts...)
+		}
+	}
+	t.Run("client_stream", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 1)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(policy))
+		stream := client.Sum(context.Background())
+		for i := 1; i <= 3; i++ {
+			assert.Nil(t, stream.Send(&pingv1_test.SumRequest{Number: int64(i)}))
+		}
+		response, err := stream.CloseAndReceive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Sum, 6)
+		assert.Equal(t, previousAttempts(), []string{"", "1"})
+	})
+	t.Run("client_stream_too_large", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 1)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(connect.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxReplayBytes: 4,
+		}))
+		stream := client.Sum(context.Background())
+		for i := 1; i <= 3; i++ {
+			_ = stream.Send(&pingv1_test.SumRequest{Number: int64(i)})
+		}
+		_, err := stream.CloseAndReceive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, len(previousAttempts()), 1)
+	})
+	t.Run("server_stream", func(t *testing.T) {
+		t.Parallel()
+		server, previousAttempts := newServer(t, 2)
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithRetryPolicy(policy))
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1_test.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		var got []int64
+		for stream.Receive() {
+			got = append(got, stream.Msg().Number)
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, got, []int64{1, 2, 3})
+		assert.Equal(t, len(previousAttempts()), 3)
+	})
+}
+
+// failPingServer adds a pluggable Fail procedure to pluggablePingServer, so
+// tests can exercise procedures with side effects.
+type failPingServer struct {
+	pluggablePingServer
+
+	fail func(context.Context, *connect.Request[pingv1_test.FailRequest]) (*connect.Response[pingv1_test.FailResponse], error)
+}
+
+func (f *failPingServer) Fail(
+	ctx context.Context,
+	request *connect.Request[pingv1_test.FailRequest],
+) (*connect.Response[pingv1_test.FailResponse], error) {
+	return f.fail(ctx, request)
+}
@@ -0,0 +1,182 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestDefaultTimeoutClient(t *testing.T) {
+	t.Parallel()
+	server := newTimeoutPingServer(t)
+	t.Run("no_deadline", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithDefaultTimeout(time.Minute))
+		remaining, ok := pingRemaining(t, client, 0)
+		assert.True(t, ok)
+		assert.True(t, remaining <= time.Minute)
+		assert.True(t, remaining > 30*time.Second)
+	})
+	t.Run("caller_deadline", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithDefaultTimeout(time.Minute))
+		remaining, ok := pingRemaining(t, client, 2*time.Minute)
+		assert.True(t, ok)
+		assert.True(t, remaining > time.Minute)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithGRPC(),
+			connect.WithDefaultTimeout(time.Minute),
+		)
+		remaining, ok := pingRemaining(t, client, 0)
+		assert.True(t, ok)
+		assert.True(t, remaining <= time.Minute)
+	})
+	t.Run("unset", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL)
+		_, ok := pingRemaining(t, client, 0)
+		assert.False(t, ok)
+	})
+}
+
+func TestDefaultTimeoutHandler(t *testing.T) {
+	t.Parallel()
+	server := newTimeoutPingServer(t, connect.WithDefaultTimeout(time.Minute))
+	client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL)
+	t.Run("no_deadline", func(t *testing.T) {
+		t.Parallel()
+		remaining, ok := pingRemaining(t, client, 0)
+		assert.True(t, ok)
+		assert.True(t, remaining <= time.Minute)
+	})
+	t.Run("client_deadline", func(t *testing.T) {
+		t.Parallel()
+		remaining, ok := pingRemaining(t, client, 2*time.Minute)
+		assert.True(t, ok)
+		assert.True(t, remaining > time.Minute)
+	})
+}
+
+func TestMaxTimeoutHandler(t *testing.T) {
+	t.Parallel()
+	server := newTimeoutPingServer(
+		t,
+		connect.WithDefaultTimeout(2*time.Minute), // clamped by the maximum
+		connect.WithMaxTimeout(time.Minute),
+		connect.WithProcedureOptions(
+			"/"+pingv1connect_test.PingServiceName+"/Sum",
+			connect.WithDefaultTimeout(0),
+			connect.WithMaxTimeout(0),
+		),
+	)
+	client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL)
+	t.Run("no_deadline", func(t *testing.T) {
+		t.Parallel()
+		remaining, ok := pingRemaining(t, client, 0)
+		assert.True(t, ok)
+		assert.True(t, remaining <= time.Minute)
+	})
+	t.Run("long_deadline", func(t *testing.T) {
+		t.Parallel()
+		remaining, ok := pingRemaining(t, client, 2*time.Minute)
+		assert.True(t, ok)
+		assert.True(t, remaining <= time.Minute)
+	})
+	t.Run("short_deadline", func(t *testing.T) {
+		t.Parallel()
+		remaining, ok := pingRemaining(t, client, 10*time.Second)
+		assert.True(t, ok)
+		assert.True(t, remaining <= 10*time.Second)
+	})
+	t.Run("procedure_override", func(t *testing.T) {
+		t.Parallel()
+		stream := client.Sum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1_test.SumRequest{Number: 1}))
+		response, err := stream.CloseAndReceive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Get("Remaining"), "none")
+	})
+}
+
+// newTimeoutPingServer starts a server whose Ping and Sum procedures report
+// the time remaining before their deadline in the Remaining response header.
+func newTimeoutPingServer(tb testing.TB, options ...connect.HandlerOption) *httptest.Server {
+	tb.Helper()
+	remaining := func(ctx context.Context) string {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return "none"
+		}
+		return time.Until(deadline).String()
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+			response := connect.NewResponse(&pingv1_test.PingResponse{})
+			response.Header().Set("Remaining", remaining(ctx))
+			return response, nil
+		},
+		sum: func(ctx context.Context, stream *connect.ClientStream[pingv1_test.SumRequest]) (*connect.Response[pingv1_test.SumResponse], error) {
+			for stream.Receive() {
+			}
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+			response := connect.NewResponse(&pingv1_test.SumResponse{})
+			response.Header().Set("Remaining", remaining(ctx))
+			return response, nil
+		},
+	}, options...))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	tb.Cleanup(server.Close)
+	return server
+}
+
+// pingRemaining calls Ping, with a timeout if it's positive, and returns the
+// time the handler had remaining before its deadline, if it had one.
+func pingRemaining(tb testing.TB, client pingv1connect_test.PingServiceClient, timeout time.Duration) (time.Duration, bool) {
+	tb.Helper()
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	response, err := client.Ping(ctx, connect.NewRequest(&pingv1_test.PingRequest{}))
+	assert.Nil(tb, err)
+	value := response.Header().Get("Remaining")
+	if value == "none" {
+		return 0, false
+	}
+	remaining, err := time.ParseDuration(value)
+	assert.Nil(tb, err)
+	return remaining, true
+}
@@ -0,0 +1,702 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const transcodingContentTypeJSON = "application/json"
+
+// HTTPRule binds a unary procedure to a REST-style HTTP route. It mirrors the
+// google.api.http method option, and protoc-gen-connect-go generates rules
+// from those options.
+//
+// Path is a template, like "/v1/users/{id}" or "/v1/{name=shelves/*}/books":
+// each variable binds one or more path segments to a (possibly nested) field
+// of the request message. Body is the name of the request field populated
+// from the HTTP request body, or "*" to populate the whole message. Unless
+// Body is "*", fields not bound by the path may be set with query parameters,
+// like "?page_size=10&filter.state=ACTIVE". ResponseBody optionally names the
+// response field to send in place of the whole response message.
+type HTTPRule struct {
+	Method       string
+	Path         string
+	Body         string
+	ResponseBody string
+}
+
+// HTTPRoute pairs an HTTPRule with the handler for its procedure, which must
+// have been constructed with [NewUnaryHandler].
+type HTTPRoute struct {
+	Rule    HTTPRule
+	Handler *Handler
+}
+
+// Transcoder serves unary procedures on REST-style HTTP routes. It builds
+// request messages from the URL and JSON request body, calls the handler's
+// implementation as usual (so interceptors, timeouts, and limits all apply),
+// and writes the response message as JSON. Errors are written as JSON objects
+// like those of the Connect protocol, with an HTTP status derived from the
+// error's Code. Request messages must implement [proto.Message].
+//
+// Generated code includes a constructor for the routes declared with
+// google.api.http options:
+//
+//	transcoder := connect.NewTranscoder(pingv1connect.NewPingServiceHTTPRoutes(svc)...)
+//	mux.Handle("/v1/", transcoder)
+//
+// Routes are matched in the order they're added. Transcoder is safe to use
+// concurrently.
+type Transcoder struct {
+	mu     sync.RWMutex
+	routes []*transcodingRoute
+}
+
+// NewTranscoder constructs a Transcoder that serves the supplied routes.
+func NewTranscoder(routes ...HTTPRoute) *Transcoder {
+	transcoder := &Transcoder{}
+	transcoder.Handle(routes...)
+	return transcoder
+}
+
+// Handle adds routes to the transcoder. It panics if a route's path template
+// is invalid or if its handler isn't unary.
+func (t *Transcoder) Handle(routes ...HTTPRoute) {
+	compiled := make([]*transcodingRoute, 0, len(routes))
+	for _, route := range routes {
+		compiled = append(compiled, newTranscodingRoute(route))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, compiled...)
+}
+
+// ServeHTTP implements [http.Handler].
+func (t *Transcoder) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	t.mu.RLock()
+	routes := t.routes
+	t.mu.RUnlock()
+
+	var allow []string
+	if segments, ok := splitTranscodingPath(request.URL.EscapedPath()); ok {
+		for _, route := range routes {
+			values, ok := route.template.match(segments)
+			if !ok {
+				continue
+			}
+			if route.method != request.Method {
+				allow = append(allow, route.method)
+				continue
+			}
+			route.handler.serve(responseWriter, request, &transcodingHandler{
+				ProtocolHandlerParams: route.handler.transcoding,
+				route:                 route,
+				values:                values,
+			})
+			return
+		}
+	}
+	if len(allow) > 0 {
+		responseWriter.Header().Set("Allow", sortedUniqueValue(allow))
+		_ = writeTranscodingError(responseWriter, http.StatusMethodNotAllowed, errorf(
+			CodeUnimplemented, "%s doesn't support %s", request.URL.Path, request.Method,
+		))
+		return
+	}
+	_ = writeTranscodingError(responseWriter, connectCodeToHTTP(CodeUnimplemented), errorf(
+		CodeUnimplemented, "no route for %s %s", request.Method, request.URL.Path,
+	))
+}
+
+type transcodingRoute struct {
+	method       string
+	template     *pathTemplate
+	body         string
+	responseBody string
+	handler      *Handler
+}
+
+func newTranscodingRoute(route HTTPRoute) *transcodingRoute {
+	rule := route.Rule
+	if route.Handler == nil || route.Handler.transcoding == nil {
+		panic(fmt.Sprintf("connect: can't transcode %s %s: HTTP routes require unary handlers", rule.Method, rule.Path)) //nolint:forbidigo
+	}
+	if rule.Method == "" {
+		panic("connect: HTTP route for " + rule.Path + " has no method") //nolint:forbidigo
+	}
+	template, err := parsePathTemplate(rule.Path)
+	if err != nil {
+		panic(fmt.Sprintf("connect: invalid path template %q: %v", rule.Path, err)) //nolint:forbidigo
+	}
+	return &transcodingRoute{
+		method:       rule.Method,
+		template:     template,
+		body:         rule.Body,
+		responseBody: rule.ResponseBody,
+		handler:      route.Handler,
+	}
+}
+
+// transcodingHandler is a ProtocolHandler for a single request on a
+// transcoded route. Unlike the RPC protocols, it's chosen by route rather
+// than by Content-Type.
+type transcodingHandler struct {
+	*ProtocolHandlerParams
+
+	route  *transcodingRoute
+	values []string // path variables, in template order
+}
+
+func (h *transcodingHandler) Methods() map[string]struct{} {
+	return map[string]struct{}{h.route.method: {}}
+}
+
+func (h *transcodingHandler) ContentTypes() map[string]struct{} {
+	return map[string]struct{}{transcodingContentTypeJSON: {}}
+}
+
+func (h *transcodingHandler) CanHandlePayload(*http.Request, string) bool {
+	return true
+}
+
+func (*transcodingHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+	return request.Context(), nil, nil
+}
+
+func (h *transcodingHandler) NewConn(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+) (ProtocolHandlerConn, bool) {
+	if contentType := request.Header.Get(headerContentType); h.route.body != "" && contentType != "" {
+		if base, _, _ := mime.ParseMediaType(contentType); base != transcodingContentTypeJSON {
+			_ = writeTranscodingError(responseWriter, http.StatusUnsupportedMediaType, errorf(
+				CodeInvalidArgument, "unsupported content type %q: use %s", contentType, transcodingContentTypeJSON,
+			))
+			return nil, false
+		}
+	}
+	codec := h.codecs.Get(codecNameJSON)
+	if codec == nil {
+		codec = &protoJSONCodec{name: codecNameJSON}
+	}
+	responseCodec := codec
+	if h.route.responseBody != "" {
+		responseCodec = &responseBodyCodec{Codec: codec, field: h.route.responseBody}
+	}
+	responseWriter.Header()[headerContentType] = []string{transcodingContentTypeJSON}
+	conn := &transcodingHandlerConn{
+		spec: h.Spec,
+		peer: Peer{
+			Addr:     request.RemoteAddr,
+			Protocol: ProtocolHTTPJSON,
+		},
+		route:          h.route,
+		values:         h.values,
+		codec:          codec,
+		request:        request,
+		responseWriter: responseWriter,
+		marshaler: connectUnaryMarshaler{
+			writer:       responseWriter,
+			codec:        responseCodec,
+			bufferPool:   h.bufferPool,
+			header:       responseWriter.Header(),
+			sendMaxBytes: h.SendMaxBytes,
+		},
+		unmarshaler: connectUnaryUnmarshaler{
+			reader:       request.Body,
+			codec:        codec,
+			bufferPool:   h.bufferPool,
+			readMaxBytes: h.ReadMaxBytes,
+		},
+		responseTrailer: make(http.Header),
+	}
+	return wrapHandlerConnWithCodedErrors(conn), true
+}
+
+type transcodingHandlerConn struct {
+	spec            Spec
+	peer            Peer
+	route           *transcodingRoute
+	values          []string
+	codec           Codec
+	request         *http.Request
+	responseWriter  http.ResponseWriter
+	marshaler       connectUnaryMarshaler
+	unmarshaler     connectUnaryUnmarshaler
+	responseTrailer http.Header
+	received        bool
+	wroteBody       bool
+}
+
+func (hc *transcodingHandlerConn) Spec() Spec {
+	return hc.spec
+}
+
+func (hc *transcodingHandlerConn) Peer() Peer {
+	return hc.peer
+}
+
+// Receive populates the request message from the body, the query string, and
+// the path, in that order: later sources overwrite earlier ones.
+func (hc *transcodingHandlerConn) Receive(msg any) error {
+	if hc.received {
+		return NewError(CodeInternal, io.EOF)
+	}
+	hc.received = true
+	protoMessage, ok := msg.(proto.Message)
+	if !ok {
+		return errorf(CodeInternal, "can't transcode into %T: %w", msg, errNotProto(msg))
+	}
+	switch hc.route.body {
+	case "":
+	case "*":
+		if err := hc.unmarshaler.UnmarshalFunc(msg, hc.unmarshalBody); err != nil {
+			return err
+		}
+	default:
+		if err := hc.unmarshaler.UnmarshalFunc(msg, hc.unmarshalBodyField); err != nil {
+			return err
+		}
+	}
+	if err := hc.bindParameters(protoMessage); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (hc *transcodingHandlerConn) RequestHeader() http.Header {
+	return hc.request.Header
+}
+
+func (hc *transcodingHandlerConn) Send(msg any) error {
+	hc.wroteBody = true
+	hc.writeResponseHeader(nil /* error */)
+	if err := hc.marshaler.Marshal(msg); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (hc *transcodingHandlerConn) ResponseHeader() http.Header {
+	return hc.responseWriter.Header()
+}
+
+func (hc *transcodingHandlerConn) ResponseTrailer() http.Header {
+	return hc.responseTrailer
+}
+
+func (hc *transcodingHandlerConn) Close(err error) error {
+	if !hc.wroteBody {
+		hc.writeResponseHeader(err)
+	}
+	if err == nil {
+		return hc.request.Body.Close()
+	}
+	if writeErr := writeTranscodingError(hc.responseWriter, connectCodeToHTTP(CodeOf(err)), err); writeErr != nil {
+		_ = hc.request.Body.Close()
+		return writeErr
+	}
+	return hc.request.Body.Close()
+}
+
+// writeResponseHeader sends any trailers as headers, since REST clients
+// rarely read trailers.
+func (hc *transcodingHandlerConn) writeResponseHeader(err error) {
+	header := hc.responseWriter.Header()
+	if err != nil {
+		if connectErr, ok := asError(err); ok {
+			mergeHeaders(header, connectErr.meta)
+		}
+	}
+	mergeHeaders(header, hc.responseTrailer)
+}
+
+// unmarshalBody populates the whole message from the request body. Since the
+// body is often optional, an empty body leaves the message untouched.
+func (hc *transcodingHandlerConn) unmarshalBody(data []byte, msg any) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return hc.codec.Unmarshal(data, msg)
+}
+
+// unmarshalBodyField populates a single field from the request body.
+func (hc *transcodingHandlerConn) unmarshalBodyField(data []byte, msg any) error {
+	if len(data) == 0 {
+		return nil
+	}
+	protoMessage, _ := msg.(proto.Message) // Receive guarantees this succeeds
+	field := findTranscodingField(protoMessage.ProtoReflect().Descriptor(), hc.route.body)
+	if field == nil {
+		return fmt.Errorf("no field %q", hc.route.body)
+	}
+	// Wrap the body in an object, so the codec handles every kind of field.
+	wrapped := make([]byte, 0, len(data)+len(field.Name())+5)
+	wrapped = append(wrapped, `{"`...)
+	wrapped = append(wrapped, field.Name()...)
+	wrapped = append(wrapped, `":`...)
+	wrapped = append(wrapped, data...)
+	wrapped = append(wrapped, '}')
+	return mergeTranscodedJSON(hc.codec, protoMessage, wrapped)
+}
+
+// bindParameters populates the message from the query string (unless the body
+// populates the whole message) and the path variables.
+func (hc *transcodingHandlerConn) bindParameters(msg proto.Message) *Error {
+	descriptor := msg.ProtoReflect().Descriptor()
+	object := make(map[string]any)
+	if hc.route.body != "*" {
+		for key, values := range hc.request.URL.Query() {
+			if err := setTranscodingParameter(object, descriptor, strings.Split(key, "."), values); err != nil {
+				return err
+			}
+		}
+	}
+	for i, variable := range hc.route.template.variables {
+		if err := setTranscodingParameter(object, descriptor, variable.fieldPath, hc.values[i:i+1]); err != nil {
+			return err
+		}
+	}
+	if len(object) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return errorf(CodeInternal, "marshal parameters: %w", err)
+	}
+	if err := mergeTranscodedJSON(hc.codec, msg, data); err != nil {
+		return errorf(CodeInvalidArgument, "unmarshal parameters into %T: %w", msg, err)
+	}
+	return nil
+}
+
+// responseBodyCodec marshals a single field of response messages, for rules
+// with a ResponseBody.
+type responseBodyCodec struct {
+	Codec
+
+	field string
+}
+
+func (c *responseBodyCodec) Marshal(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, errNotProto(message)
+	}
+	reflectMessage := protoMessage.ProtoReflect()
+	field := findTranscodingField(reflectMessage.Descriptor(), c.field)
+	if field == nil {
+		return nil, fmt.Errorf("%s has no field %q", reflectMessage.Descriptor().FullName(), c.field)
+	}
+	if field.Message() != nil && !field.IsList() && !field.IsMap() {
+		return c.Codec.Marshal(reflectMessage.Get(field).Message().Interface())
+	}
+	// For other fields, marshal a message with only this field set and extract
+	// its JSON. Emitting unpopulated fields ensures that it's present.
+	only := reflectMessage.New()
+	only.Set(field, reflectMessage.Get(field))
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(only.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	return object[field.JSONName()], nil
+}
+
+// setTranscodingParameter adds a path variable or query parameter to a JSON
+// object that mirrors the request message.
+func setTranscodingParameter(
+	object map[string]any,
+	descriptor protoreflect.MessageDescriptor,
+	fieldPath []string,
+	values []string,
+) *Error {
+	for i, name := range fieldPath {
+		field := findTranscodingField(descriptor, name)
+		if field == nil {
+			return errorf(CodeInvalidArgument, "%s has no field %q", descriptor.FullName(), strings.Join(fieldPath[:i+1], "."))
+		}
+		key := string(field.Name())
+		if i == len(fieldPath)-1 {
+			return setTranscodingValue(object, key, field, values)
+		}
+		if field.Message() == nil || field.IsList() || field.IsMap() {
+			return errorf(CodeInvalidArgument, "field %q isn't a singular message", strings.Join(fieldPath[:i+1], "."))
+		}
+		child, ok := object[key].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			object[key] = child
+		}
+		object = child
+		descriptor = field.Message()
+	}
+	return nil
+}
+
+func setTranscodingValue(object map[string]any, key string, field protoreflect.FieldDescriptor, values []string) *Error {
+	if field.IsMap() {
+		return errorf(CodeInvalidArgument, "can't bind map field %q to a parameter", field.FullName())
+	}
+	literals := make([]any, len(values))
+	for i, value := range values {
+		literal, err := transcodingLiteral(field, value)
+		if err != nil {
+			return errorf(CodeInvalidArgument, "invalid value %q for field %q: %w", value, field.FullName(), err)
+		}
+		literals[i] = literal
+	}
+	if field.IsList() {
+		object[key] = literals
+		return nil
+	}
+	if len(literals) != 1 {
+		return errorf(CodeInvalidArgument, "field %q isn't repeated, but has %d values", field.FullName(), len(literals))
+	}
+	object[key] = literals[0]
+	return nil
+}
+
+// transcodingLiteral converts a parameter to JSON. The JSON mapping accepts
+// strings for most kinds of fields, including numbers and well-known types
+// like Timestamp, so only booleans and enum numbers need special treatment.
+func transcodingLiteral(field protoreflect.FieldDescriptor, value string) (any, error) {
+	switch {
+	case field.Kind() == protoreflect.BoolKind,
+		field.Message() != nil && field.Message().FullName() == "google.protobuf.BoolValue":
+		return strconv.ParseBool(value)
+	case field.Kind() == protoreflect.EnumKind:
+		if _, err := strconv.ParseInt(value, 10, 32); err == nil {
+			return json.Number(value), nil
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+// findTranscodingField looks up a field by its Protobuf or JSON name.
+func findTranscodingField(descriptor protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := descriptor.Fields()
+	if field := fields.ByName(protoreflect.Name(name)); field != nil {
+		return field
+	}
+	return fields.ByJSONName(name)
+}
+
+// mergeTranscodedJSON unmarshals JSON into a new message and merges it into
+// msg, so that each source of data only sets the fields it mentions.
+func mergeTranscodedJSON(codec Codec, msg proto.Message, data []byte) error {
+	partial := msg.ProtoReflect().New().Interface()
+	if err := codec.Unmarshal(data, partial); err != nil {
+		return err
+	}
+	proto.Merge(msg, partial)
+	return nil
+}
+
+// writeTranscodingError writes an error as JSON, in the same format as the
+// Connect protocol's unary errors.
+func writeTranscodingError(responseWriter http.ResponseWriter, status int, err error) error {
+	header := responseWriter.Header()
+	header.Set(headerContentType, transcodingContentTypeJSON)
+	responseWriter.WriteHeader(status)
+	data, marshalErr := json.Marshal(newConnectWireError(err))
+	if marshalErr != nil {
+		return errorf(CodeInternal, "marshal error: %w", err)
+	}
+	_, writeErr := responseWriter.Write(data)
+	return writeErr
+}
+
+// splitTranscodingPath splits a URL path into unescaped segments.
+func splitTranscodingPath(escapedPath string) ([]string, bool) {
+	if !strings.HasPrefix(escapedPath, "/") {
+		return nil, false
+	}
+	if escapedPath == "/" {
+		return nil, true
+	}
+	segments := strings.Split(escapedPath[1:], "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, false
+		}
+		segments[i] = unescaped
+	}
+	return segments, true
+}
+
+func sortedUniqueValue(values []string) string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return strings.Join(unique, ", ")
+}
+
+// pathTemplate is a parsed google.api.http path template, which has the
+// following syntax:
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	FieldPath = IDENT { "." IDENT } ;
+//	Verb     = ":" LITERAL ;
+//
+// "*" matches a single path segment, and "**" matches zero or more segments
+// at the end of the path. A variable without segments matches a single path
+// segment.
+type pathTemplate struct {
+	segments  []string // literals, "*", or "**"
+	verb      string
+	variables []pathVariable
+}
+
+type pathVariable struct {
+	fieldPath  []string
+	start, end int // half-open range of segments
+}
+
+func parsePathTemplate(template string) (*pathTemplate, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, errors.New("must begin with a slash")
+	}
+	parsed := &pathTemplate{}
+	rest := template[1:]
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 && !strings.ContainsAny(rest[i:], "/}") {
+		parsed.verb = rest[i+1:]
+		rest = rest[:i]
+		if parsed.verb == "" {
+			return nil, errors.New("empty verb")
+		}
+	}
+	if rest == "" {
+		return parsed, nil
+	}
+	var variable *pathVariable
+	for _, segment := range strings.Split(rest, "/") {
+		if strings.HasPrefix(segment, "{") {
+			if variable != nil {
+				return nil, errors.New("variables can't be nested")
+			}
+			name, pattern, hasPattern := strings.Cut(segment[1:], "=")
+			if !hasPattern {
+				if !strings.HasSuffix(name, "}") {
+					return nil, fmt.Errorf("variable %q must match whole segments", segment)
+				}
+				// {name} is shorthand for {name=*}.
+				name, pattern = strings.TrimSuffix(name, "}"), "*}"
+			}
+			fieldPath := strings.Split(name, ".")
+			for _, part := range fieldPath {
+				if part == "" {
+					return nil, fmt.Errorf("invalid field path %q", name)
+				}
+			}
+			variable = &pathVariable{fieldPath: fieldPath, start: len(parsed.segments)}
+			segment = pattern
+		}
+		closesVariable := variable != nil && strings.HasSuffix(segment, "}")
+		segment = strings.TrimSuffix(segment, "}")
+		if segment == "" || strings.ContainsAny(segment, "{}") ||
+			(strings.Contains(segment, "*") && segment != "*" && segment != "**") {
+			return nil, fmt.Errorf("invalid segment %q", segment)
+		}
+		parsed.segments = append(parsed.segments, segment)
+		if closesVariable {
+			variable.end = len(parsed.segments)
+			parsed.variables = append(parsed.variables, *variable)
+			variable = nil
+		}
+	}
+	if variable != nil {
+		return nil, errors.New("unterminated variable")
+	}
+	for i, segment := range parsed.segments {
+		if segment == "**" && i != len(parsed.segments)-1 {
+			return nil, errors.New(`"**" must be the last segment`)
+		}
+	}
+	return parsed, nil
+}
+
+// match reports whether the template matches the (unescaped) path segments,
+// and returns the value of each variable.
+func (t *pathTemplate) match(segments []string) ([]string, bool) {
+	if t.verb != "" {
+		if len(segments) == 0 || !strings.HasSuffix(segments[len(segments)-1], ":"+t.verb) {
+			return nil, false
+		}
+		trimmed := make([]string, len(segments))
+		copy(trimmed, segments)
+		trimmed[len(trimmed)-1] = strings.TrimSuffix(trimmed[len(trimmed)-1], ":"+t.verb)
+		segments = trimmed
+	}
+	count := len(t.segments)
+	matchesRest := count > 0 && t.segments[count-1] == "**"
+	if matchesRest && len(segments) < count-1 {
+		return nil, false
+	}
+	if !matchesRest && len(segments) != count {
+		return nil, false
+	}
+	for i, segment := range t.segments {
+		switch segment {
+		case "**":
+		case "*":
+			if segments[i] == "" {
+				return nil, false
+			}
+		default:
+			if segments[i] != segment {
+				return nil, false
+			}
+		}
+	}
+	values := make([]string, len(t.variables))
+	for i, variable := range t.variables {
+		end := variable.end
+		if matchesRest && end == count {
+			end = len(segments)
+		}
+		values[i] = strings.Join(segments[variable.start:end], "/")
+	}
+	return values, true
+}
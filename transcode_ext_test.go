@@ -0,0 +1,199 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestTranscoder(t *testing.T) {
+	t.Parallel()
+	ping := connect.NewUnaryHandler(
+		"/"+pingv1connect_test.PingServiceName+"/Ping",
+		pingServer{}.Ping,
+	)
+	fail := connect.NewUnaryHandler(
+		"/"+pingv1connect_test.PingServiceName+"/Fail",
+		pingServer{}.Fail,
+	)
+	transcoder := connect.NewTranscoder(
+		connect.HTTPRoute{
+			Rule:    connect.HTTPRule{Method: http.MethodGet, Path: "/v1/ping/{number}"},
+			Handler: ping,
+		},
+		connect.HTTPRoute{
+			Rule:    connect.HTTPRule{Method: http.MethodPost, Path: "/v1/ping", Body: "*"},
+			Handler: ping,
+		},
+		connect.HTTPRoute{
+			Rule:    connect.HTTPRule{Method: http.MethodPut, Path: "/v1/ping/{number}/text", Body: "text"},
+			Handler: ping,
+		},
+		connect.HTTPRoute{
+			Rule:    connect.HTTPRule{Method: http.MethodGet, Path: "/v1/{text=echo/**}:echo", ResponseBody: "text"},
+			Handler: ping,
+		},
+		connect.HTTPRoute{
+			Rule:    connect.HTTPRule{Method: http.MethodPost, Path: "/v1/fail", Body: "*"},
+			Handler: fail,
+		},
+	)
+	server := httptest.NewServer(transcoder)
+	t.Cleanup(server.Close)
+
+	do := func(t *testing.T, method, path, body string) (*http.Response, []byte) {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			method,
+			server.URL+path,
+			strings.NewReader(body),
+		)
+		assert.Nil(t, err)
+		if body != "" {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		return response, data
+	}
+	expectPing := func(t *testing.T, response *http.Response, body []byte, expect *pingv1_test.PingResponse) {
+		t.Helper()
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, response.Header.Get(handlerHeader), headerValue)
+		assert.Equal(t, response.Header.Get(handlerTrailer), trailerValue)
+		var msg pingv1_test.PingResponse
+		assert.Nil(t, protojson.Unmarshal(body, &msg))
+		assert.Equal(t, msg.Number, expect.Number)
+		assert.Equal(t, msg.Text, expect.Text)
+	}
+	expectError := func(t *testing.T, response *http.Response, body []byte, status int, code connect.Code) {
+		t.Helper()
+		assert.Equal(t, response.StatusCode, status)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		var wireErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		assert.Nil(t, json.Unmarshal(body, &wireErr))
+		assert.Equal(t, wireErr.Code, code.String())
+	}
+
+	t.Run("path_and_query", func(t *testing.T) {
+		t.Parallel()
+		response, body := do(t, http.MethodGet, "/v1/ping/42?text=hello%20world", "")
+		expectPing(t, response, body, &pingv1_test.PingResponse{Number: 42, Text: "hello world"})
+	})
+	t.Run("body", func(t *testing.T) {
+		t.Parallel()
+		response, body := do(t, http.MethodPost, "/v1/ping", `{"number": "7", "text": "hi"}`)
+		expectPing(t, response, body, &pingv1_test.PingResponse{Number: 7, Text: "hi"})
+	})
+	t.Run("body_field", func(t *testing.T) {
+		t.Parallel()
+		response, body := do(t, http.MethodPut, "/v1/ping/3/text", `"hello"`)
+		expectPing(t, response, body, &pingv1_test.PingResponse{Number: 3, Text: "hello"})
+	})
+	t.Run("response_body", func(t *testing.T) {
+		t.Parallel()
+		response, body := do(t, http.MethodGet, "/v1/echo/a/b:echo", "")
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		var text string
+		assert.Nil(t, json.Unmarshal(body, &text))
+		assert.Equal(t, text, "echo/a/b")
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		response, body := do(t, http.MethodPost, "/v1/fail", `{"code": 5}`)
+		expectError(t, response, body, http.StatusNotFound, connect.CodeNotFound)
+		assert.Equal(t, response.Header.Get(handlerHeader), headerValue)
+		assert.True(t, strings.Contains(string(body), errorMessage))
+	})
+	t.Run("invalid_parameter", func(t *testing.T) {
+		t.Parallel()
+		response, body := do(t, http.MethodGet, "/v1/ping/forty-two", "")
+		expectError(t, response, body, http.StatusBadRequest, connect.CodeInvalidArgument)
+		response, body = do(t, http.MethodGet, "/v1/ping/42?color=blue", "")
+		expectError(t, response, body, http.StatusBadRequest, connect.CodeInvalidArgument)
+	})
+	t.Run("unsupported_content_type", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/v1/ping",
+			strings.NewReader("number=1"),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusUnsupportedMediaType)
+	})
+	t.Run("no_route", func(t *testing.T) {
+		t.Parallel()
+		response, body := do(t, http.MethodGet, "/v1/pong/1", "")
+		expectError(t, response, body, http.StatusNotFound, connect.CodeUnimplemented)
+		response, body = do(t, http.MethodDelete, "/v1/ping/1", "")
+		expectError(t, response, body, http.StatusMethodNotAllowed, connect.CodeUnimplemented)
+		assert.Equal(t, response.Header.Get("Allow"), http.MethodGet)
+	})
+}
+
+func TestTranscoderInvalidRoutes(t *testing.T) {
+	t.Parallel()
+	ping := connect.NewUnaryHandler(
+		"/"+pingv1connect_test.PingServiceName+"/Ping",
+		pingServer{}.Ping,
+	)
+	countUp := connect.NewServerStreamHandler(
+		"/"+pingv1connect_test.PingServiceName+"/CountUp",
+		pingServer{}.CountUp,
+	)
+	expectPanic := func(t *testing.T, route connect.HTTPRoute) {
+		t.Helper()
+		defer func() {
+			assert.NotNil(t, recover())
+		}()
+		connect.NewTranscoder(route)
+	}
+	expectPanic(t, connect.HTTPRoute{
+		Rule:    connect.HTTPRule{Method: http.MethodGet, Path: "/v1/count/{number}"},
+		Handler: countUp,
+	})
+	for _, path := range []string{"v1/ping", "/v1/{number", "/v1/**/ping", "/v1/{a={b}}", "/v1/ping:"} {
+		expectPanic(t, connect.HTTPRoute{
+			Rule:    connect.HTTPRule{Method: http.MethodGet, Path: path},
+			Handler: ping,
+		})
+	}
+}
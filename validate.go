@@ -0,0 +1,275 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// A Validator checks messages. Validators receive pointers to messages, as
+// passed to Send and Receive. To reject a message, return an error: usually a
+// [*ValidationError] describing each invalid field. Validators must be safe
+// to call concurrently.
+type Validator interface {
+	Validate(msg any) error
+}
+
+// ValidatorFunc is a simple [Validator] implementation.
+type ValidatorFunc func(msg any) error
+
+// Validate implements [Validator].
+func (f ValidatorFunc) Validate(msg any) error {
+	return f(msg)
+}
+
+// FieldViolation describes one invalid field of a message.
+type FieldViolation struct {
+	// Field is the path to the invalid field, for example "address.zip_code".
+	Field string
+	// Description explains why the field is invalid.
+	Description string
+}
+
+// ValidationError is an error describing the invalid fields of a message.
+// When a [Validator] returns an error wrapping a ValidationError, the
+// resulting [*Error] has a google.rpc.BadRequest [ErrorDetail] listing the
+// field violations.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	if len(e.Violations) == 0 {
+		return "invalid message"
+	}
+	violations := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		violations[i] = violation.Field + ": " + violation.Description
+	}
+	return "invalid message: " + strings.Join(violations, "; ")
+}
+
+// selfValidator calls the messages' own Validate methods, as generated by
+// plugins like protoc-gen-validate. Messages without one are always valid.
+type selfValidator struct{}
+
+func (selfValidator) Validate(msg any) error {
+	if validatable, ok := msg.(interface{ Validate() error }); ok {
+		return validatable.Validate()
+	}
+	return nil
+}
+
+// validateMessage runs the validators on a message, stopping at the first
+// error, and converts the error to an *Error.
+func validateMessage(validators []Validator, msg any) error {
+	for _, validator := range validators {
+		if err := validator.Validate(msg); err != nil {
+			return newValidationError(err)
+		}
+	}
+	return nil
+}
+
+// newValidationError converts a validator's error to an *Error. Validators
+// returning an *Error choose their own code and details.
+func newValidationError(err error) *Error {
+	if connectErr, ok := asError(err); ok {
+		return connectErr
+	}
+	connectErr := NewError(CodeInvalidArgument, err)
+	violations := fieldViolations(err)
+	if len(violations) == 0 {
+		return connectErr
+	}
+	if detail, detailErr := newBadRequestDetail(violations); detailErr == nil {
+		connectErr.AddDetail(detail)
+	}
+	return connectErr
+}
+
+// fieldViolations extracts the field violations from an error, if any. In
+// addition to ValidationErrors, it understands the errors generated by
+// protoc-gen-validate, which have Field and Reason methods.
+func fieldViolations(err error) []FieldViolation {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Violations
+	}
+	var fieldErr interface {
+		error
+		Field() string
+		Reason() string
+	}
+	if errors.As(err, &fieldErr) {
+		return []FieldViolation{{Field: fieldErr.Field(), Description: fieldErr.Reason()}}
+	}
+	return nil
+}
+
+//nolint:gochecknoglobals
+var (
+	badRequestOnce sync.Once
+	badRequestDesc protoreflect.MessageDescriptor
+	badRequestErr  error
+)
+
+// newBadRequestDetail constructs a google.rpc.BadRequest error detail. To
+// avoid depending on (or conflicting with) the googleapis Go packages, it
+// builds the message from a private descriptor that's binary-compatible with
+// https://github.com/googleapis/googleapis/blob/master/google/rpc/error_details.proto.
+func newBadRequestDetail(violations []FieldViolation) (*ErrorDetail, error) {
+	badRequestOnce.Do(func() {
+		badRequestDesc, badRequestErr = newBadRequestDescriptor()
+	})
+	if badRequestErr != nil {
+		return nil, badRequestErr
+	}
+	violationsField := badRequestDesc.Fields().ByName("field_violations")
+	violationDesc := violationsField.Message()
+	badRequest := dynamicpb.NewMessage(badRequestDesc)
+	list := badRequest.Mutable(violationsField).List()
+	for _, violation := range violations {
+		msg := dynamicpb.NewMessage(violationDesc)
+		msg.Set(violationDesc.Fields().ByName("field"), protoreflect.ValueOfString(violation.Field))
+		msg.Set(violationDesc.Fields().ByName("description"), protoreflect.ValueOfString(violation.Description))
+		list.Append(protoreflect.ValueOfMessage(msg))
+	}
+	return NewErrorDetail(badRequest)
+}
+
+func newBadRequestDescriptor() (protoreflect.MessageDescriptor, error) {
+	stringField := func(name string, number int32) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		}
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("connect/google/rpc/error_details.proto"),
+		Package: proto.String("google.rpc"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("BadRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("field_violations"),
+				JsonName: proto.String("fieldViolations"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".google.rpc.BadRequest.FieldViolation"),
+			}},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("FieldViolation"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					stringField("field", 1),
+					stringField("description", 2),
+				},
+			}},
+		}},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build google.rpc.BadRequest descriptor: %w", err)
+	}
+	return file.Messages().ByName("BadRequest"), nil
+}
+
+// wrapValidators validates each message the handler receives, and optionally
+// each message it sends.
+func (c *handlerConfig) wrapValidators(implementation StreamingHandlerFunc) StreamingHandlerFunc {
+	if len(c.Validators) == 0 {
+		return implementation
+	}
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return implementation(ctx, &validatingHandlerConn{
+			StreamingHandlerConn: conn,
+			validators:           c.Validators,
+			validateSends:        c.ValidateSends,
+		})
+	}
+}
+
+type validatingHandlerConn struct {
+	StreamingHandlerConn
+
+	validators    []Validator
+	validateSends bool
+}
+
+func (hc *validatingHandlerConn) Receive(msg any) error {
+	if err := hc.StreamingHandlerConn.Receive(msg); err != nil {
+		return err
+	}
+	return validateMessage(hc.validators, msg)
+}
+
+func (hc *validatingHandlerConn) Send(msg any) error {
+	if hc.validateSends {
+		if err := validateMessage(hc.validators, msg); err != nil {
+			return err
+		}
+	}
+	return hc.StreamingHandlerConn.Send(msg)
+}
+
+// wrapValidators validates each message the client receives, and optionally
+// each message it sends.
+func (c *clientConfig) wrapValidators(conn StreamingClientConn) StreamingClientConn {
+	if len(c.Validators) == 0 {
+		return conn
+	}
+	return &validatingClientConn{
+		StreamingClientConn: conn,
+		validators:          c.Validators,
+		validateSends:       c.ValidateSends,
+	}
+}
+
+type validatingClientConn struct {
+	StreamingClientConn
+
+	validators    []Validator
+	validateSends bool
+}
+
+func (cc *validatingClientConn) Send(msg any) error {
+	if cc.validateSends {
+		if err := validateMessage(cc.validators, msg); err != nil {
+			return err
+		}
+	}
+	return cc.StreamingClientConn.Send(msg)
+}
+
+func (cc *validatingClientConn) Receive(msg any) error {
+	if err := cc.StreamingClientConn.Receive(msg); err != nil {
+		return err
+	}
+	return validateMessage(cc.validators, msg)
+}
@@ -0,0 +1,153 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	connect "github.com/joshcarp/connect-no"
+	"github.com/joshcarp/connect-no/internal/assert"
+	pingv1_test "github.com/joshcarp/connect-no/ping/v1"
+	pingv1connect_test "github.com/joshcarp/connect-no/ping/v1/pingv1connect"
+)
+
+func TestValidator(t *testing.T) {
+	t.Parallel()
+	// Numbers must be positive.
+	validator := connect.ValidatorFunc(func(msg any) error {
+		var number int64
+		switch msg := msg.(type) {
+		case *pingv1_test.PingRequest:
+			number = msg.Number
+		case *pingv1_test.PingResponse:
+			number = msg.Number
+		case *pingv1_test.CumSumRequest:
+			number = msg.Number
+		default:
+			return nil
+		}
+		if number < 0 {
+			return &connect.ValidationError{Violations: []connect.FieldViolation{
+				{Field: "number", Description: "must be positive"},
+			}}
+		}
+		return nil
+	})
+	var pingedThree atomic.Bool
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect_test.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1_test.PingRequest]) (*connect.Response[pingv1_test.PingResponse], error) {
+				if request.Msg.Number == 3 {
+					pingedThree.Store(true)
+				}
+				// Respond with invalid messages for even numbers.
+				number := request.Msg.Number
+				if number%2 == 0 {
+					number = -number
+				}
+				return connect.NewResponse(&pingv1_test.PingResponse{Number: number}), nil
+			},
+			cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1_test.CumSumRequest, pingv1_test.CumSumResponse]) error {
+				var sum int64
+				for {
+					msg, err := stream.Receive()
+					if errors.Is(err, io.EOF) {
+						return nil
+					} else if err != nil {
+						return err
+					}
+					sum += msg.Number
+					if err := stream.Send(&pingv1_test.CumSumResponse{Sum: sum}); err != nil {
+						return err
+					}
+				}
+			},
+		},
+		connect.WithValidator(validator),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1}))
+		assert.Nil(t, err)
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: -1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Message(), "invalid message: number: must be positive")
+		assert.Equal(t, len(connectErr.Details()), 1)
+		assert.Equal(t, connectErr.Details()[0].Type(), "google.rpc.BadRequest")
+	})
+	t.Run("bidi", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1_test.CumSumRequest{Number: 1}))
+		response, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Sum, 1)
+		// The handler rejects the second message, not the whole stream.
+		assert.Nil(t, stream.Send(&pingv1_test.CumSumRequest{Number: -1}))
+		_, err = stream.Receive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+	})
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithValidator(validator, connect.ValidatorFunc(func(msg any) error {
+				if request, ok := msg.(*pingv1_test.PingRequest); ok && request.Number == 3 {
+					return errors.New("three is unlucky")
+				}
+				return nil
+			})),
+			connect.WithSendValidation(),
+		)
+		// The server would accept 3, so the client must reject it locally.
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 3}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.False(t, pingedThree.Load())
+		// The server responds with -2, which the client rejects.
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 2}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+	})
+	t.Run("connect_error", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect_test.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithValidator(connect.ValidatorFunc(func(msg any) error {
+				return connect.NewError(connect.CodeFailedPrecondition, errors.New("rejected"))
+			})),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1_test.PingRequest{Number: 1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+	})
+}